@@ -0,0 +1,94 @@
+package ca
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Revocation reasons of RFC 5280 a user can give
+// when rotating a signing key.
+const (
+	ReasonUnspecified   = 0
+	ReasonKeyCompromise = 1
+	ReasonSuperseded    = 4
+)
+
+// Authority is the root certificate of the CA along with
+// its private key, encrypted with the key of KeyReference.
+type Authority struct {
+	ID           uint64
+	Certificate  []byte
+	PrivateKey   []byte
+	KeyReference []byte
+	CreatedAt    time.Time
+}
+
+// Certificate is a certificate issued to a signing key of a user.
+type Certificate struct {
+	ID           uint64 `json:"id"`
+	UserID       uint64 `json:"user_id"`
+	SerialNumber string `json:"serial_number"`
+
+	// Fingerprint of the certified public key, the one
+	// of the signing key registry.
+	Fingerprint string `json:"fingerprint"`
+	Certificate []byte `json:"-"`
+
+	NotBefore        time.Time  `json:"not_before"`
+	NotAfter         time.Time  `json:"not_after"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason int        `json:"revocation_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Revokes reports whether the revocation of c invalidates a signature
+// made at signTime, proven by a timestamp or only claimed by the
+// signer. Revocations invalidate the signatures made from the
+// revocation on, a compromised key also the ones whose signing time
+// is not proven since anyone holding the key can claim an earlier one.
+func (c Certificate) Revokes(signTime time.Time, proven bool) bool {
+	if c.RevokedAt == nil {
+		return false
+	}
+
+	if c.RevocationReason == ReasonKeyCompromise && !proven {
+		return true
+	}
+
+	return !signTime.Before(*c.RevokedAt)
+}
+
+// Config is the identity of the CA and the
+// lifetime of the certificates it issues.
+type Config struct {
+	Name     string
+	CRLURL   string
+	Validity time.Duration
+}
+
+// ConfigFromEnv returns the configuration set by CA_NAME, CA_CRL_URL,
+// the public URL of /ca/crl written in issued certificates, and
+// CA_CERT_VALIDITY. Certificates are valid for a year by default.
+func ConfigFromEnv() Config {
+	config := Config{
+		Name:     os.Getenv("CA_NAME"),
+		CRLURL:   os.Getenv("CA_CRL_URL"),
+		Validity: 365 * 24 * time.Hour,
+	}
+
+	if config.Name == "" {
+		config.Name = "Encryption Signing CA"
+	}
+
+	if value := os.Getenv("CA_CERT_VALIDITY"); value != "" {
+		validity, err := time.ParseDuration(value)
+		if err != nil || validity <= 0 {
+			fmt.Printf("invalid certificate validity CA_CERT_VALIDITY: %v\n", value)
+		} else {
+			config.Validity = validity
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,47 @@
+package ca
+
+import (
+	"context"
+	"encryption/helper"
+	"net/http"
+)
+
+type CAService interface {
+	certificate() []byte
+	crl(ctx context.Context) ([]byte, error)
+}
+
+type Handler struct {
+	caService CAService
+}
+
+func NewCAHandler(
+	cs CAService,
+) Handler {
+	return Handler{
+		caService: cs,
+	}
+}
+
+// GetCertificate serves the CA certificate signatures are
+// verified against, verifiers add it to their trust store.
+func (h *Handler) GetCertificate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/pkix-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="ca.crt"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(h.caService.certificate())
+}
+
+// GetCRL serves the list of the revoked user certificates.
+func (h *Handler) GetCRL(w http.ResponseWriter, r *http.Request) {
+	crl, err := h.caService.crl(r.Context())
+	if err != nil {
+		helper.WriteResponse(w, http.StatusInternalServerError, helper.Response{Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("content-type", "application/pkix-crl")
+	w.Header().Set("Content-Disposition", `attachment; filename="ca.crl"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(crl)
+}
@@ -0,0 +1,270 @@
+package ca
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DB interface {
+	GetConn() *pgxpool.Pool
+}
+
+type caRepository struct {
+	db DB
+}
+
+func NewCARepository(db DB) *caRepository {
+	return &caRepository{
+		db: db,
+	}
+}
+
+// GetAuthority returns the latest root of the CA.
+func (cr *caRepository) GetAuthority(ctx context.Context) (Authority, error) {
+	var authority Authority
+
+	stmt := `
+	SELECT
+		id,
+		certificate,
+		private_key,
+		key_reference,
+		created_at
+	FROM certificate_authority
+	ORDER BY id DESC
+	LIMIT 1
+	`
+
+	err := cr.db.GetConn().QueryRow(ctx, stmt).Scan(
+		&authority.ID,
+		&authority.Certificate,
+		&authority.PrivateKey,
+		&authority.KeyReference,
+		&authority.CreatedAt,
+	)
+	if err != nil {
+		return Authority{}, err
+	}
+
+	return authority, nil
+}
+
+func (cr *caRepository) CreateAuthority(ctx context.Context, authority Authority) (uint64, error) {
+	stmt := `
+	INSERT INTO
+		certificate_authority (
+			certificate,
+			private_key,
+			key_reference
+		)
+	VALUES (
+		$1,
+		$2,
+		$3
+	)
+	RETURNING id
+	`
+
+	err := cr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		authority.Certificate,
+		authority.PrivateKey,
+		authority.KeyReference,
+	).Scan(&authority.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return authority.ID, nil
+}
+
+func (cr *caRepository) CreateCertificate(ctx context.Context, cert Certificate) (uint64, error) {
+	stmt := `
+	INSERT INTO
+		user_certificates (
+			user_id,
+			serial_number,
+			fingerprint,
+			certificate,
+			not_before,
+			not_after
+		)
+	VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6
+	)
+	RETURNING id
+	`
+
+	err := cr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		cert.UserID,
+		cert.SerialNumber,
+		cert.Fingerprint,
+		cert.Certificate,
+		cert.NotBefore,
+		cert.NotAfter,
+	).Scan(&cert.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return cert.ID, nil
+}
+
+const selectCertificate = `
+	SELECT
+			id,
+			user_id,
+			serial_number,
+			fingerprint,
+			certificate,
+			not_before,
+			not_after,
+			revoked_at,
+			COALESCE(revocation_reason, 0),
+			created_at
+	 FROM user_certificates
+`
+
+type row interface {
+	Scan(dest ...any) error
+}
+
+func scanCertificate(r row) (Certificate, error) {
+	var cert Certificate
+
+	err := r.Scan(
+		&cert.ID,
+		&cert.UserID,
+		&cert.SerialNumber,
+		&cert.Fingerprint,
+		&cert.Certificate,
+		&cert.NotBefore,
+		&cert.NotAfter,
+		&cert.RevokedAt,
+		&cert.RevocationReason,
+		&cert.CreatedAt,
+	)
+
+	return cert, err
+}
+
+func (cr *caRepository) listCertificates(ctx context.Context, stmt string, args ...any) ([]Certificate, error) {
+	var certs []Certificate
+
+	rows, err := cr.db.GetConn().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cert, err := scanCertificate(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// GetActiveCertificate returns the unrevoked certificate of the
+// key of a user with the fingerprint expiring last.
+func (cr *caRepository) GetActiveCertificate(ctx context.Context, userID uint64, fingerprint string) (Certificate, error) {
+	stmt := selectCertificate + `
+	 WHERE user_id = $1
+	 	AND fingerprint = $2
+	 	AND revoked_at IS NULL
+	 	AND not_after > now()
+	 ORDER BY not_after DESC
+	 LIMIT 1
+	`
+
+	return scanCertificate(cr.db.GetConn().QueryRow(ctx, stmt, userID, fingerprint))
+}
+
+// ListRevokedByFingerprint lists the revoked certificates
+// of the key with the fingerprint.
+func (cr *caRepository) ListRevokedByFingerprint(ctx context.Context, fingerprint string) ([]Certificate, error) {
+	stmt := selectCertificate + ` WHERE fingerprint = $1 AND revoked_at IS NOT NULL`
+
+	return cr.listCertificates(ctx, stmt, fingerprint)
+}
+
+// ListRevoked lists the revoked certificates, oldest revocation first.
+func (cr *caRepository) ListRevoked(ctx context.Context) ([]Certificate, error) {
+	stmt := selectCertificate + ` WHERE revoked_at IS NOT NULL ORDER BY revoked_at, id`
+
+	return cr.listCertificates(ctx, stmt)
+}
+
+// Revoke revokes the certificates of the key of a user
+// with the fingerprint and returns how many were revoked.
+func (cr *caRepository) Revoke(ctx context.Context, userID uint64, fingerprint string, reason int) (int64, error) {
+	stmt := `
+	UPDATE user_certificates
+	SET revoked_at = now(), revocation_reason = $3
+	WHERE user_id = $1 AND fingerprint = $2 AND revoked_at IS NULL
+	`
+
+	tag, err := cr.db.GetConn().Exec(ctx, stmt, userID, fingerprint, reason)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// ListUsersWithoutCertificate lists the users whose current
+// signing key has no active certificate.
+func (cr *caRepository) ListUsersWithoutCertificate(ctx context.Context) ([]uint64, error) {
+	var userIDs []uint64
+
+	stmt := `
+	SELECT sk.user_id
+	FROM signing_keys sk
+	WHERE sk.current
+		AND NOT EXISTS (
+			SELECT 1 FROM user_certificates uc
+			WHERE uc.user_id = sk.user_id
+				AND uc.fingerprint = sk.fingerprint
+				AND uc.revoked_at IS NULL
+				AND uc.not_after > now()
+		)
+	ORDER BY sk.user_id
+	`
+
+	rows, err := cr.db.GetConn().Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uint64
+		err := rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
@@ -0,0 +1,504 @@
+package ca
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encryption/guard"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const keyTable = "keys"
+
+// crlValidity is how long a published CRL is valid,
+// CRLs are generated on request.
+const crlValidity = 24 * time.Hour
+
+var (
+	ErrCertificateRevoked   = errors.New("signer certificate is revoked")
+	ErrUntrustedCertificate = errors.New("signer certificate is not issued by the certificate authority")
+	ErrInvalidReason        = errors.New("invalid revocation reason")
+)
+
+// serialLimit bounds the random serial numbers to 128 bits.
+var serialLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+var (
+	oidExtKeyUsage  = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidTimeStamping = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+)
+
+type CARepository interface {
+	GetAuthority(ctx context.Context) (Authority, error)
+	CreateAuthority(ctx context.Context, authority Authority) (uint64, error)
+	CreateCertificate(ctx context.Context, cert Certificate) (uint64, error)
+	GetActiveCertificate(ctx context.Context, userID uint64, fingerprint string) (Certificate, error)
+	ListRevokedByFingerprint(ctx context.Context, fingerprint string) ([]Certificate, error)
+	ListRevoked(ctx context.Context) ([]Certificate, error)
+	Revoke(ctx context.Context, userID uint64, fingerprint string, reason int) (int64, error)
+	ListUsersWithoutCertificate(ctx context.Context) ([]uint64, error)
+}
+
+type Guard interface {
+	GetKey(ctx context.Context, table string, metadata []byte) (guard.Key, error)
+	StoreKey(ctx context.Context, table string, key guard.Key) ([]byte, error)
+	GenerateKey() ([]byte, error)
+	Decrypt(key []byte, data []byte) ([]byte, error)
+	Encrypt(key []byte, data []byte) ([]byte, error)
+}
+
+type caService struct {
+	caRepository CARepository
+	guard        Guard
+	config       Config
+
+	root    *x509.Certificate
+	rootKey *rsa.PrivateKey
+}
+
+// NewCAService loads the root of the CA, creating
+// it on the first start.
+func NewCAService(
+	ctx context.Context,
+	cr CARepository,
+	g Guard,
+	config Config,
+) (*caService, error) {
+	cs := &caService{
+		caRepository: cr,
+		guard:        g,
+		config:       config,
+	}
+
+	authority, err := cr.GetAuthority(ctx)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	if err == pgx.ErrNoRows {
+		authority, err = cs.createAuthority(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = cs.loadAuthority(ctx, authority)
+	if err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// newRoot returns a self-signed CA certificate and its key.
+func newRoot(name string, now time.Time) (*x509.Certificate, *rsa.PrivateKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return root, privateKey, nil
+}
+
+// createAuthority generates and stores a new root, its private
+// key encrypted with a key of the guard.
+func (cs *caService) createAuthority(ctx context.Context) (Authority, error) {
+	root, privateKey, err := newRoot(cs.config.Name, time.Now())
+	if err != nil {
+		return Authority{}, err
+	}
+
+	key, err := cs.guard.GenerateKey()
+	if err != nil {
+		return Authority{}, err
+	}
+
+	metadata, err := cs.guard.StoreKey(ctx, keyTable, guard.Key{
+		PlainKey: key,
+	})
+	if err != nil {
+		return Authority{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return Authority{}, err
+	}
+
+	encryptedKey, err := cs.guard.Encrypt(key, der)
+	if err != nil {
+		return Authority{}, err
+	}
+
+	authority := Authority{
+		Certificate:  root.Raw,
+		PrivateKey:   encryptedKey,
+		KeyReference: metadata,
+	}
+
+	authority.ID, err = cs.caRepository.CreateAuthority(ctx, authority)
+	if err != nil {
+		return Authority{}, err
+	}
+
+	return authority, nil
+}
+
+func (cs *caService) loadAuthority(ctx context.Context, authority Authority) error {
+	root, err := x509.ParseCertificate(authority.Certificate)
+	if err != nil {
+		return err
+	}
+
+	key, err := cs.guard.GetKey(ctx, keyTable, authority.KeyReference)
+	if err != nil {
+		return err
+	}
+
+	der, err := cs.guard.Decrypt(key.PlainKey, authority.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return err
+	}
+
+	rootKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("certificate authority key is not an RSA key")
+	}
+
+	cs.root = root
+	cs.rootKey = rootKey
+
+	return nil
+}
+
+// Issue certifies publicKey as the signing key of a user.
+func (cs *caService) Issue(
+	ctx context.Context,
+	userID uint64,
+	username string,
+	email string,
+	publicKey *rsa.PublicKey,
+) (*x509.Certificate, error) {
+	fingerprint, err := signingkey.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: username},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(cs.config.Validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+
+	if email != "" {
+		template.EmailAddresses = []string{email}
+	}
+
+	if cs.config.CRLURL != "" {
+		template.CRLDistributionPoints = []string{cs.config.CRLURL}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, cs.root, publicKey, cs.rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cs.caRepository.CreateCertificate(ctx, Certificate{
+		UserID:       userID,
+		SerialNumber: serial.Text(16),
+		Fingerprint:  fingerprint,
+		Certificate:  der,
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// IssueTimestampCertificate certifies the key of the local TSA and
+// returns its chain. TSA certificates are not stored, tokens embed
+// them.
+func (cs *caService) IssueTimestampCertificate(ctx context.Context, publicKey *rsa.PublicKey) ([]*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 3161 requires the timeStamping usage to be critical
+	keyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidTimeStamping})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cs.config.Name + " Timestamping"},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     cs.root.NotAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtraExtensions: []pkix.Extension{{
+			Id:       oidExtKeyUsage,
+			Critical: true,
+			Value:    keyUsage,
+		}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, cs.root, publicKey, cs.rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*x509.Certificate{cert, cs.root}, nil
+}
+
+// Chain returns the certificate of the signing key of a user followed
+// by the CA certificate. A certificate is issued when the key has no
+// active one or when the username or email changed since.
+func (cs *caService) Chain(
+	ctx context.Context,
+	userID uint64,
+	username string,
+	email string,
+	publicKey *rsa.PublicKey,
+) ([]*x509.Certificate, error) {
+	fingerprint, err := signingkey.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// a revoked key must be rotated before signing again
+	err = cs.CheckKey(ctx, fingerprint, time.Now(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	var cert *x509.Certificate
+
+	active, err := cs.caRepository.GetActiveCertificate(ctx, userID, fingerprint)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	if err == nil {
+		cert, err = x509.ParseCertificate(active.Certificate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cert == nil || cert.Subject.CommonName != username || !sameEmail(cert, email) {
+		cert, err = cs.Issue(ctx, userID, username, email, publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return []*x509.Certificate{cert, cs.root}, nil
+}
+
+func sameEmail(cert *x509.Certificate, email string) bool {
+	if email == "" {
+		return len(cert.EmailAddresses) == 0
+	}
+
+	return len(cert.EmailAddresses) == 1 && cert.EmailAddresses[0] == email
+}
+
+// Check builds the chain of cert up to the CA with the intermediates
+// embedded in a signature, as it was at signTime, and checks that its
+// key was not revoked by then. proven is true when a timestamp
+// attests signTime.
+func (cs *caService) Check(
+	ctx context.Context,
+	cert *x509.Certificate,
+	intermediates []*x509.Certificate,
+	signTime time.Time,
+	proven bool,
+) error {
+	if signTime.IsZero() {
+		signTime = time.Now()
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cs.root)
+
+	pool := x509.NewCertPool()
+	for _, intermediate := range intermediates {
+		pool.AddCert(intermediate)
+	}
+
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		CurrentTime:   signTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	})
+	if err != nil {
+		var unknownAuthority x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthority) {
+			return ErrUntrustedCertificate
+		}
+		return err
+	}
+
+	fingerprint, err := signingkey.Fingerprint(cert.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	return cs.CheckKey(ctx, fingerprint, signTime, proven)
+}
+
+// CheckKey checks that the key with the fingerprint was not revoked
+// for signatures made at signTime, proven by a timestamp or not.
+func (cs *caService) CheckKey(ctx context.Context, fingerprint string, signTime time.Time, proven bool) error {
+	if signTime.IsZero() {
+		signTime = time.Now()
+	}
+
+	revoked, err := cs.caRepository.ListRevokedByFingerprint(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range revoked {
+		if cert.Revokes(signTime, proven) {
+			return ErrCertificateRevoked
+		}
+	}
+
+	return nil
+}
+
+// Revoke revokes the certificates of a signing key of a user.
+func (cs *caService) Revoke(ctx context.Context, userID uint64, fingerprint string, reason int) error {
+	switch reason {
+	case ReasonUnspecified, ReasonKeyCompromise, ReasonSuperseded:
+	default:
+		return ErrInvalidReason
+	}
+
+	_, err := cs.caRepository.Revoke(ctx, userID, fingerprint, reason)
+
+	return err
+}
+
+// ListRevokedByFingerprint lists the revoked certificates
+// of the key with the fingerprint.
+func (cs *caService) ListRevokedByFingerprint(ctx context.Context, fingerprint string) ([]Certificate, error) {
+	return cs.caRepository.ListRevokedByFingerprint(ctx, fingerprint)
+}
+
+// ListUsersWithoutCertificate lists the users whose
+// current signing key has no active certificate.
+func (cs *caService) ListUsersWithoutCertificate(ctx context.Context) ([]uint64, error) {
+	return cs.caRepository.ListUsersWithoutCertificate(ctx)
+}
+
+// Root returns the CA certificate.
+func (cs *caService) Root() *x509.Certificate {
+	return cs.root
+}
+
+// certificate returns the DER encoded CA certificate.
+func (cs *caService) certificate() []byte {
+	return cs.root.Raw
+}
+
+// crl returns a DER encoded CRL of the revoked certificates.
+func (cs *caService) crl(ctx context.Context) ([]byte, error) {
+	revoked, err := cs.caRepository.ListRevoked(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, cert := range revoked {
+		serial, ok := new(big.Int).SetString(cert.SerialNumber, 16)
+		if !ok {
+			return nil, errors.New("invalid certificate serial number")
+		}
+
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *cert.RevokedAt,
+			ReasonCode:     cert.RevocationReason,
+		})
+	}
+
+	now := time.Now()
+
+	template := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		// CRLs are not stored, their number follows time
+		Number:     big.NewInt(now.Unix()),
+		ThisUpdate: now,
+		NextUpdate: now.Add(crlValidity),
+	}
+
+	return x509.CreateRevocationList(rand.Reader, template, cs.root, cs.rootKey)
+}
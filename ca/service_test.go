@@ -0,0 +1,229 @@
+package ca
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type fakeRepository struct {
+	certs []Certificate
+}
+
+func (f *fakeRepository) GetAuthority(ctx context.Context) (Authority, error) {
+	return Authority{}, pgx.ErrNoRows
+}
+
+func (f *fakeRepository) CreateAuthority(ctx context.Context, authority Authority) (uint64, error) {
+	return 1, nil
+}
+
+func (f *fakeRepository) CreateCertificate(ctx context.Context, cert Certificate) (uint64, error) {
+	cert.ID = uint64(len(f.certs) + 1)
+	f.certs = append(f.certs, cert)
+	return cert.ID, nil
+}
+
+func (f *fakeRepository) GetActiveCertificate(ctx context.Context, userID uint64, fingerprint string) (Certificate, error) {
+	for i := len(f.certs) - 1; i >= 0; i-- {
+		cert := f.certs[i]
+		if cert.UserID == userID && cert.Fingerprint == fingerprint && cert.RevokedAt == nil {
+			return cert, nil
+		}
+	}
+	return Certificate{}, pgx.ErrNoRows
+}
+
+func (f *fakeRepository) ListRevokedByFingerprint(ctx context.Context, fingerprint string) ([]Certificate, error) {
+	var revoked []Certificate
+	for _, cert := range f.certs {
+		if cert.Fingerprint == fingerprint && cert.RevokedAt != nil {
+			revoked = append(revoked, cert)
+		}
+	}
+	return revoked, nil
+}
+
+func (f *fakeRepository) ListRevoked(ctx context.Context) ([]Certificate, error) {
+	var revoked []Certificate
+	for _, cert := range f.certs {
+		if cert.RevokedAt != nil {
+			revoked = append(revoked, cert)
+		}
+	}
+	return revoked, nil
+}
+
+func (f *fakeRepository) Revoke(ctx context.Context, userID uint64, fingerprint string, reason int) (int64, error) {
+	var n int64
+	now := time.Now()
+	for i, cert := range f.certs {
+		if cert.UserID == userID && cert.Fingerprint == fingerprint && cert.RevokedAt == nil {
+			f.certs[i].RevokedAt = &now
+			f.certs[i].RevocationReason = reason
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeRepository) ListUsersWithoutCertificate(ctx context.Context) ([]uint64, error) {
+	return nil, nil
+}
+
+func newTestCA(t *testing.T) (*caService, *fakeRepository) {
+	root, rootKey, err := newRoot("Test CA", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &fakeRepository{}
+	return &caService{
+		caRepository: repo,
+		config:       Config{Name: "Test CA", Validity: time.Hour},
+		root:         root,
+		rootKey:      rootKey,
+	}, repo
+}
+
+func newKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	cs, _ := newTestCA(t)
+	key := newKey(t)
+
+	chain, err := cs.Chain(ctx, 1, "alice", "alice@example.com", &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := chain[0]
+	if cert.Subject.CommonName != "alice" || cert.EmailAddresses[0] != "alice@example.com" {
+		t.Fatalf("unexpected subject %v %v", cert.Subject, cert.EmailAddresses)
+	}
+
+	err = cs.Check(ctx, cert, chain, time.Now(), false)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	// the active certificate is reused
+	again, err := cs.Chain(ctx, 1, "alice", "alice@example.com", &key.PublicKey)
+	if err != nil || !again[0].Equal(cert) {
+		t.Fatalf("Chain() issued a second certificate, error = %v", err)
+	}
+
+	// and issued again when the username changes
+	renamed, err := cs.Chain(ctx, 1, "alicia", "alice@example.com", &key.PublicKey)
+	if err != nil || renamed[0].Subject.CommonName != "alicia" {
+		t.Fatalf("Chain() kept the old subject, error = %v", err)
+	}
+
+	err = cs.Check(ctx, cert, chain, time.Now().Add(2*time.Hour), false)
+	if err == nil {
+		t.Error("expired certificate was accepted")
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "alice"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selfSigned, _ := x509.ParseCertificate(der)
+
+	err = cs.Check(ctx, selfSigned, []*x509.Certificate{selfSigned}, time.Now(), false)
+	if !errors.Is(err, ErrUntrustedCertificate) {
+		t.Errorf("self-signed Check() error = %v, want %v", err, ErrUntrustedCertificate)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		reason      int
+		validBefore bool
+	}{
+		{ReasonSuperseded, true},
+		{ReasonKeyCompromise, false},
+	} {
+		cs, repo := newTestCA(t)
+		key := newKey(t)
+
+		chain, err := cs.Chain(ctx, 1, "alice", "", &key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		before := time.Now().Add(-time.Second)
+
+		err = cs.Revoke(ctx, 1, repo.certs[0].Fingerprint, tt.reason)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cs.Check(ctx, chain[0], chain, before, false)
+		if (err == nil) != tt.validBefore {
+			t.Errorf("reason %d: Check() before revocation error = %v", tt.reason, err)
+		}
+
+		// a timestamp proves the signature predates the revocation
+		err = cs.Check(ctx, chain[0], chain, before, true)
+		if err != nil {
+			t.Errorf("reason %d: Check() timestamped before revocation error = %v", tt.reason, err)
+		}
+
+		for _, proven := range []bool{false, true} {
+			err = cs.Check(ctx, chain[0], chain, time.Now().Add(time.Second), proven)
+			if !errors.Is(err, ErrCertificateRevoked) {
+				t.Errorf("reason %d: Check() after revocation error = %v", tt.reason, err)
+			}
+		}
+
+		// a revoked key is not certified again
+		_, err = cs.Chain(ctx, 1, "alice", "", &key.PublicKey)
+		if !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("reason %d: Chain() error = %v", tt.reason, err)
+		}
+
+		der, err := cs.crl(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := crl.CheckSignatureFrom(cs.root); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := crl.RevokedCertificateEntries
+		if len(entries) != 1 || entries[0].SerialNumber.Cmp(chain[0].SerialNumber) != 0 || entries[0].ReasonCode != tt.reason {
+			t.Errorf("reason %d: unexpected CRL entries %+v", tt.reason, entries)
+		}
+	}
+}
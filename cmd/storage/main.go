@@ -0,0 +1,116 @@
+// Command storage reconciles the stored blobs and keys with the
+// database.
+//
+// Usage:
+//
+//	storage report [-grace 24h]
+//	storage collect [-grace 24h]
+//
+// report prints the orphans and dangling references as json,
+// collect also deletes the orphans older than the grace period.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encryption/database"
+	"encryption/guard"
+	"encryption/storage"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: storage <report|collect> [-grace duration]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	command := os.Args[1]
+	if command != "report" && command != "collect" {
+		usage()
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	gracePeriod := flags.Duration("grace", storage.GracePeriodFromEnv(), "minimum age of deleted orphans")
+	flags.Parse(os.Args[2:])
+
+	collector, err := newCollector(*gracePeriod)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var report *storage.Report
+	if command == "collect" {
+		report, err = collector.Collect(context.Background())
+	} else {
+		report, err = collector.Scan(context.Background())
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// newCollector creates a collector from the
+// same environment as the server.
+func newCollector(gracePeriod time.Duration) (*storage.Collector, error) {
+	err := godotenv.Load(".env")
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.NewPostgresClient(
+		database.DatabaseCredentials{
+			Host:     os.Getenv("DB_HOST"),
+			User:     os.Getenv("DB_USER"),
+			Password: os.Getenv("DB_PASS"),
+			Port:     os.Getenv("DB_PORT"),
+			DBName:   os.Getenv("DB_NAME"),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	guardDB, err := database.NewPostgresClient(
+		database.DatabaseCredentials{
+			Host:     os.Getenv("GUARD_DB_HOST"),
+			User:     os.Getenv("GUARD_DB_USER"),
+			Password: os.Getenv("GUARD_DB_PASS"),
+			Port:     os.Getenv("GUARD_DB_PORT"),
+			DBName:   os.Getenv("GUARD_DB_NAME"),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	guardMode, _ := strconv.Atoi(os.Getenv("GUARD_MODE"))
+	guard := guard.NewGuard(
+		guardMode,
+		[]byte(os.Getenv("GUARD_KEY")),
+		guard.NewGuardRepository(guardDB),
+	)
+
+	return storage.NewCollector(
+		storage.NewReferenceRepository(db),
+		guard,
+		"files",
+		gracePeriod,
+	), nil
+}
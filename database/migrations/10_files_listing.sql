@@ -0,0 +1,7 @@
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_files_user_created_at ON files (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_files_user_filename ON files (user_id, filename, id);
+CREATE INDEX IF NOT EXISTS idx_files_user_size ON files (user_id, size, id);
@@ -0,0 +1,6 @@
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20) NOT NULL DEFAULT 'unscanned',
+    ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_files_scan_status ON files (scan_status);
@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS file_versions (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL,
+    version INT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    filepath VARCHAR(255) NOT NULL,
+    key_reference BYTEA,
+    size BIGINT NOT NULL DEFAULT 0,
+    is_signed BOOLEAN DEFAULT false,
+    thumbnail_path VARCHAR(255),
+    scan_status VARCHAR(20) NOT NULL DEFAULT 'unscanned',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CONSTRAINT fk_files FOREIGN KEY (file_id) REFERENCES files(id),
+    CONSTRAINT uq_file_versions UNIQUE (file_id, version)
+);
+
+-- version is the current version of the file, the file row
+-- mirrors the blob, key and status of that version
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+INSERT INTO file_versions (
+    file_id,
+    version,
+    filename,
+    filepath,
+    key_reference,
+    size,
+    is_signed,
+    thumbnail_path,
+    scan_status,
+    created_at
+)
+SELECT
+    id,
+    version,
+    filename,
+    filepath,
+    key_reference,
+    size,
+    is_signed,
+    thumbnail_path,
+    scan_status,
+    created_at
+FROM files
+ON CONFLICT DO NOTHING;
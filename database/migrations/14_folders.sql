@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS folders (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    parent_id INT,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_folders FOREIGN KEY (parent_id) REFERENCES folders(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_folders_name ON folders (user_id, COALESCE(parent_id, 0), name);
+
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS folder_id INT REFERENCES folders(id);
+
+CREATE INDEX IF NOT EXISTS idx_files_folder_id ON files (folder_id);
+
+CREATE TABLE IF NOT EXISTS folder_notifications (
+    id SERIAL PRIMARY KEY,
+    source_user_id INT,
+    target_user_id INT,
+    folder_id INT,
+    status INT,
+    CONSTRAINT fk_folders FOREIGN KEY (folder_id) REFERENCES folders(id)
+);
+
+-- folder_permissions shares every file in a folder and its
+-- subfolders, including files added after the permission
+CREATE TABLE IF NOT EXISTS folder_permissions (
+    id SERIAL PRIMARY KEY,
+    permission_id INT,
+    folder_id INT,
+    CONSTRAINT fk_folders FOREIGN KEY (folder_id) REFERENCES folders(id),
+    CONSTRAINT fk_permissions FOREIGN KEY (permission_id) REFERENCES permissions(id),
+    CONSTRAINT uq_folder_permissions UNIQUE (permission_id, folder_id)
+);
@@ -0,0 +1,10 @@
+-- guard database, the creation time is used by the
+-- garbage collector to skip keys of uploads in progress
+ALTER TABLE keys
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+ALTER TABLE user_keys
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+ALTER TABLE permission_keys
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
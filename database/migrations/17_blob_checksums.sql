@@ -0,0 +1,13 @@
+-- checksum is the sha-256 of the encrypted blob, damaged is set
+-- by the scrubber when the blob does not match its checksum
+ALTER TABLE files
+    ADD COLUMN IF NOT EXISTS checksum BYTEA,
+    ADD COLUMN IF NOT EXISTS damaged BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE file_versions
+    ADD COLUMN IF NOT EXISTS checksum BYTEA,
+    ADD COLUMN IF NOT EXISTS damaged BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE file_permissions
+    ADD COLUMN IF NOT EXISTS checksum BYTEA,
+    ADD COLUMN IF NOT EXISTS damaged BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+-- wrapped_key is the file key encrypted with the permission key,
+-- version is the file version the key was wrapped for. Rows with a
+-- wrapped key read the owner's blob and keep an empty filepath
+ALTER TABLE file_permissions
+    ADD COLUMN IF NOT EXISTS wrapped_key BYTEA,
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,26 @@
+-- share_links give anyone holding the token access to one version of
+-- a file. Only a hash of the token is stored, the file key is wrapped
+-- with a key derived from the token and the optional passphrase.
+-- failed_attempts counts the wrong passphrases tried, the link is
+-- locked once it reaches the maximum
+CREATE TABLE IF NOT EXISTS share_links (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    file_id INT NOT NULL,
+    version INT NOT NULL,
+    token_hash BYTEA NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    salt BYTEA NOT NULL,
+    has_passphrase BOOLEAN NOT NULL DEFAULT false,
+    max_downloads INT NOT NULL DEFAULT 0,
+    downloads INT NOT NULL DEFAULT 0,
+    failed_attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_files FOREIGN KEY (file_id) REFERENCES files(id),
+    CONSTRAINT uq_share_links_token UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_file_id ON share_links (file_id);
@@ -0,0 +1,10 @@
+-- user_quotas override the default storage quotas of a user in
+-- bytes, type is empty for the quota of all files together
+CREATE TABLE IF NOT EXISTS user_quotas (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    type VARCHAR(20) NOT NULL DEFAULT '',
+    max_bytes BIGINT NOT NULL,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT uq_user_quotas UNIQUE (user_id, type)
+);
@@ -0,0 +1,15 @@
+-- signing_keys is the registry of the public keys users sign with.
+-- Retired keys are kept to verify the files they signed
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    public_key TEXT NOT NULL,
+    current BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    retired_at TIMESTAMP,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT uq_signing_keys UNIQUE (user_id, fingerprint)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_signing_keys_current ON signing_keys (user_id) WHERE current;
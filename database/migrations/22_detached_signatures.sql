@@ -0,0 +1,4 @@
+-- signature_path is the detached CMS signature of the version,
+-- encrypted with the version's key next to its blob
+ALTER TABLE file_versions
+    ADD COLUMN IF NOT EXISTS signature_path VARCHAR(255);
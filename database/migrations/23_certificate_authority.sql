@@ -0,0 +1,30 @@
+-- certificate_authority holds the root certificate user signing
+-- certificates are issued by. Its private key is encrypted with a
+-- key of the guard keys table
+CREATE TABLE IF NOT EXISTS certificate_authority (
+    id SERIAL PRIMARY KEY,
+    certificate BYTEA NOT NULL,
+    private_key BYTEA NOT NULL,
+    key_reference BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- user_certificates are the certificates issued to the signing
+-- keys of users. A certificate is revoked with its key when the
+-- user rotates or loses it
+CREATE TABLE IF NOT EXISTS user_certificates (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    serial_number VARCHAR(64) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    certificate BYTEA NOT NULL,
+    not_before TIMESTAMP NOT NULL,
+    not_after TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    revocation_reason INT,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT uq_user_certificates_serial UNIQUE (serial_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_certificates_fingerprint ON user_certificates (fingerprint);
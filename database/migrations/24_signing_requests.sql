@@ -0,0 +1,38 @@
+-- signing_requests collect the signatures of co-signers invited by the
+-- owner of a file. version is the version of the file the next
+-- signature is made on, locked_at is set while a signer is signing
+CREATE TABLE IF NOT EXISTS signing_requests (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL,
+    user_id INT NOT NULL,
+    version INT NOT NULL,
+    ordered BOOLEAN NOT NULL DEFAULT false,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    locked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    completed_at TIMESTAMP,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_files FOREIGN KEY (file_id) REFERENCES files(id)
+);
+
+-- a file has at most one request collecting signatures
+CREATE UNIQUE INDEX IF NOT EXISTS uq_signing_requests_pending
+    ON signing_requests (file_id) WHERE status = 'pending';
+
+-- signing_request_signers are the co-signers of a request, in signing
+-- order for ordered requests. notified_at is the time the signer was
+-- asked to sign, once the signers before it signed
+CREATE TABLE IF NOT EXISTS signing_request_signers (
+    id SERIAL PRIMARY KEY,
+    request_id INT NOT NULL,
+    user_id INT NOT NULL,
+    position INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    notified_at TIMESTAMP,
+    signed_at TIMESTAMP,
+    CONSTRAINT fk_signing_requests FOREIGN KEY (request_id) REFERENCES signing_requests(id) ON DELETE CASCADE,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT uq_signing_request_signers UNIQUE (request_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_request_signers_user_id ON signing_request_signers (user_id);
@@ -0,0 +1,22 @@
+-- client_held signing keys are registered by users who keep their
+-- private key, the server never signs with them
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS client_held BOOLEAN NOT NULL DEFAULT false;
+
+-- signing_sessions hold the data prepared for a client to sign,
+-- until it sends back its signature. signed_data is the exact input
+-- of the signature, sign_time the time it claims
+CREATE TABLE IF NOT EXISTS signing_sessions (
+    id SERIAL PRIMARY KEY,
+    file_id INT NOT NULL,
+    user_id INT NOT NULL,
+    version INT NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    signed_data BYTEA NOT NULL,
+    sign_time TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_files FOREIGN KEY (file_id) REFERENCES files(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_sessions_file_id ON signing_sessions (file_id);
@@ -0,0 +1,18 @@
+-- signature_revocations publish the signatures revoked by their
+-- signer, signature_id is the hex encoded sha-256 of the signature
+-- value, fingerprint the key of the verified signer the revocation
+-- applies to. They are kept once the file is deleted, copies of it
+-- must still verify as revoked
+CREATE TABLE IF NOT EXISTS signature_revocations (
+    id SERIAL PRIMARY KEY,
+    signature_id VARCHAR(64) NOT NULL UNIQUE,
+    file_id INT NOT NULL,
+    version INT NOT NULL,
+    user_id INT NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    revoked_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_signature_revocations_file_id ON signature_revocations (file_id);
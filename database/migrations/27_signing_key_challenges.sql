@@ -0,0 +1,9 @@
+-- signing_key_challenges hold the nonce a user signs to prove
+-- possession of a client held key it registers. A user has at most
+-- one challenge, it is removed once answered
+CREATE TABLE IF NOT EXISTS signing_key_challenges (
+    user_id INT PRIMARY KEY,
+    nonce BYTEA NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_users FOREIGN KEY (user_id) REFERENCES users(id)
+);
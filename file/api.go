@@ -0,0 +1,383 @@
+package file
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Sort keys for file listing.
+const (
+	SortByName string = "name"
+	SortByDate string = "date"
+	SortBySize string = "size"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// UploadOptions defines the owner's options
+// of the upload processing steps.
+type UploadOptions struct {
+	// KeepMetadata skips stripping the embedded
+	// metadata of uploaded images.
+	KeepMetadata bool
+
+	// FolderID is the folder the file is
+	// uploaded to, 0 for the top level.
+	FolderID uint64
+}
+
+type ListFilesRequest struct {
+	UserID         uint64
+	TargetUsername string
+
+	// Type filters the files by type, all types
+	// are listed when empty.
+	Type string
+
+	// Search filters files whose filename contains
+	// the given substring (case insensitive).
+	Search string
+
+	// Signed filters files by signed status,
+	// both are listed when nil.
+	Signed *bool
+
+	// FolderID filters the files of a folder, 0 lists
+	// the top level files. All files are listed when nil.
+	FolderID *uint64
+
+	SortBy string
+	Order  string
+
+	// Cursor is an opaque pointer returned by a previous
+	// listing as NextCursor.
+	Cursor string
+	Limit  int
+}
+
+func (r *ListFilesRequest) Validate() error {
+	if r.Type != "" {
+		fileType, err := ValidateType(r.Type)
+		if err != nil {
+			return err
+		}
+		r.Type = fileType
+	}
+
+	switch r.SortBy {
+	case "":
+		r.SortBy = SortByDate
+	case SortByName, SortByDate, SortBySize:
+	default:
+		return errors.New("Request invalid. Sort value must be name, date or size")
+	}
+
+	switch r.Order {
+	case "":
+		r.Order = "desc"
+	case "asc", "desc":
+	default:
+		return errors.New("Request invalid. Order value must be asc or desc")
+	}
+
+	if r.Limit < 0 {
+		return errors.New("Request invalid. Limit must be a positive number")
+	}
+	if r.Limit == 0 {
+		r.Limit = defaultListLimit
+	}
+	if r.Limit > maxListLimit {
+		r.Limit = maxListLimit
+	}
+
+	return nil
+}
+
+type MoveFileRequest struct {
+	UserID uint64
+	FileID uint64
+
+	// FolderID is the destination folder,
+	// 0 moves the file to the top level.
+	FolderID uint64 `json:"folder_id"`
+}
+
+type ListFilesResponse struct {
+	Files []File `json:"files"`
+
+	// Total is the number of files matching the filters,
+	// regardless of pagination.
+	Total      uint64 `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListFilter defines the repository level filters
+// of a file listing.
+type ListFilter struct {
+	UserID   uint64
+	Type     string
+	Search   string
+	Signed   *bool
+	FolderID *uint64
+	SortBy   string
+	Desc     bool
+	After    *ListCursor
+	Limit    int
+}
+
+// ListCursor points to the last file of a listing page.
+// Value holds the sort column value of the file.
+type ListCursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d"`
+	Value  string `json:"v"`
+	ID     uint64 `json:"id"`
+}
+
+// NewListCursor creates a cursor pointing to f.
+func NewListCursor(sortBy string, desc bool, f File) ListCursor {
+	cursor := ListCursor{
+		SortBy: sortBy,
+		Desc:   desc,
+		ID:     f.ID,
+	}
+
+	switch sortBy {
+	case SortByName:
+		cursor.Value = f.Filename
+	case SortBySize:
+		cursor.Value = strconv.FormatInt(f.Size, 10)
+	default:
+		cursor.Value = f.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	return cursor
+}
+
+// Encode encodes the cursor to an url safe string.
+func (c ListCursor) Encode() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeListCursor decodes an encoded cursor and checks
+// that it was made for the same sort key and order.
+func DecodeListCursor(s string, sortBy string, desc bool) (*ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	var cursor ListCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	if cursor.SortBy != sortBy || cursor.Desc != desc {
+		return nil, errors.New("cursor does not match sort")
+	}
+
+	return &cursor, nil
+}
+
+// SortValue returns the cursor value typed
+// according to its sort column.
+func (c ListCursor) SortValue() (any, error) {
+	switch c.SortBy {
+	case SortByName:
+		return c.Value, nil
+	case SortBySize:
+		size, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		return size, nil
+	default:
+		date, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		return date, nil
+	}
+}
+
+// maxArchiveFiles is the number of files one archive can hold.
+const maxArchiveFiles = 100
+
+// ArchiveRequest downloads files as one ZIP archive, encrypted
+// with AES-256 when a password is given.
+type ArchiveRequest struct {
+	UserID   uint64
+	FileIDs  []uint64 `json:"file_ids"`
+	Password string   `json:"password"`
+}
+
+func (r *ArchiveRequest) Validate() error {
+	if len(r.FileIDs) == 0 {
+		return errors.New("Request invalid. File_ids is required")
+	}
+	if len(r.FileIDs) > maxArchiveFiles {
+		return fmt.Errorf("Request invalid. An archive can hold at most %v files", maxArchiveFiles)
+	}
+
+	seen := make(map[uint64]bool, len(r.FileIDs))
+	for _, id := range r.FileIDs {
+		if seen[id] {
+			return fmt.Errorf("Request invalid. File %v is listed twice", id)
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
+
+// SetQuotaRequest overrides the default quota of a user.
+type SetQuotaRequest struct {
+	UserID uint64
+
+	// Type is empty for the quota of all files together.
+	Type     string `json:"type"`
+	MaxBytes int64  `json:"max_bytes"`
+}
+
+func (r *SetQuotaRequest) Validate() error {
+	if r.Type != "" {
+		fileType, err := ValidateType(r.Type)
+		if err != nil {
+			return errors.New("Request invalid. Type must be a file type or empty")
+		}
+		r.Type = fileType
+	}
+
+	if r.MaxBytes < 0 {
+		return errors.New("Request invalid. Max_bytes can not be negative")
+	}
+
+	return nil
+}
+
+// maxCoSigners is the number of co-signers one signing request can invite.
+const maxCoSigners = 20
+
+// CreateSigningRequest invites co-signers to sign a file of the owner.
+type CreateSigningRequest struct {
+	UserID uint64
+	FileID uint64
+
+	// Signers are the usernames of the co-signers,
+	// in signing order when Ordered.
+	Signers []string `json:"signers"`
+	Ordered bool     `json:"ordered"`
+}
+
+func (r *CreateSigningRequest) Validate() error {
+	if len(r.Signers) == 0 {
+		return errors.New("Request invalid. Signers is required")
+	}
+	if len(r.Signers) > maxCoSigners {
+		return fmt.Errorf("Request invalid. A signing request can invite at most %v signers", maxCoSigners)
+	}
+
+	seen := make(map[string]bool, len(r.Signers))
+	for _, username := range r.Signers {
+		if username == "" {
+			return errors.New("Request invalid. Signers can not be empty")
+		}
+		if seen[username] {
+			return fmt.Errorf("Request invalid. Signer %v is listed twice", username)
+		}
+		seen[username] = true
+	}
+
+	return nil
+}
+
+// PrepareSignatureRequest starts the signature of the current version
+// of a file by the client held key of its owner.
+type PrepareSignatureRequest struct {
+	UserID uint64
+	FileID uint64
+
+	// Format is the signature format, PDF documents
+	// default to PAdES and other files to detached.
+	Format string
+}
+
+// PrepareSignatureResponse is the data a client signs to complete
+// the signing session.
+type PrepareSignatureResponse struct {
+	SessionID uint64            `json:"session_id"`
+	Format    string            `json:"format"`
+	Metadata  SignatureMetadata `json:"metadata"`
+
+	// SignedData is the input of the signature, the metadata
+	// for embedded signatures and the DER encoded CMS signed
+	// attributes otherwise. Digest is its hex encoded sha-256,
+	// for clients signing digests.
+	SignedData []byte    `json:"signed_data"`
+	Digest     string    `json:"digest"`
+	Algorithm  string    `json:"algorithm"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CompleteSignatureRequest sends the signature of the data
+// prepared by a signing session.
+type CompleteSignatureRequest struct {
+	UserID    uint64
+	FileID    uint64
+	SessionID uint64 `json:"session_id"`
+	Signature []byte `json:"signature"`
+}
+
+func (r *CompleteSignatureRequest) Validate() error {
+	if r.SessionID == 0 {
+		return errors.New("Request invalid. Session_id is required")
+	}
+	if len(r.Signature) == 0 {
+		return errors.New("Request invalid. Signature is required")
+	}
+
+	return nil
+}
+
+// RevokeSignatureRequest revokes the signatures a user
+// made of the current version of a file.
+type RevokeSignatureRequest struct {
+	UserID uint64
+	FileID uint64
+
+	// Reason is signed_in_error, key_compromise or
+	// unspecified, it defaults to unspecified.
+	Reason string `json:"reason"`
+}
+
+func (r *RevokeSignatureRequest) Validate() error {
+	switch r.Reason {
+	case "", RevocationSignedInError, RevocationKeyCompromise, RevocationUnspecified:
+	default:
+		return errors.New("Request invalid. Reason must be signed_in_error, key_compromise or unspecified")
+	}
+
+	return nil
+}
+
+// RevokeSignatureResponse lists the revoked signatures.
+type RevokeSignatureResponse struct {
+	Revocations []SignatureRevocation `json:"revocations"`
+
+	// Version is the unsigned version restored when the owner
+	// revokes their signature, nil when a co-signer does.
+	Version *Version `json:"version,omitempty"`
+}
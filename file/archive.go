@@ -0,0 +1,126 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxArchiveSize is the total size of the files one archive can hold.
+const maxArchiveSize = 1 << 30
+
+var ErrArchiveTooLarge = errors.New("files exceed the size limit of an archive")
+
+// prepareArchive checks that the user can read every requested file,
+// owned or shared, and that they fit in an archive before anything
+// is written to the response.
+func (fs *fileService) prepareArchive(ctx context.Context, request ArchiveRequest) ([]File, error) {
+	files := make([]File, 0, len(request.FileIDs))
+	var size int64
+
+	for _, id := range request.FileIDs {
+		data, err := fs.fileRepository.Get(ctx, id)
+		if err != nil && err != pgx.ErrNoRows {
+			return nil, err
+		}
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("Requested file %v not found", id)
+		}
+
+		err = checkScanStatus(data)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", data.Filename, err)
+		}
+
+		if data.UserID != request.UserID {
+			_, err = fs.getFilePermission(ctx, request.UserID, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		size += data.Size
+		if size > maxArchiveSize {
+			return nil, fmt.Errorf("%w (%v bytes)", ErrArchiveTooLarge, maxArchiveSize)
+		}
+
+		files = append(files, data)
+	}
+
+	return files, nil
+}
+
+// writeArchive writes files as a ZIP archive to w. Files are
+// decrypted and written one at a time so that only the content of
+// one of them is held in memory, encrypted entries are compressed
+// and encrypted as they are written.
+func (fs *fileService) writeArchive(
+	ctx context.Context,
+	w io.Writer,
+	userID uint64,
+	files []File,
+	password string,
+) error {
+	zw := zip.NewWriter(w)
+	names := make(map[string]bool, len(files))
+
+	for _, data := range files {
+		res, err := fs.getFile(ctx, userID, data.ID)
+		if err != nil {
+			return err
+		}
+
+		fh := zip.FileHeader{
+			Name:     archiveName(names, data.Filename),
+			Method:   zip.Deflate,
+			Modified: data.CreatedAt,
+		}
+
+		if password != "" {
+			err = writeEncryptedEntry(zw, fh, bytes.NewReader(res.Content), password)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		fw, err := zw.CreateHeader(&fh)
+		if err != nil {
+			return err
+		}
+
+		_, err = fw.Write(res.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// archiveName returns a name for filename that is not taken in the
+// archive yet, "report (2).pdf" when "report.pdf" is already used.
+func archiveName(names map[string]bool, filename string) string {
+	filename = strings.NewReplacer("/", "_", "\\", "_").Replace(filename)
+	if filename == "" || filename == "." || filename == ".." {
+		filename = "file"
+	}
+
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	name := filename
+	for i := 2; names[name]; i++ {
+		name = fmt.Sprintf("%v (%v)%v", base, i, ext)
+	}
+	names[name] = true
+
+	return name
+}
@@ -0,0 +1,109 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestWriteEncryptedEntry(t *testing.T) {
+	content := bytes.Repeat([]byte("confidential report\n"), 100)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fh := zip.FileHeader{Name: "report.txt", Modified: time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)}
+	err := writeEncryptedEntry(zw, fh, bytes.NewReader(content), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 {
+		t.Fatalf("archive has %v entries, want 1", len(zr.File))
+	}
+
+	f := zr.File[0]
+	if f.Method != zipMethodAES || f.Flags&zipFlagEncrypted == 0 {
+		t.Fatalf("method = %v, flags = %#x, want an encrypted AES entry", f.Method, f.Flags)
+	}
+	if f.UncompressedSize64 != uint64(len(content)) {
+		t.Errorf("uncompressed size = %v, want %v", f.UncompressedSize64, len(content))
+	}
+
+	r, err := f.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := raw[:zipAESSaltSize]
+	verifier := raw[zipAESSaltSize : zipAESSaltSize+zipAESVerifySize]
+	data := raw[zipAESSaltSize+zipAESVerifySize : len(raw)-zipAESMACSize]
+	tag := raw[len(raw)-zipAESMACSize:]
+
+	keys := pbkdf2.Key([]byte("secret"), salt, zipAESIterations, 2*zipAESKeySize+zipAESVerifySize, sha1.New)
+	if !bytes.Equal(verifier, keys[2*zipAESKeySize:]) {
+		t.Fatal("password verifier does not match")
+	}
+
+	mac := hmac.New(sha1.New, keys[zipAESKeySize:2*zipAESKeySize])
+	mac.Write(data)
+	if !bytes.Equal(tag, mac.Sum(nil)[:zipAESMACSize]) {
+		t.Fatal("authentication code does not match")
+	}
+
+	block, err := aes.NewCipher(keys[:zipAESKeySize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	newWinZipCTR(block).XORKeyStream(data, data)
+
+	res, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, content) {
+		t.Error("decrypted content does not match")
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	names := make(map[string]bool)
+
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"report.pdf", "report (2).pdf"},
+		{"report.pdf", "report (3).pdf"},
+		{"../etc/passwd", ".._etc_passwd"},
+		{"", "file"},
+		{"notes", "notes"},
+		{"notes", "notes (2)"},
+	}
+
+	for _, tt := range tests {
+		if got := archiveName(names, tt.filename); got != tt.want {
+			t.Errorf("archiveName(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
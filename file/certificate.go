@@ -0,0 +1,43 @@
+package file
+
+import (
+	"context"
+	"crypto/x509"
+	"encryption/ca"
+	"encryption/guard/cms"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"time"
+)
+
+// checkCertificate builds the chain of the certificate of signer with
+// the certificates of its signature and returns its trust. Revoked
+// keys fail the verification whether or not the CA issued the
+// certificate. proven is true when a timestamp attests signTime.
+func (fs *fileService) checkCertificate(
+	ctx context.Context,
+	signer cms.SignerInfo,
+	certificates []*x509.Certificate,
+	signTime time.Time,
+	proven bool,
+) (string, error) {
+	err := fs.certificateAuthority.Check(ctx, signer.Certificate, certificates, signTime, proven)
+	if err == nil {
+		return CertificateTrusted, nil
+	}
+	if !errors.Is(err, ca.ErrUntrustedCertificate) {
+		return "", err
+	}
+
+	fingerprint, err := signingkey.Fingerprint(signer.Certificate.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	err = fs.certificateAuthority.CheckKey(ctx, fingerprint, signTime, proven)
+	if err != nil {
+		return "", err
+	}
+
+	return CertificateUntrusted, nil
+}
@@ -0,0 +1,14 @@
+package file
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+var ErrDamaged = errors.New("file is damaged and can not be read")
+
+// Checksum returns the checksum stored for an encrypted blob.
+func Checksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
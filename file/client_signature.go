@@ -0,0 +1,309 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encryption/guard/cms"
+	"encryption/pdf"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// clientSignatureAlgorithm is the algorithm clients
+// sign the prepared data of a signing session with.
+const clientSignatureAlgorithm = "RSASSA-PKCS1-v1_5-SHA256"
+
+// signingSessionTTL is how long a client has to sign
+// the data prepared by a signing session.
+const signingSessionTTL = 15 * time.Minute
+
+var (
+	ErrClientHeldKey          = errors.New("signing key is held by the client, the file must be signed with a signing session")
+	ErrNoClientKey            = errors.New("no client held signing key is registered")
+	ErrSigningSessionNotFound = errors.New("signing session not found")
+	ErrSigningSessionExpired  = errors.New("signing session expired, the file must be prepared again")
+	ErrSigningSessionStale    = errors.New("file or signing key changed since the signing session started")
+	ErrInvalidClientSignature = errors.New("signature does not match the prepared data and the signing key")
+)
+
+// SigningSession is the data prepared for a client to sign a version
+// of a file with a client held key, until it sends the signature.
+type SigningSession struct {
+	ID          uint64
+	FileID      uint64
+	UserID      uint64
+	Version     int
+	Format      string
+	Fingerprint string
+
+	// SignedData is the exact input of the signature,
+	// SignTime the signing time it holds.
+	SignedData []byte
+	SignTime   time.Time
+	ExpiresAt  time.Time
+}
+
+// signingInput is the input of a signature in a format,
+// along with what embedding the signature needs.
+type signingInput struct {
+	Metadata SignatureMetadata
+	Data     []byte
+	Chain    []*x509.Certificate
+	Prepared *pdf.Prepared
+}
+
+// signingKey returns the private key the server signs with for user.
+// Users who registered a client held key only sign with their client.
+func (fs *fileService) signingKey(ctx context.Context, user *user.User) (*rsa.PrivateKey, error) {
+	key, err := fs.userService.GetCurrentSigningKey(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil && key.ClientHeld {
+		return nil, ErrClientHeldKey
+	}
+
+	return fs.guard.ParsePrivateKey(user.PrivateKey)
+}
+
+// clientKey returns the client held key a user signs with.
+func (fs *fileService) clientKey(ctx context.Context, userID uint64) (*signingkey.SigningKey, *rsa.PublicKey, error) {
+	key, err := fs.userService.GetCurrentSigningKey(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key == nil || !key.ClientHeld {
+		return nil, nil, ErrNoClientKey
+	}
+
+	publicKey, err := fs.guard.ParsePublicKey(key.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, publicKey, nil
+}
+
+// clientSigningInput returns the input of a signature of content in
+// format by the client held key of user at signTime. Completing a
+// session builds it again, the data the client signed must be the
+// one of the content it is embedded in.
+func (fs *fileService) clientSigningInput(
+	ctx context.Context,
+	format string,
+	content []byte,
+	user *user.User,
+	key *signingkey.SigningKey,
+	publicKey *rsa.PublicKey,
+	signTime time.Time,
+) (signingInput, error) {
+	input := signingInput{
+		Metadata: SignatureMetadata{
+			SignDate:       signTime,
+			SignBy:         user.Username,
+			Contact:        user.Email,
+			Digest:         contentDigest(content),
+			KeyFingerprint: key.Fingerprint,
+		},
+	}
+
+	var err error
+
+	if format == SignatureFormatEmbedded {
+		input.Data, err = embeddedMetadata(content, user, key.Fingerprint, signTime)
+		return input, err
+	}
+
+	input.Chain, err = fs.certificateAuthority.Chain(ctx, user.ID, user.Username, user.Email, publicKey)
+	if err != nil {
+		return signingInput{}, err
+	}
+
+	if format == SignatureFormatPAdES {
+		input.Prepared, err = preparePDF(content, user, signTime)
+		if err != nil {
+			return signingInput{}, err
+		}
+
+		input.Data, err = pdfSignedAttributes(input.Prepared, input.Chain[0])
+		return input, err
+	}
+
+	digest := sha256.Sum256(content)
+	input.Data, err = cms.SignedAttributes(cms.OIDData, digest[:], input.Chain[0], signTime)
+
+	return input, err
+}
+
+// prepareSignature starts a signing session of the current version of
+// a file by the client held key of its owner, and returns the data the
+// client signs.
+func (fs *fileService) prepareSignature(ctx context.Context, request PrepareSignatureRequest) (*PrepareSignatureResponse, error) {
+	file, content, format, err := fs.signingTarget(ctx, request.UserID, request.FileID, request.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	key, publicKey, err := fs.clientKey(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := fs.userService.GetUserById(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// PDF dates and the session keep whole seconds
+	now := time.Now().UTC().Truncate(time.Second)
+
+	input, err := fs.clientSigningInput(ctx, format, content, user, key, publicKey, now)
+	if err != nil {
+		return nil, err
+	}
+
+	session := SigningSession{
+		FileID:      file.ID,
+		UserID:      request.UserID,
+		Version:     file.Version,
+		Format:      format,
+		Fingerprint: key.Fingerprint,
+		SignedData:  input.Data,
+		SignTime:    now,
+		ExpiresAt:   now.Add(signingSessionTTL),
+	}
+
+	session.ID, err = fs.fileRepository.CreateSigningSession(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(input.Data)
+
+	return &PrepareSignatureResponse{
+		SessionID:  session.ID,
+		Format:     format,
+		Metadata:   input.Metadata,
+		SignedData: input.Data,
+		Digest:     hex.EncodeToString(digest[:]),
+		Algorithm:  clientSignatureAlgorithm,
+		ExpiresAt:  session.ExpiresAt,
+	}, nil
+}
+
+// completeSignature verifies the signature a client made of the data
+// prepared by a signing session and embeds it in the file, or stores
+// it next to the file for detached signatures.
+func (fs *fileService) completeSignature(ctx context.Context, request CompleteSignatureRequest) error {
+	session, err := fs.fileRepository.GetSigningSession(ctx, request.SessionID)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+	if err == pgx.ErrNoRows || session.UserID != request.UserID || session.FileID != request.FileID {
+		return ErrSigningSessionNotFound
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return ErrSigningSessionExpired
+	}
+
+	file, content, format, err := fs.signingTarget(ctx, request.UserID, request.FileID, session.Format)
+	if err != nil {
+		return err
+	}
+
+	if file.Version != session.Version {
+		return ErrSigningSessionStale
+	}
+
+	key, publicKey, err := fs.clientKey(ctx, request.UserID)
+	if err != nil {
+		return err
+	}
+
+	if key.Fingerprint != session.Fingerprint {
+		return ErrSigningSessionStale
+	}
+
+	err = fs.guard.VerifyRSA(publicKey, request.Signature, session.SignedData)
+	if err != nil {
+		return ErrInvalidClientSignature
+	}
+
+	user, err := fs.userService.GetUserById(ctx, request.UserID)
+	if err != nil {
+		return err
+	}
+
+	input, err := fs.clientSigningInput(ctx, format, content, user, key, publicKey, session.SignTime)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(input.Data, session.SignedData) {
+		return ErrSigningSessionStale
+	}
+
+	// a session completes once
+	ok, err := fs.fileRepository.DeleteSigningSession(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSigningSessionNotFound
+	}
+
+	signed, err := fs.embedClientSignature(ctx, format, content, input, []byte(key.PublicKey), request.Signature)
+	if err != nil {
+		return err
+	}
+
+	if format == SignatureFormatDetached {
+		return fs.storeDetached(ctx, file, signed)
+	}
+
+	_, err = fs.storeSigned(ctx, file, signed)
+	return err
+}
+
+// embedClientSignature returns content signed with the signature a
+// client made of input in format, with a timestamp of the signature.
+// Detached signatures are returned alone.
+func (fs *fileService) embedClientSignature(
+	ctx context.Context,
+	format string,
+	content []byte,
+	input signingInput,
+	publicKey []byte,
+	signature []byte,
+) ([]byte, error) {
+	if format == SignatureFormatEmbedded {
+		token, err := fs.timestampAuthority.Timestamp(ctx, signature)
+		if err != nil {
+			return nil, err
+		}
+
+		return appendSignature(content, input.Data, signature, publicKey, token), nil
+	}
+
+	der, err := fs.signedData(ctx, input.Chain, input.Data, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == SignatureFormatDetached {
+		return der, nil
+	}
+
+	return input.Prepared.Embed(der)
+}
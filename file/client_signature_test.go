@@ -0,0 +1,97 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClientSignature(t *testing.T) {
+	ctx := context.Background()
+	privateKey, fingerprint := newSigningKey(t)
+	alice := &user.User{ID: 1, Username: "alice", Email: "alice@example.com"}
+	key := signingkey.SigningKey{
+		UserID:      alice.ID,
+		Fingerprint: fingerprint,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PUBLIC KEY",
+			Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+		})),
+		Current:    true,
+		ClientHeld: true,
+	}
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{"alice/" + fingerprint: key}}
+	authority := &fakeAuthority{chain: []*x509.Certificate{signerCertificate(t, alice, privateKey, time.Now())}}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority))
+
+	_, err := fs.signingKey(ctx, alice)
+	if !errors.Is(err, ErrClientHeldKey) {
+		t.Errorf("signingKey() error = %v, want %v", err, ErrClientHeldKey)
+	}
+
+	pdfContent, err := os.ReadFile("../guard/test_files/gnu-c-manual.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for format, content := range map[string][]byte{
+		SignatureFormatEmbedded: []byte("contract"),
+		SignatureFormatDetached: []byte("\x89PNG\r\n\x1a\nnot a real image"),
+		SignatureFormatPAdES:    pdfContent,
+	} {
+		t.Run(format, func(t *testing.T) {
+			signTime := time.Now().UTC().Truncate(time.Second)
+
+			input, err := fs.clientSigningInput(ctx, format, content, alice, &key, &privateKey.PublicKey, signTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// completing the session prepares the same data
+			again, err := fs.clientSigningInput(ctx, format, content, alice, &key, &privateKey.PublicKey, signTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(input.Data, again.Data) {
+				t.Fatal("prepared data differs for the same content and time")
+			}
+
+			// the client signs with its own key
+			digest := sha256.Sum256(input.Data)
+			signature, err := rsa.SignPKCS1v15(nil, privateKey, crypto.SHA256, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			signed, err := fs.embedClientSignature(ctx, format, content, input, []byte(key.PublicKey), signature)
+			if err != nil {
+				t.Fatalf("embedClientSignature() error = %v", err)
+			}
+
+			var res *VerifyResult
+			if format == SignatureFormatDetached {
+				res, err = fs.verifyFile(ctx, content, signed)
+			} else {
+				res, err = fs.verifyFile(ctx, signed, nil)
+			}
+			if err != nil {
+				t.Fatalf("verifyFile() error = %v", err)
+			}
+
+			if res.Format != format || res.SignBy != "alice" || res.KeyFingerprint != fingerprint ||
+				res.Signer != SignerCurrentKey || res.Timestamp == nil {
+				t.Errorf("verifyFile() = %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedContent = errors.New("file content is not allowed for this file type")
+	ErrFileTooLarge       = errors.New("file exceeds the size limit for this file type")
+)
+
+// Content types detected by inspecting the file content.
+const (
+	JPEG string = "image/jpeg"
+	PNG  string = "image/png"
+	WebP string = "image/webp"
+	PDF  string = "application/pdf"
+	MP4  string = "video/mp4"
+	WebM string = "video/webm"
+	DOCX string = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	ODT  string = "application/vnd.oasis.opendocument.text"
+
+	Unknown string = "application/octet-stream"
+)
+
+// allowedContentTypes lists the content types accepted for
+// each file type. A nil list accepts any content.
+var allowedContentTypes = map[string][]string{
+	IDCard:         {JPEG, PNG, PDF},
+	ProfilePicture: {JPEG, PNG, WebP},
+	Video:          {MP4, WebM},
+	Docs:           {PDF, DOCX, ODT},
+	Misc:           nil,
+}
+
+// defaultSizeLimits are the maximum file sizes in bytes
+// for each file type.
+var defaultSizeLimits = map[string]int64{
+	IDCard:         5 << 20,
+	ProfilePicture: 5 << 20,
+	Video:          200 << 20,
+	Docs:           20 << 20,
+	Misc:           20 << 20,
+}
+
+// SizeLimitsFromEnv returns the default size limits overridden
+// by the FILE_SIZE_LIMIT_<TYPE> environment variables, in bytes.
+func SizeLimitsFromEnv() map[string]int64 {
+	limits := make(map[string]int64, len(defaultSizeLimits))
+
+	for fileType, limit := range defaultSizeLimits {
+		limits[fileType] = limit
+
+		value := os.Getenv("FILE_SIZE_LIMIT_" + strings.ToUpper(fileType))
+		if value == "" {
+			continue
+		}
+
+		envLimit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || envLimit <= 0 {
+			fmt.Printf("invalid size limit for %v: %v\n", fileType, value)
+			continue
+		}
+
+		limits[fileType] = envLimit
+	}
+
+	return limits
+}
+
+// ContentValidator checks uploaded file contents
+// against the allowlist and size limit of their type.
+type ContentValidator struct {
+	sizeLimits map[string]int64
+}
+
+func NewContentValidator(sizeLimits map[string]int64) *ContentValidator {
+	return &ContentValidator{
+		sizeLimits: sizeLimits,
+	}
+}
+
+// CheckSize returns ErrFileTooLarge if size exceeds
+// the limit of fileType.
+func (cv *ContentValidator) CheckSize(fileType string, size int64) error {
+	limit, ok := cv.sizeLimits[fileType]
+	if ok && size > limit {
+		return fmt.Errorf("%w (%v bytes)", ErrFileTooLarge, limit)
+	}
+
+	return nil
+}
+
+// Validate checks the size and the content of a file and
+// returns the detected content type.
+func (cv *ContentValidator) Validate(fileType string, content []byte) (string, error) {
+	err := cv.CheckSize(fileType, int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+
+	contentType := DetectContentType(content)
+
+	allowed, ok := allowedContentTypes[fileType]
+	if !ok {
+		return "", errors.New("invalid type")
+	}
+
+	if allowed != nil && !slices.Contains(allowed, contentType) {
+		return "", fmt.Errorf("%w (%v)", ErrUnsupportedContent, strings.Join(allowed, ", "))
+	}
+
+	return contentType, nil
+}
+
+// DetectContentType detects the content type from the magic bytes
+// and the structure of the content. Unknown is returned when the
+// content is not one of the known types or is malformed.
+func DetectContentType(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xFF, 0xD8, 0xFF}):
+		if isImage(content, "jpeg") {
+			return JPEG
+		}
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		if isImage(content, "png") {
+			return PNG
+		}
+	case bytes.HasPrefix(content, []byte("RIFF")):
+		if isWebP(content) {
+			return WebP
+		}
+	case bytes.HasPrefix(content, []byte("%PDF-")):
+		if isPDF(content) {
+			return PDF
+		}
+	case bytes.HasPrefix(content, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if isWebM(content) {
+			return WebM
+		}
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		return detectZipDocument(content)
+	case len(content) >= 8 && string(content[4:8]) == "ftyp":
+		if isMP4(content) {
+			return MP4
+		}
+	}
+
+	return Unknown
+}
+
+// isImage checks that the image header can be decoded.
+func isImage(content []byte, format string) bool {
+	config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return false
+	}
+
+	return decodedFormat == format &&
+		config.Width > 0 &&
+		config.Height > 0
+}
+
+// isWebP checks the RIFF container header and the first chunk.
+func isWebP(content []byte) bool {
+	if len(content) < 20 || string(content[8:12]) != "WEBP" {
+		return false
+	}
+
+	riffSize := binary.LittleEndian.Uint32(content[4:8])
+	if uint64(riffSize)+8 > uint64(len(content)) {
+		return false
+	}
+
+	switch string(content[12:16]) {
+	case "VP8 ", "VP8L", "VP8X":
+		return true
+	}
+
+	return false
+}
+
+// isPDF checks that the document has an end of file marker
+// near the end of the content.
+func isPDF(content []byte) bool {
+	tail := content
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+
+	return bytes.Contains(tail, []byte("%%EOF"))
+}
+
+// isWebM checks that the EBML header declares the webm doctype.
+func isWebM(content []byte) bool {
+	header := content
+	if len(header) > 64 {
+		header = header[:64]
+	}
+
+	// DocType element (0x4282) with a size of 4 bytes
+	return bytes.Contains(header, []byte("\x42\x82\x84webm"))
+}
+
+// isMP4 walks the top level boxes and checks that
+// they are well formed and include a movie box.
+func isMP4(content []byte) bool {
+	hasMovie := false
+
+	offset := uint64(0)
+	length := uint64(len(content))
+
+	for offset+8 <= length {
+		size := uint64(binary.BigEndian.Uint32(content[offset : offset+4]))
+		boxType := string(content[offset+4 : offset+8])
+
+		switch size {
+		// box extends to the end of the file
+		case 0:
+			size = length - offset
+		// 64-bit box size
+		case 1:
+			if offset+16 > length {
+				return false
+			}
+			size = binary.BigEndian.Uint64(content[offset+8 : offset+16])
+		}
+
+		if size < 8 || size > length-offset {
+			return false
+		}
+
+		if boxType == "moov" {
+			hasMovie = true
+		}
+
+		offset += size
+	}
+
+	return hasMovie
+}
+
+// detectZipDocument detects the office document type
+// of a zip container.
+func detectZipDocument(content []byte) string {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return Unknown
+	}
+
+	// OpenDocument requires an uncompressed mimetype
+	// file as the first entry.
+	if len(reader.File) > 0 && reader.File[0].Name == "mimetype" {
+		f, err := reader.File[0].Open()
+		if err != nil {
+			return Unknown
+		}
+		defer f.Close()
+
+		mimetype, err := io.ReadAll(io.LimitReader(f, 128))
+		if err != nil {
+			return Unknown
+		}
+
+		if string(mimetype) == ODT {
+			return ODT
+		}
+
+		return Unknown
+	}
+
+	hasContentTypes, hasDocument := false, false
+	for _, f := range reader.File {
+		switch f.Name {
+		case "[Content_Types].xml":
+			hasContentTypes = true
+		case "word/document.xml":
+			hasDocument = true
+		}
+	}
+
+	if hasContentTypes && hasDocument {
+		return DOCX
+	}
+
+	return Unknown
+}
@@ -0,0 +1,122 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"os"
+	"testing"
+)
+
+func jpegSample(t *testing.T) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func zipSample(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: files[i], Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[i+1]))
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func mp4Sample() []byte {
+	box := func(boxType string, payload []byte) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+		copy(b[4:], boxType)
+		return append(b, payload...)
+	}
+
+	var content []byte
+	content = append(content, box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2"))...)
+	content = append(content, box("moov", make([]byte, 16))...)
+	content = append(content, box("mdat", make([]byte, 32))...)
+
+	return content
+}
+
+func TestDetectContentType(t *testing.T) {
+	png, err := os.ReadFile("../guard/test_files/tux.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdf, err := os.ReadFile("../guard/test_files/gnu-c-manual.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"jpeg", jpegSample(t), JPEG},
+		{"png", png, PNG},
+		{"truncated png", png[:12], Unknown},
+		{"pdf", pdf, PDF},
+		{"pdf without eof", pdf[:2048], Unknown},
+		{"webp", []byte("RIFF\x0c\x00\x00\x00WEBPVP8 \x00\x00\x00\x00"), WebP},
+		{"webm", []byte("\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm"), WebM},
+		{"mp4", mp4Sample(), MP4},
+		{"mp4 without movie", mp4Sample()[:24], Unknown},
+		{"docx", zipSample(t, "[Content_Types].xml", "<Types/>", "word/document.xml", "<w:document/>"), DOCX},
+		{"odt", zipSample(t, "mimetype", ODT, "content.xml", "<office:document-content/>"), ODT},
+		{"plain zip", zipSample(t, "a.txt", "a"), Unknown},
+		{"elf", []byte("\x7fELF\x02\x01\x01\x00"), Unknown},
+		{"text", []byte("hello world"), Unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectContentType(tt.content)
+			if got != tt.want {
+				t.Errorf("DetectContentType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentValidatorValidate(t *testing.T) {
+	cv := NewContentValidator(map[string]int64{
+		IDCard: 1 << 10,
+		Misc:   1 << 10,
+	})
+
+	_, err := cv.Validate(IDCard, jpegSample(t))
+	if err != nil {
+		t.Errorf("jpeg id card rejected: %v", err)
+	}
+
+	_, err = cv.Validate(IDCard, []byte("\x7fELF\x02\x01\x01\x00"))
+	if !errors.Is(err, ErrUnsupportedContent) {
+		t.Errorf("executable id card error = %v, want %v", err, ErrUnsupportedContent)
+	}
+
+	_, err = cv.Validate(Misc, []byte("\x7fELF\x02\x01\x01\x00"))
+	if err != nil {
+		t.Errorf("misc file rejected: %v", err)
+	}
+
+	_, err = cv.Validate(Misc, make([]byte, 2<<10))
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("oversized file error = %v, want %v", err, ErrFileTooLarge)
+	}
+}
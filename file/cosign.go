@@ -0,0 +1,631 @@
+package file
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encryption/guard/cms"
+	"encryption/pdf"
+	"encryption/user"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Statuses of a signing request.
+//
+// - pending : signatures are being collected.
+// - completed : every co-signer signed.
+// - declined : a co-signer declined to sign.
+// - cancelled : the owner cancelled the request.
+const (
+	SigningPending   string = "pending"
+	SigningCompleted string = "completed"
+	SigningDeclined  string = "declined"
+	SigningCancelled string = "cancelled"
+)
+
+// Statuses of a co-signer.
+//
+// - pending : the co-signer did not respond yet.
+// - signed : the co-signer signed the file.
+// - declined : the co-signer declined to sign.
+const (
+	CoSignerPending  string = "pending"
+	CoSignerSigned   string = "signed"
+	CoSignerDeclined string = "declined"
+)
+
+// signingLease is how long a co-signer holds the lock of a request,
+// a signer failing to release it only blocks the others that long.
+const signingLease = 5 * time.Minute
+
+var (
+	ErrSigningRequestPending = errors.New("file already has a pending signing request")
+	ErrSigningRequestStale   = errors.New("file changed since the signing request was made, the request must be made again")
+	ErrSigningInProgress     = errors.New("another co-signer is signing the file, try again later")
+	ErrNotCoSigner           = errors.New("you are not a co-signer of this signing request")
+	ErrNotYourTurn           = errors.New("co-signers before you did not sign yet")
+	ErrCoSignerResponded     = errors.New("you already responded to this signing request")
+	ErrEmbeddedCoSign        = errors.New("files with an embedded signature can not be co-signed")
+	ErrSigningRequestEnded   = errors.New("signing request ended meanwhile")
+	ErrClientHeldCoSigner    = errors.New("users signing with a client held key can not co-sign")
+)
+
+// SigningRequest collects the signatures of co-signers invited by
+// the owner of a file, one after the other when Ordered or else in
+// any order. Each signature covers the content of the file and the
+// signatures made before it.
+type SigningRequest struct {
+	ID       uint64 `json:"id"`
+	FileID   uint64 `json:"file_id"`
+	Filename string `json:"filename"`
+
+	// UserID is the owner of the file.
+	UserID uint64 `json:"user_id"`
+
+	// Version is the version of the file the
+	// next signature is made on.
+	Version int `json:"version"`
+
+	Ordered     bool       `json:"ordered"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	Signers []CoSigner `json:"signers"`
+}
+
+// CoSigner is a user invited to sign by a signing request.
+type CoSigner struct {
+	UserID   uint64 `json:"user_id"`
+	Username string `json:"username"`
+
+	// Position is the signing order of ordered requests.
+	Position int    `json:"position"`
+	Status   string `json:"status"`
+
+	// NotifiedAt is the time the co-signer was asked to sign,
+	// nil while co-signers before it did not sign.
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	SignedAt   *time.Time `json:"signed_at,omitempty"`
+}
+
+// signer returns the co-signer of r who is the user, nil if none.
+func (r *SigningRequest) signer(userID uint64) *CoSigner {
+	for i := range r.Signers {
+		if r.Signers[i].UserID == userID {
+			return &r.Signers[i]
+		}
+	}
+
+	return nil
+}
+
+// notify asks the co-signers whose turn it is to sign, every pending
+// co-signer of parallel requests or the first one of ordered requests.
+func (r *SigningRequest) notify(now time.Time) {
+	for i := range r.Signers {
+		s := &r.Signers[i]
+		if s.Status != CoSignerPending {
+			continue
+		}
+
+		if s.NotifiedAt == nil {
+			s.NotifiedAt = &now
+		}
+
+		if r.Ordered {
+			return
+		}
+	}
+}
+
+// respondent returns the co-signer of r who is the user if
+// r awaits its response.
+func (r *SigningRequest) respondent(userID uint64) (*CoSigner, error) {
+	if r.Status != SigningPending {
+		return nil, fmt.Errorf("signing request is %v", r.Status)
+	}
+
+	s := r.signer(userID)
+	if s == nil {
+		return nil, ErrNotCoSigner
+	}
+
+	if s.Status != CoSignerPending {
+		return nil, ErrCoSignerResponded
+	}
+
+	return s, nil
+}
+
+// sign records the signature of the user, made on the current
+// version of the file, and asks the next co-signers to sign. version
+// is the version the signature left the file at. The request
+// completes with the last signature.
+func (r *SigningRequest) sign(userID uint64, version int, now time.Time) error {
+	s, err := r.respondent(userID)
+	if err != nil {
+		return err
+	}
+
+	if s.NotifiedAt == nil {
+		return ErrNotYourTurn
+	}
+
+	s.Status = CoSignerSigned
+	s.SignedAt = &now
+	r.Version = version
+
+	for _, s := range r.Signers {
+		if s.Status != CoSignerSigned {
+			r.notify(now)
+			return nil
+		}
+	}
+
+	r.Status = SigningCompleted
+	r.CompletedAt = &now
+
+	return nil
+}
+
+// decline records that the user declined to sign, which ends the request.
+func (r *SigningRequest) decline(userID uint64, now time.Time) error {
+	s, err := r.respondent(userID)
+	if err != nil {
+		return err
+	}
+
+	s.Status = CoSignerDeclined
+	r.Status = SigningDeclined
+	r.CompletedAt = &now
+
+	return nil
+}
+
+// requestSignatures invites co-signers holding a permission to a file
+// of the owner to sign its current version. The owner may invite
+// itself to sign along.
+func (fs *fileService) requestSignatures(ctx context.Context, request CreateSigningRequest) (*SigningRequest, error) {
+	file, err := fs.getOwnedFile(ctx, request.UserID, request.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkScanStatus(file)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := fs.fileRepository.GetSigningRequest(ctx, file.ID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && current.Status == SigningPending {
+		return nil, ErrSigningRequestPending
+	}
+
+	version, err := fs.fileRepository.GetVersion(ctx, file.ID, file.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fs.readVersion(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cosignFormat(file, version, content)
+	if err != nil {
+		return nil, err
+	}
+
+	signingRequest := SigningRequest{
+		FileID:   file.ID,
+		Filename: file.Filename,
+		UserID:   file.UserID,
+		Version:  file.Version,
+		Ordered:  request.Ordered,
+		Status:   SigningPending,
+	}
+
+	for i, username := range request.Signers {
+		signer, err := fs.inviteSigner(ctx, file, username, i)
+		if err != nil {
+			return nil, err
+		}
+
+		signingRequest.Signers = append(signingRequest.Signers, signer)
+	}
+
+	now := time.Now()
+	signingRequest.CreatedAt = now
+	signingRequest.notify(now)
+
+	signingRequest.ID, err = fs.fileRepository.CreateSigningRequest(ctx, signingRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingRequest, nil
+}
+
+// inviteSigner returns the user username as the co-signer of file
+// at position. Co-signatures are made by the server, users holding
+// their signing key in their client can not be invited.
+func (fs *fileService) inviteSigner(ctx context.Context, file File, username string, position int) (CoSigner, error) {
+	signer, err := fs.userService.GetUserByUsername(ctx, username)
+	if err != nil {
+		return CoSigner{}, err
+	}
+
+	if signer.ID != file.UserID {
+		_, err = fs.filePermissionRepository.GetByUserFilePermission(ctx, signer.ID, file.UserID, file.ID)
+		if err != nil && err != pgx.ErrNoRows {
+			return CoSigner{}, err
+		}
+		if err == pgx.ErrNoRows {
+			return CoSigner{}, fmt.Errorf("%v does not have a permission to the file", username)
+		}
+	}
+
+	key, err := fs.userService.GetCurrentSigningKey(ctx, signer.ID)
+	if err != nil {
+		return CoSigner{}, err
+	}
+	if key != nil && key.ClientHeld {
+		return CoSigner{}, fmt.Errorf("%v: %w", username, ErrClientHeldCoSigner)
+	}
+
+	return CoSigner{
+		UserID:   signer.ID,
+		Username: signer.Username,
+		Position: position,
+		Status:   CoSignerPending,
+	}, nil
+}
+
+// getSigningRequest returns the latest signing request of a file
+// to its owner or to its co-signers.
+func (fs *fileService) getSigningRequest(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error) {
+	signingRequest, err := fs.fileRepository.GetSigningRequest(ctx, fileID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, errors.New("Requested signing request not found")
+	}
+
+	if signingRequest.UserID != userID && signingRequest.signer(userID) == nil {
+		return nil, errors.New("You do not have access to this resource data")
+	}
+
+	return &signingRequest, nil
+}
+
+// listSigningRequests lists the signing requests awaiting the
+// signature of the user.
+func (fs *fileService) listSigningRequests(ctx context.Context, userID uint64) ([]SigningRequest, error) {
+	return fs.fileRepository.ListAwaitingSignature(ctx, userID)
+}
+
+// cosignFile signs a file for the signing request awaiting the
+// signature of the user. PDF documents get one more PAdES signature,
+// other files a countersignature of their latest detached signature.
+func (fs *fileService) cosignFile(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error) {
+	signingRequest, err := fs.getSigningRequest(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = signingRequest.respondent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	locked, err := fs.fileRepository.LockSigningRequest(ctx, signingRequest.ID, now, now.Add(-signingLease))
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, ErrSigningInProgress
+	}
+
+	res, err := fs.cosignLocked(ctx, userID, fileID, now)
+	if err != nil {
+		unlockErr := fs.fileRepository.UnlockSigningRequest(ctx, signingRequest.ID)
+		if unlockErr != nil {
+			fmt.Println("unlock signing request", unlockErr)
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// cosignLocked signs a file for its signing request, whose lock is held.
+func (fs *fileService) cosignLocked(ctx context.Context, userID uint64, fileID uint64, now time.Time) (*SigningRequest, error) {
+	// the request may have changed before it was locked
+	signingRequest, err := fs.getSigningRequest(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := signingRequest.respondent(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.NotifiedAt == nil {
+		return nil, ErrNotYourTurn
+	}
+
+	file, err := fs.fileRepository.Get(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkScanStatus(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.UserID != userID {
+		_, err = fs.getFilePermission(ctx, userID, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if file.Version != signingRequest.Version {
+		return nil, ErrSigningRequestStale
+	}
+
+	version, err := fs.fileRepository.GetVersion(ctx, file.ID, file.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := fs.userService.GetUserWithRSA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	signedVersion, err := fs.cosign(ctx, file, version, user)
+	if err != nil {
+		return nil, err
+	}
+
+	err = signingRequest.sign(userID, signedVersion, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.updateSigningRequest(ctx, *signingRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingRequest, nil
+}
+
+// cosign adds the signature of user to version, the current version
+// of file, and returns the version holding the signatures.
+func (fs *fileService) cosign(ctx context.Context, file File, version Version, user *user.User) (int, error) {
+	content, err := fs.readVersion(ctx, version)
+	if err != nil {
+		return 0, err
+	}
+
+	format, err := cosignFormat(file, version, content)
+	if err != nil {
+		return 0, err
+	}
+
+	// a co-signer registering a client held key once
+	// invited can only decline
+	privateKey, err := fs.signingKey(ctx, user)
+	if errors.Is(err, ErrClientHeldKey) {
+		return 0, fmt.Errorf("%w, the signing request must be declined", ErrClientHeldCoSigner)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if format == SignatureFormatPAdES {
+		signed, err := fs.signPDF(ctx, content, user, privateKey)
+		if err != nil {
+			return 0, err
+		}
+
+		return fs.storeSigned(ctx, file, signed)
+	}
+
+	if version.SignaturePath == "" {
+		err = fs.signDetached(ctx, file, user, privateKey, content)
+	} else {
+		err = fs.counterSignDetached(ctx, file, version, user, privateKey)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return version.Version, nil
+}
+
+// cosignFormat returns the format co-signatures of version are made
+// in, the one of its signatures. Appending a signature block to an
+// embedded signature would leave the first one uncovered.
+func cosignFormat(file File, version Version, content []byte) (string, error) {
+	if version.SignaturePath != "" {
+		return SignatureFormatDetached, nil
+	}
+
+	if file.Type == Docs && DetectContentType(content) == PDF {
+		if !version.IsSigned || len(pdf.Signatures(content)) > 0 {
+			return SignatureFormatPAdES, nil
+		}
+	} else if !version.IsSigned {
+		return SignatureFormatDetached, nil
+	}
+
+	return "", ErrEmbeddedCoSign
+}
+
+// counterSignDetached countersigns the latest signature of the
+// detached signature of version.
+func (fs *fileService) counterSignDetached(ctx context.Context, file File, version Version, user *user.User, privateKey *rsa.PrivateKey) error {
+	signature, err := fs.readSignature(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	sd, err := cms.Parse(signature)
+	if err != nil {
+		return err
+	}
+
+	latest := sd.Signers[0]
+	for {
+		counter, ok, err := latest.CounterSignature(sd.Certificates)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		latest = counter
+	}
+
+	chain, err := fs.certificateAuthority.Chain(ctx, user.ID, user.Username, user.Email, &privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	counter, err := latest.CounterSign(privateKey, chain[0], time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = fs.timestampSigner(ctx, &counter)
+	if err != nil {
+		return err
+	}
+
+	err = appendCounterSignature(&sd.Signers[0], sd.Certificates, counter)
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range chain {
+		if !containsCertificate(sd.Certificates, cert) {
+			sd.Certificates = append(sd.Certificates, cert)
+		}
+	}
+
+	signature, err = sd.Marshal()
+	if err != nil {
+		return err
+	}
+
+	signaturePath, err := fs.writeSignature(ctx, version, signature)
+	if err != nil {
+		return err
+	}
+
+	return fs.fileRepository.SetSignature(ctx, file.ID, version.Version, signaturePath)
+}
+
+// appendCounterSignature attaches counter to the latest signature of
+// the chain of countersignatures starting at signer.
+func appendCounterSignature(signer *cms.SignerInfo, certs []*x509.Certificate, counter cms.SignerInfo) error {
+	next, ok, err := signer.CounterSignature(certs)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return signer.SetCounterSignature(counter)
+	}
+
+	err = appendCounterSignature(&next, certs, counter)
+	if err != nil {
+		return err
+	}
+
+	return signer.SetCounterSignature(next)
+}
+
+// updateSigningRequest stores the status of a pending signing request.
+func (fs *fileService) updateSigningRequest(ctx context.Context, signingRequest SigningRequest) error {
+	err := fs.fileRepository.UpdateSigningRequest(ctx, signingRequest)
+	if err == pgx.ErrNoRows {
+		return ErrSigningRequestEnded
+	}
+
+	return err
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// declineSigning records that the user declined to sign a file,
+// which ends its signing request.
+func (fs *fileService) declineSigning(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error) {
+	signingRequest, err := fs.getSigningRequest(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = signingRequest.decline(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.updateSigningRequest(ctx, *signingRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingRequest, nil
+}
+
+// cancelSigning cancels the pending signing request of a file of
+// the owner, the signatures already made are kept.
+func (fs *fileService) cancelSigning(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error) {
+	signingRequest, err := fs.getSigningRequest(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if signingRequest.UserID != userID {
+		return nil, errors.New("You do not have access to this resource data")
+	}
+
+	if signingRequest.Status != SigningPending {
+		return nil, fmt.Errorf("signing request is %v", signingRequest.Status)
+	}
+
+	now := time.Now()
+	signingRequest.Status = SigningCancelled
+	signingRequest.CompletedAt = &now
+
+	err = fs.updateSigningRequest(ctx, *signingRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return signingRequest, nil
+}
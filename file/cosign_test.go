@@ -0,0 +1,238 @@
+package file
+
+import (
+	"context"
+	"crypto/x509"
+	"encryption/guard/cms"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSigningRequestTurns(t *testing.T) {
+	now := time.Now()
+
+	newRequest := func(ordered bool) *SigningRequest {
+		r := &SigningRequest{Version: 1, Ordered: ordered, Status: SigningPending}
+		for i, id := range []uint64{2, 3, 4} {
+			r.Signers = append(r.Signers, CoSigner{UserID: id, Position: i, Status: CoSignerPending})
+		}
+		r.notify(now)
+		return r
+	}
+
+	ordered := newRequest(true)
+	if ordered.Signers[0].NotifiedAt == nil || ordered.Signers[1].NotifiedAt != nil {
+		t.Fatal("ordered request did not notify the first signer only")
+	}
+
+	if err := ordered.sign(3, 2, now); !errors.Is(err, ErrNotYourTurn) {
+		t.Errorf("out of order sign() error = %v, want %v", err, ErrNotYourTurn)
+	}
+
+	if err := ordered.sign(5, 2, now); !errors.Is(err, ErrNotCoSigner) {
+		t.Errorf("stranger sign() error = %v, want %v", err, ErrNotCoSigner)
+	}
+
+	for i, id := range []uint64{2, 3, 4} {
+		if err := ordered.sign(id, i+2, now); err != nil {
+			t.Fatalf("sign(%v) error = %v", id, err)
+		}
+
+		if i < 2 && ordered.Signers[i+1].NotifiedAt == nil {
+			t.Errorf("signer %v was not notified after %v signed", i+1, id)
+		}
+	}
+
+	if ordered.Status != SigningCompleted || ordered.CompletedAt == nil || ordered.Version != 4 {
+		t.Errorf("request = %v at version %v, want %v at version 4", ordered.Status, ordered.Version, SigningCompleted)
+	}
+
+	if err := ordered.sign(2, 5, now); err == nil {
+		t.Error("completed request accepted a signature")
+	}
+
+	parallel := newRequest(false)
+	for _, s := range parallel.Signers {
+		if s.NotifiedAt == nil {
+			t.Fatal("parallel request did not notify every signer")
+		}
+	}
+
+	if err := parallel.sign(4, 2, now); err != nil {
+		t.Fatalf("parallel sign() error = %v", err)
+	}
+
+	if err := parallel.sign(4, 3, now); !errors.Is(err, ErrCoSignerResponded) {
+		t.Errorf("second sign() error = %v, want %v", err, ErrCoSignerResponded)
+	}
+
+	if err := parallel.decline(3, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if parallel.Status != SigningDeclined {
+		t.Errorf("declined request status = %v", parallel.Status)
+	}
+}
+
+func TestVerifyFileCoSigned(t *testing.T) {
+	ctx := context.Background()
+	aliceKey, aliceFingerprint := newSigningKey(t)
+	bobKey, bobFingerprint := newSigningKey(t)
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + aliceFingerprint: {Fingerprint: aliceFingerprint, Current: true},
+		"bob/" + bobFingerprint:     {Fingerprint: bobFingerprint, Current: true},
+	}}
+	alice := &user.User{Username: "alice", Email: "alice@example.com"}
+	bob := &user.User{Username: "bob", Email: "bob@example.com"}
+	aliceCert := signerCertificate(t, alice, aliceKey, time.Now())
+	bobCert := signerCertificate(t, bob, bobKey, time.Now())
+
+	authority := &fakeAuthority{}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority))
+
+	t.Run("detached", func(t *testing.T) {
+		content := []byte("\x89PNG\r\n\x1a\nnot a real image")
+
+		signature, err := cms.SignDetached(content, aliceKey, []*x509.Certificate{aliceCert}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sd, err := cms.Parse(signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counter, err := sd.Signers[0].CounterSign(bobKey, bobCert, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = fs.timestampSigner(ctx, &counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = appendCounterSignature(&sd.Signers[0], sd.Certificates, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd.Certificates = append(sd.Certificates, bobCert)
+
+		cosigned, err := sd.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := fs.verifyFile(ctx, content, cosigned)
+		if err != nil {
+			t.Fatalf("verifyFile() error = %v", err)
+		}
+
+		if res.SignBy != "bob" || res.Timestamp == nil || len(res.Signatures) != 2 || res.Signatures[0].SignBy != "alice" {
+			t.Errorf("verifyFile() = %+v", res)
+		}
+
+		if res.Digest != res.Signatures[0].Digest || res.Digest != contentDigest(content) {
+			t.Errorf("countersignature digest = %v, want the content digest %v", res.Digest, contentDigest(content))
+		}
+
+		// the countersignature does not hold for another signature
+		other, err := cms.SignDetached(content, aliceKey, []*x509.Certificate{aliceCert}, time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherSD, err := cms.Parse(other)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = otherSD.Signers[0].SetCounterSignature(counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherSD.Certificates = append(otherSD.Certificates, bobCert)
+
+		moved, err := otherSD.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = fs.verifyFile(ctx, content, moved)
+		if !errors.Is(err, cms.ErrDigestMismatch) {
+			t.Errorf("moved countersignature error = %v, want %v", err, cms.ErrDigestMismatch)
+		}
+	})
+
+	t.Run("pades", func(t *testing.T) {
+		content, err := os.ReadFile("../guard/test_files/gnu-c-manual.pdf")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authority.chain = []*x509.Certificate{aliceCert}
+		signed, err := fs.signPDF(ctx, content, alice, aliceKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		authority.chain = []*x509.Certificate{bobCert}
+		cosigned, err := fs.signPDF(ctx, signed, bob, bobKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := fs.verifyFile(ctx, cosigned, nil)
+		if err != nil {
+			t.Fatalf("verifyFile() error = %v", err)
+		}
+
+		if res.SignBy != "bob" || len(res.Signatures) != 2 || res.Signatures[0].SignBy != "alice" || res.Signatures[1].Timestamp == nil {
+			t.Errorf("verifyFile() = %+v", res)
+		}
+
+		// the second signature covers the first one
+		tampered := append([]byte{}, cosigned...)
+		tampered[len(signed)-len("%%EOF\n")-pdfSignatureSize] ^= 0xff
+		_, err = fs.verifyFile(ctx, tampered, nil)
+		if err == nil {
+			t.Error("tampered first signature was accepted")
+		}
+	})
+}
+
+func TestInviteClientHeldSigner(t *testing.T) {
+	ctx := context.Background()
+	users := &fakeUsers{
+		keys: map[string]signingkey.SigningKey{
+			"alice/a": {UserID: 1, Fingerprint: "a", Current: true, ClientHeld: true},
+			"bob/b":   {UserID: 2, Fingerprint: "b", Current: true},
+		},
+		users: map[uint64]*user.User{
+			1: {ID: 1, Username: "alice"},
+			2: {ID: 2, Username: "bob"},
+		},
+	}
+	fs := newTestFileService(t, withUsers(users))
+
+	// co-signatures are made by the server, which
+	// does not hold the key of alice
+	_, err := fs.inviteSigner(ctx, File{ID: 1, UserID: 1}, "alice", 0)
+	if !errors.Is(err, ErrClientHeldCoSigner) {
+		t.Errorf("inviteSigner(alice) error = %v, want %v", err, ErrClientHeldCoSigner)
+	}
+
+	signer, err := fs.inviteSigner(ctx, File{ID: 2, UserID: 2}, "bob", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.UserID != 2 || signer.Position != 1 || signer.Status != CoSignerPending {
+		t.Errorf("inviteSigner(bob) = %+v", signer)
+	}
+}
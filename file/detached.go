@@ -0,0 +1,214 @@
+package file
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/pem"
+	"encryption/guard/cms"
+	"encryption/user"
+	"time"
+)
+
+// signatureExtension is appended to the blob path of
+// a version to store its detached signature.
+const signatureExtension = ".p7s"
+
+// signDetached stores a detached CMS signature of content, the current
+// version of file, next to its blob. The content is left untouched so
+// files of any type stay readable once signed.
+func (fs *fileService) signDetached(ctx context.Context, file File, user *user.User, privateKey *rsa.PrivateKey, content []byte) error {
+	chain, err := fs.certificateAuthority.Chain(ctx, user.ID, user.Username, user.Email, &privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	signature, err := cms.SignDetached(content, privateKey, chain, time.Now())
+	if err != nil {
+		return err
+	}
+
+	signature, err = fs.timestampDetached(ctx, signature)
+	if err != nil {
+		return err
+	}
+
+	return fs.storeDetached(ctx, file, signature)
+}
+
+// storeDetached stores signature, a detached signature of the
+// current version of file, next to its blob.
+func (fs *fileService) storeDetached(ctx context.Context, file File, signature []byte) error {
+	version, err := fs.fileRepository.GetVersion(ctx, file.ID, file.Version)
+	if err != nil {
+		return err
+	}
+
+	signaturePath, err := fs.writeSignature(ctx, version, signature)
+	if err != nil {
+		return err
+	}
+
+	return fs.fileRepository.SetSignature(ctx, file.ID, version.Version, signaturePath)
+}
+
+// timestampDetached returns signature, a detached
+// signature, with a timestamp of its signer.
+func (fs *fileService) timestampDetached(ctx context.Context, signature []byte) ([]byte, error) {
+	sd, err := cms.Parse(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.timestampSigner(ctx, &sd.Signers[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return sd.Marshal()
+}
+
+// writeSignature encrypts a detached signature with the
+// key of version and stores it next to its blob.
+func (fs *fileService) writeSignature(ctx context.Context, version Version, signature []byte) (string, error) {
+	key, err := fs.guard.GetKey(ctx, fileTable, version.KeyReference)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := fs.guard.Encrypt(key.PlainKey, signature)
+	if err != nil {
+		return "", err
+	}
+
+	signaturePath := version.Filepath + signatureExtension
+	err = fs.fileSystem.Write(signaturePath, res)
+	if err != nil {
+		return "", err
+	}
+
+	return signaturePath, nil
+}
+
+// readSignature returns the decrypted detached signature of version.
+func (fs *fileService) readSignature(ctx context.Context, version Version) ([]byte, error) {
+	if version.SignaturePath == "" {
+		return nil, ErrNoSignature
+	}
+
+	signature, err := fs.fileSystem.Read(version.SignaturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := fs.guard.GetKey(ctx, fileTable, version.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.guard.Decrypt(key.PlainKey, signature)
+}
+
+// getSignature returns the detached signature of the current version
+// of a file to its owner or to users having a permission to the file.
+func (fs *fileService) getSignature(ctx context.Context, userID uint64, id uint64) (*File, error) {
+	data, err := fs.fileRepository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.UserID != userID {
+		_, err = fs.getFilePermission(ctx, userID, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := fs.fileRepository.GetVersion(ctx, data.ID, data.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := fs.readSignature(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Filename: data.Filename + signatureExtension,
+		Content:  signature,
+	}, nil
+}
+
+// verifyDetached checks a detached CMS signature, DER or PEM encoded,
+// over content, its timestamp and certificate and resolves its signer.
+// Co-signers countersign the latest signature, the result describes
+// the last of the chain and lists them all.
+func (fs *fileService) verifyDetached(ctx context.Context, content []byte, signature []byte, report *VerificationReport) (*VerifyResult, error) {
+	if block, _ := pem.Decode(signature); block != nil {
+		signature = block.Bytes
+	}
+
+	sr := report.addSignature(SignatureFormatDetached)
+	sr.ByteRange = []int{0, len(content)}
+
+	sd, err := cms.Parse(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if sd.Content != nil {
+		return nil, errMalformedSignature
+	}
+
+	signer := sd.Signers[0]
+	sr.describeSigner(signer)
+
+	err = sd.Verify(content)
+	sr.checkSignedData(signer, content, err)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fs.verifySigner(ctx, signer, sd.Certificates, time.Time{}, "", sr)
+	if err != nil {
+		return nil, err
+	}
+	res.Format = SignatureFormatDetached
+
+	results := []VerifyResult{*res}
+
+	for {
+		counter, ok, err := signer.CounterSignature(sd.Certificates)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		// a countersignature digests the signature before it
+		csr := report.addSignature(SignatureFormatDetached)
+		csr.ByteRange = sr.ByteRange
+		csr.describeSigner(counter)
+
+		err = signer.VerifyCounterSignature(counter)
+		csr.checkSignedData(counter, signer.Signature, err)
+		if err != nil {
+			return nil, err
+		}
+
+		counterRes, err := fs.verifySigner(ctx, counter, sd.Certificates, time.Time{}, "", csr)
+		if err != nil {
+			return nil, err
+		}
+		counterRes.Format = SignatureFormatDetached
+
+		// it covers the content the first signature digests
+		counterRes.Digest = res.Digest
+
+		results = append(results, *counterRes)
+		signer = counter
+	}
+
+	return latestSignature(results), nil
+}
@@ -0,0 +1,63 @@
+package file
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"encryption/ca"
+	"encryption/guard/cms"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyFileDetached(t *testing.T) {
+	privateKey, fingerprint := newSigningKey(t)
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + fingerprint: {Fingerprint: fingerprint, Current: true},
+	}}
+	authority := &fakeAuthority{}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority))
+
+	signTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	cert := signerCertificate(t, &user.User{Username: "alice", Email: "alice@example.com"}, privateKey, signTime)
+
+	content := []byte("\x89PNG\r\n\x1a\nnot a real image")
+	signature, err := cms.SignDetached(content, privateKey, []*x509.Certificate{cert}, signTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: signature})
+
+	for _, sig := range [][]byte{signature, encoded} {
+		res, err := fs.verifyFile(context.Background(), content, sig)
+		if err != nil {
+			t.Fatalf("verifyFile() error = %v", err)
+		}
+		if res.Format != SignatureFormatDetached || res.SignBy != "alice" || res.Contact != "alice@example.com" ||
+			!res.SignDate.Equal(signTime) || res.Signer != SignerCurrentKey || res.Certificate != CertificateUntrusted {
+			t.Errorf("verifyFile() = %+v", res)
+		}
+	}
+
+	_, err = fs.verifyFile(context.Background(), append(content, '!'), signature)
+	if err == nil {
+		t.Error("modified content was accepted")
+	}
+
+	// a key superseded after signing still verifies, a lost one does not
+	revokedAt := signTime.Add(time.Hour)
+	for reason, want := range map[int]error{ca.ReasonSuperseded: nil, ca.ReasonKeyCompromise: ca.ErrCertificateRevoked} {
+		authority.revoked = map[string]ca.Certificate{
+			fingerprint: {Fingerprint: fingerprint, RevokedAt: &revokedAt, RevocationReason: reason},
+		}
+
+		_, err = fs.verifyFile(context.Background(), content, signature)
+		if !errors.Is(err, want) {
+			t.Errorf("revocation reason %d: verifyFile() error = %v, want %v", reason, err, want)
+		}
+	}
+}
@@ -16,16 +16,73 @@ type File struct {
 	Filepath string `json:"filepath,omitempty"`
 	IsSigned bool   `json:"is_signed"`
 
+	// FolderID is the id of the folder
+	// holding the file, 0 for top level files.
+	FolderID uint64 `json:"folder_id"`
+
+	// Version is the current version number of the file.
+	Version int `json:"version"`
+
+	// Size is the size of the plain file content in bytes.
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+
 	// Metadata is an encrypted reference to
 	// the file's key.
 	KeyReference []byte `json:"-"`
 
+	// ThumbnailPath is the path of the thumbnail encrypted
+	// with the file's key, empty if it has no thumbnail.
+	ThumbnailPath string `json:"-"`
+
+	// Malware scan result of the file.
+	ScanStatus    string     `json:"scan_status"`
+	ScanSignature string     `json:"scan_signature,omitempty"`
+	ScannedAt     *time.Time `json:"scanned_at,omitempty"`
+
+	// Checksum is the sha-256 of the encrypted blob.
+	Checksum []byte `json:"-"`
+
+	// Damaged is true when the blob does not
+	// match its checksum anymore.
+	Damaged bool `json:"damaged"`
+
+	// DeletedAt is the time the file was moved
+	// to the trash, nil for files not in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
 	FilePermissions filepermission.FilePermission `json:"file_permissions"`
 
 	// File content.
 	Content []byte
 }
 
+// Version represents a stored revision of a file. Each
+// version has its own encrypted blob and key.
+type Version struct {
+	ID      uint64 `json:"id"`
+	FileID  uint64 `json:"file_id"`
+	Version int    `json:"version"`
+
+	Filename     string `json:"filename"`
+	Filepath     string `json:"-"`
+	KeyReference []byte `json:"-"`
+	Size         int64  `json:"size"`
+	IsSigned     bool   `json:"is_signed"`
+
+	ThumbnailPath string `json:"-"`
+	ScanStatus    string `json:"scan_status"`
+
+	Checksum []byte `json:"-"`
+	Damaged  bool   `json:"damaged"`
+
+	// SignaturePath is the path of the detached signature encrypted
+	// with the version's key, empty when it has none.
+	SignaturePath string `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // Types for File.
 const (
 	IDCard         string = "id_card"
@@ -35,11 +92,27 @@ const (
 	Misc           string = "misc"
 )
 
+// Scan statuses for File.
+//
+// - clean : no malware was found.
+// - unscanned : the scanner is disabled, or was unavailable
+// with a fail-open policy.
+// - quarantined : the scanner was unavailable with a fail-closed
+// policy, the file can not be accessed until it is rescanned.
+// - infected : malware was found when rescanning a quarantined file.
+const (
+	ScanClean       string = "clean"
+	ScanUnscanned   string = "unscanned"
+	ScanQuarantined string = "quarantined"
+	ScanInfected    string = "infected"
+)
+
 // Digital signature const.
 const (
 	DataCommentKey      string = "DataKeyf-14_"
 	SignatureCommentKey string = "SignatureKeyf-14_"
 	PublicKeyCommentKey string = "Publickeyf-14_"
+	TimestampCommentKey string = "Timestampf-14_"
 )
 
 func ValidateType(s string) (string, error) {
@@ -63,5 +136,72 @@ type SignatureMetadata struct {
 	SignDate time.Time `json:"sign_date"`
 	SignBy   string    `json:"sign_by"`
 	Contact  string    `json:"contact"`
+
+	// Digest is the hex encoded sha-256 of the content
+	// preceding the signature block.
+	Digest string `json:"digest"`
+
+	// KeyFingerprint is the fingerprint of the
+	// signer's registered public key.
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+}
+
+// Signer statuses of a verified signature.
+//
+// - current_key : signed with the registered current key of sign_by.
+// - historical_key : signed with a retired key of sign_by.
+// - unknown_signer : the signature is valid but its key is not
+// registered for sign_by, anyone could have made it.
+const (
+	SignerCurrentKey    string = "current_key"
+	SignerHistoricalKey string = "historical_key"
+	SignerUnknown       string = "unknown_signer"
+)
+
+// Formats of a file signature.
+//
+// - embedded : signature block appended to the file.
+// - pades : PDF signature dictionary holding a CMS signature.
+// - detached : CMS signature stored apart from the file.
+const (
+	SignatureFormatEmbedded string = "embedded"
+	SignatureFormatPAdES    string = "pades"
+	SignatureFormatDetached string = "detached"
+)
+
+// VerifyResult is a valid signature and the
+// registered key its signer was resolved to.
+type VerifyResult struct {
+	SignatureMetadata
+
+	Format string `json:"format"`
+
+	// Fingerprint of the public key embedded in the file.
+	EmbeddedKeyFingerprint string `json:"embedded_key_fingerprint"`
+	Signer                 string `json:"signer"`
+
+	// Certificate is the trust of the signer certificate, empty
+	// for signatures without one.
+	Certificate string `json:"certificate,omitempty"`
+
+	// Timestamp is the time a timestamp authority attests the
+	// signature existed at, nil when it was not timestamped.
+	Timestamp          *time.Time `json:"timestamp,omitempty"`
+	TimestampAuthority string     `json:"timestamp_authority,omitempty"`
+
+	// Signatures are all the signatures of a co-signed
+	// file, oldest first, nil when it has a single one.
+	Signatures []VerifyResult `json:"signatures,omitempty"`
 }
 
+// Trust of the certificate of a signer.
+//
+// - trusted : issued by the certificate authority, valid and not
+// revoked at the signing time.
+// - untrusted : self-signed or issued by another authority, the
+// signer is only known from the signing key registry.
+const (
+	CertificateTrusted   string = "trusted"
+	CertificateUntrusted string = "untrusted"
+)
+
@@ -3,6 +3,7 @@ package file
 import (
 	"errors"
 	"os"
+	"path/filepath"
 )
 
 type fileSystem struct {
@@ -21,9 +22,55 @@ func (fs *fileSystem) Read(path string) ([]byte, error) {
 	return data, nil
 }
 
+// Write writes data to a temporary file synced to disk and renames
+// it to path, so that path never holds a partially written blob.
 func (fs *fileSystem) Write(path string, data []byte) error {
-	err := os.WriteFile(path, data, 0644)
-	return err
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// no-op once renamed
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return err
+	}
+
+	// sync the directory to persist the rename
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Remove removes a file, files that do not exist are ignored.
+func (fs *fileSystem) Remove(path string) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
 }
 
 func (fs *fileSystem) NewDir(path string) error {
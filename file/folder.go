@@ -0,0 +1,84 @@
+package file
+
+import (
+	"context"
+	"encryption/folder"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type FolderRepository interface {
+	Get(ctx context.Context, id uint64) (folder.Folder, error)
+}
+
+// checkFolder returns an error unless folderID is
+// 0 or a folder owned by userID.
+func (fs *fileService) checkFolder(ctx context.Context, userID uint64, folderID uint64) error {
+	if folderID == 0 {
+		return nil
+	}
+
+	data, err := fs.folderRepository.Get(ctx, folderID)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+	if err == pgx.ErrNoRows {
+		return errors.New("Requested folder not found")
+	}
+
+	if data.UserID != userID {
+		return errors.New("You do not have access to this resource data")
+	}
+
+	return nil
+}
+
+// shareToFolder shares a file to the users having a permission on
+// its folder. Failures are logged since the file itself is stored.
+func (fs *fileService) shareToFolder(ctx context.Context, file File) {
+	if file.FolderID == 0 {
+		return
+	}
+
+	err := fs.permissionService.ShareFolderFile(ctx, file.ID)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// syncShares gives the grantees of a file access to its new current
+// version. Failures are logged, grantees keep reading the version they
+// were granted until the next sync.
+func (fs *fileService) syncShares(ctx context.Context, fileID uint64) {
+	err := fs.permissionService.SyncFilePermissions(ctx, fileID)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// moveFile moves a file of the user to another folder. The file
+// is shared to the users having a permission on the new folder.
+func (fs *fileService) moveFile(ctx context.Context, request MoveFileRequest) (*File, error) {
+	data, err := fs.getOwnedFile(ctx, request.UserID, request.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fs.checkFolder(ctx, request.UserID, request.FolderID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.FolderID = request.FolderID
+
+	err = fs.fileRepository.UpdateFolder(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.shareToFolder(ctx, data)
+
+	return &data, nil
+}
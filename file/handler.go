@@ -4,27 +4,61 @@ import (
 	"context"
 	"encoding/json"
 	"encryption/helper"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 )
 
 type FileService interface {
-	listFiles(ctx context.Context, userID uint64, fileType string, targetUsername string) ([]File, error)
+	listFiles(ctx context.Context, request ListFilesRequest) (*ListFilesResponse, error)
 	getFile(ctx context.Context, userID uint64, id uint64) (*File, error)
+	getThumbnail(ctx context.Context, userID uint64, id uint64) (*File, error)
 	storeFile(
 		ctx context.Context,
 		userID uint64,
 		header multipart.FileHeader,
 		file multipart.File,
 		fileType string,
-	) ([]byte, error)
+		options UploadOptions,
+	) (*File, error)
+	storeVersion(
+		ctx context.Context,
+		userID uint64,
+		fileID uint64,
+		header multipart.FileHeader,
+		file multipart.File,
+		options UploadOptions,
+	) (*Version, error)
+	listVersions(ctx context.Context, userID uint64, fileID uint64) ([]Version, error)
+	getVersion(ctx context.Context, userID uint64, fileID uint64, version int) (*File, error)
+	restoreVersion(ctx context.Context, userID uint64, fileID uint64, version int) (*Version, error)
+	moveFile(ctx context.Context, request MoveFileRequest) (*File, error)
+	prepareArchive(ctx context.Context, request ArchiveRequest) ([]File, error)
+	getUsage(ctx context.Context, userID uint64) (*Usage, error)
+	setQuota(ctx context.Context, request SetQuotaRequest) error
+	writeArchive(ctx context.Context, w io.Writer, userID uint64, files []File, password string) error
 	deleteFile(ctx context.Context, userID uint64, sfileID uint64) error
-	signFile(ctx context.Context, userId uint64, fileId uint64) error
-	verifyFile(ctx context.Context, fileContent []byte) (SignatureMetadata, error)
+	listTrash(ctx context.Context, userID uint64) ([]File, error)
+	restoreFile(ctx context.Context, userID uint64, id uint64) error
+	purgeFile(ctx context.Context, userID uint64, id uint64) error
+	emptyTrash(ctx context.Context, userID uint64) error
+	signFile(ctx context.Context, userId uint64, fileId uint64, format string) error
+	prepareSignature(ctx context.Context, request PrepareSignatureRequest) (*PrepareSignatureResponse, error)
+	completeSignature(ctx context.Context, request CompleteSignatureRequest) error
+	revokeSignature(ctx context.Context, request RevokeSignatureRequest) (*RevokeSignatureResponse, error)
+	reportFile(ctx context.Context, fileContent []byte, signature []byte) *VerificationReport
+	getSignature(ctx context.Context, userID uint64, id uint64) (*File, error)
+	requestSignatures(ctx context.Context, request CreateSigningRequest) (*SigningRequest, error)
+	getSigningRequest(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error)
+	listSigningRequests(ctx context.Context, userID uint64) ([]SigningRequest, error)
+	cosignFile(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error)
+	declineSigning(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error)
+	cancelSigning(ctx context.Context, userID uint64, fileID uint64) (*SigningRequest, error)
 }
 
 type Handler struct {
@@ -43,95 +77,55 @@ func (h *Handler) UploadFile(w http.ResponseWriter, r *http.Request) {
 	userId := uint64(r.Context().Value("user_id").(float64))
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
 	var fileType = r.FormValue("type")
 	fileType, err := ValidateType(fileType)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
 	uploadedFile, header, err := r.FormFile("file")
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 	defer uploadedFile.Close()
 
-	_, err = h.fileService.storeFile(context.TODO(), userId, *header, uploadedFile, fileType)
-	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
+	options := UploadOptions{
+		KeepMetadata: r.FormValue("keep_metadata") == "true",
+	}
 
-		jsonResponse, err := json.Marshal(response)
+	if qFolderID := r.FormValue("folder_id"); qFolderID != "" {
+		options.FolderID, err = strconv.ParseUint(qFolderID, 10, 64)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: "Request invalid. Folder id must be a number"})
 			return
 		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
-		return
-	}
-
-	response := helper.Response{
-		Message: "success",
-		Data:    nil,
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	_, err = h.fileService.storeFile(r.Context(), userId, *header, uploadedFile, fileType, options)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrUnsupportedContent):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, ErrFileTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, ErrQuotaExceeded):
+			status = http.StatusInsufficientStorage
+		case errors.Is(err, ErrInfected):
+			status = http.StatusUnprocessableEntity
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
 		return
 	}
-	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success"})
 }
 
 func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request) {
@@ -140,75 +134,66 @@ func (h *Handler) ListFiles(w http.ResponseWriter, r *http.Request) {
 
 	targetUsername := strings.TrimPrefix(r.URL.Path, "/files/")
 
-	qFileType := r.URL.Query().Get("type")
+	query := r.URL.Query()
 
-	fileType, err := ValidateType(qFileType)
-	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
+	request := ListFilesRequest{
+		UserID:         userId,
+		TargetUsername: targetUsername,
+		Type:           query.Get("type"),
+		Search:         query.Get("search"),
+		SortBy:         query.Get("sort"),
+		Order:          query.Get("order"),
+		Cursor:         query.Get("cursor"),
+	}
 
-		jsonResponse, err := json.Marshal(response)
+	var err error
+
+	if qSigned := query.Get("signed"); qSigned != "" {
+		signed, err := strconv.ParseBool(qSigned)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: "Request invalid. Signed value must be true or false"})
 			return
 		}
-
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
-		return
+		request.Signed = &signed
 	}
 
-	res, err := h.fileService.listFiles(r.Context(), userId, fileType, targetUsername)
-	if err != nil {
-		// handle invalid auth
-
-		if err.Error() == "redirect" {
-			response := helper.Response{
-				Message: "unauthorized, please enter key at profile page",
-				Data:    nil,
-			}
-
-			jsonResponse, err := json.Marshal(response)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write(jsonResponse)
+	if qFolder := query.Get("folder"); qFolder != "" {
+		folderID, err := strconv.ParseUint(qFolder, 10, 64)
+		if err != nil {
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: "Request invalid. Folder must be a folder id"})
 			return
 		}
+		request.FolderID = &folderID
+	}
 
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
+	if qLimit := query.Get("limit"); qLimit != "" {
+		request.Limit, err = strconv.Atoi(qLimit)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: "Request invalid. Limit must be a number"})
 			return
 		}
-
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
-		return
 	}
 
-	response := helper.Response{
-		Message: "success",
-		Data:    res,
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	res, err := h.fileService.listFiles(r.Context(), request)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		// handle invalid auth
+
+		if err.Error() == "redirect" {
+			helper.WriteResponse(w, http.StatusUnauthorized, helper.Response{Message: "unauthorized, please enter key at profile page"})
+			return
+		}
+
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success", Data: res})
 }
 
 func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request) {
@@ -278,63 +263,97 @@ func (h *Handler) GetFile(w http.ResponseWriter, r *http.Request) {
 	w.Write(res.Content)
 }
 
-func (h *Handler) DeleteFile(w http.ResponseWriter, r *http.Request) {
-
+func (h *Handler) GetThumbnail(w http.ResponseWriter, r *http.Request) {
 	userId := uint64(r.Context().Value("user_id").(float64))
-	qID := strings.TrimPrefix(r.URL.Path, "/file/")
+	qID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/file/"), "/thumbnail")
 
 	id, err := strconv.ParseUint(qID, 10, 64)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
 
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+	res, err := h.fileService.getThumbnail(r.Context(), userId, id)
+	if err != nil {
+		status := http.StatusBadRequest
+		message := err.Error()
+
+		switch {
+		case err.Error() == "redirect":
+			status = http.StatusUnauthorized
+			message = "unauthorized, please enter key at profile page"
+		case errors.Is(err, errNoThumbnail):
+			status = http.StatusNotFound
 		}
 
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, status, helper.Response{Message: message})
 		return
 	}
 
-	err = h.fileService.deleteFile(context.TODO(), userId, id)
+	w.Header().Set("content-type", JPEG)
+	w.WriteHeader(http.StatusOK)
+	w.Write(res.Content)
+}
+
+// GetSignature downloads the detached signature of the current
+// version of a file.
+func (h *Handler) GetSignature(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+	qID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/file/"), "/signature")
+
+	id, err := strconv.ParseUint(qID, 10, 64)
 	if err != nil {
-		response := helper.Response{
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{
 			Message: err.Error(),
 			Data:    nil,
-		}
+		})
+		return
+	}
 
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+	res, err := h.fileService.getSignature(r.Context(), userId, id)
+	if err != nil {
+		status := http.StatusBadRequest
+		message := err.Error()
+
+		switch {
+		case err.Error() == "redirect":
+			status = http.StatusUnauthorized
+			message = "unauthorized, please enter key at profile page"
+		case errors.Is(err, ErrNoSignature):
+			status = http.StatusNotFound
 		}
 
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, status, helper.Response{
+			Message: message,
+			Data:    nil,
+		})
 		return
 	}
 
-	response := helper.Response{
-		Message: "success",
-		Data:    nil,
+	w.Header().Set("content-type", "application/pkcs7-signature")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v\"", res.Filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(res.Content)
+}
+
+func (h *Handler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+
+	userId := uint64(r.Context().Value("user_id").(float64))
+	qID := strings.TrimPrefix(r.URL.Path, "/file/")
+
+	id, err := strconv.ParseUint(qID, 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	err = h.fileService.deleteFile(context.TODO(), userId, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
-	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "File moved to trash"})
 }
 
 func (h *Handler) SignFile(w http.ResponseWriter, r *http.Request) {
@@ -343,147 +362,665 @@ func (h *Handler) SignFile(w http.ResponseWriter, r *http.Request) {
 
 	fileId, err := strconv.ParseUint(stringFileId, 10, 64)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
-	err = h.fileService.signFile(r.Context(), userId, fileId)
+	err = h.fileService.signFile(r.Context(), userId, fileId, r.URL.Query().Get("mode"))
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrQuotaExceeded) {
+			status = http.StatusInsufficientStorage
 		}
 
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
-		return
-	}
-
-	response := helper.Response{
-		Message: "success",
-		Data:    nil,
-	}
-
-	jsonResponse, err := json.Marshal(response)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
 		return
 	}
 
-	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success"})
 }
 
 func (h *Handler) VerifyFile(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
 	uploadedFile, _, err := r.FormFile("file")
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 	defer uploadedFile.Close()
 
 	fileContent, err := io.ReadAll(uploadedFile)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
 
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+	// a detached signature is uploaded along with the file
+	var signature []byte
+	uploadedSignature, _, err := r.FormFile("signature")
+	if err == nil {
+		defer uploadedSignature.Close()
+		signature, err = io.ReadAll(uploadedSignature)
+	}
+	if err != nil && err != http.ErrMissingFile {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
-	signerMetadata, err := h.fileService.verifyFile(r.Context(), fileContent)
+	report := h.fileService.reportFile(r.Context(), fileContent, signature)
+
+	// files failing the verification keep the status and message
+	// of the error, the report tells which check failed
+	status := http.StatusOK
+	message := "success"
+	switch report.Verdict {
+	case VerdictInvalid, VerdictRevoked, VerdictUnsigned:
+		status = http.StatusBadRequest
+		message = report.Reasons[0].Message
+	case VerdictWarning:
+		for _, reason := range report.Reasons {
+			if reason.Code == ReasonUnknownSigner {
+				message = "valid signature, unknown signer"
+			}
+		}
+	}
+
+	helper.WriteResponse(w, status, helper.Response{
+		Message: message,
+		Data:    report,
+	})
+}
+
+// parseVersionPath parses the file id and the version number of
+// paths such as /file/:id/versions/:version. The version is 0
+// when the path does not have one.
+func parseVersionPath(path string) (uint64, int, error) {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, "/file/"), "/"), "/")
+
+	fileID, err := strconv.ParseUint(segments[0], 10, 64)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
+		return 0, 0, err
+	}
+
+	if len(segments) < 3 {
+		return fileID, 0, nil
+	}
+
+	version, err := strconv.Atoi(segments[2])
+	if err != nil || version <= 0 {
+		return 0, 0, errors.New("invalid version")
+	}
+
+	return fileID, version, nil
+}
+
+func (h *Handler) UploadVersion(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	uploadedFile, header, err := r.FormFile("file")
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+	defer uploadedFile.Close()
+
+	options := UploadOptions{
+		KeepMetadata: r.FormValue("keep_metadata") == "true",
+	}
+
+	res, err := h.fileService.storeVersion(r.Context(), userId, fileId, *header, uploadedFile, options)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrUnsupportedContent):
+			status = http.StatusUnsupportedMediaType
+		case errors.Is(err, ErrFileTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, ErrQuotaExceeded):
+			status = http.StatusInsufficientStorage
+		case errors.Is(err, ErrInfected):
+			status = http.StatusUnprocessableEntity
 		}
 
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.listVersions(r.Context(), userId, fileId)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, version, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.getVersion(r.Context(), userId, fileId, version)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v\"", res.Filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(res.Content)
+}
+
+func (h *Handler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, version, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.restoreVersion(r.Context(), userId, fileId, version)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrQuotaExceeded) {
+			status = http.StatusInsufficientStorage
 		}
 
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
 		return
 	}
 
-	response := helper.Response{
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
 		Message: "success",
-		Data:    signerMetadata,
+		Data:    res,
+	})
+}
+
+func (h *Handler) MoveFile(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	// path is /file/:id/move
+	fileId, _, err := parseVersionPath(strings.TrimSuffix(r.URL.Path, "/move"))
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	var request MoveFileRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
-	w.Header().Set("content-type", "application/json")
+	request.UserID = userId
+	request.FileID = fileId
+
+	res, err := h.fileService.moveFile(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// parseTrashPath parses the file id of paths
+// such as /trash/:id and /trash/:id/restore.
+func parseTrashPath(path string) (uint64, error) {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, "/trash/"), "/"), "/")
+
+	return strconv.ParseUint(segments[0], 10, 64)
+}
+
+func (h *Handler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	res, err := h.fileService.listTrash(r.Context(), userId)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) RestoreFile(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	id, err := parseTrashPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = h.fileService.restoreFile(r.Context(), userId, id)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success"})
+}
+
+func (h *Handler) PurgeFile(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	id, err := parseTrashPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = h.fileService.purgeFile(r.Context(), userId, id)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success"})
+}
+
+func (h *Handler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	err := h.fileService.emptyTrash(r.Context(), userId)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success"})
+}
+
+// ArchiveFiles downloads owned and shared files as one ZIP archive.
+// Access to every file is checked before the archive is written to the
+// response, a failure while writing it can only be logged and truncates
+// the archive.
+func (h *Handler) ArchiveFiles(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	var request ArchiveRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+
+	files, err := h.fileService.prepareArchive(r.Context(), request)
+	if err != nil {
+		if err.Error() == "redirect" {
+			helper.WriteResponse(w, http.StatusUnauthorized, helper.Response{
+				Message: "unauthorized, please enter key at profile page",
+			})
+			return
+		}
+
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrArchiveTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("content-type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"files.zip\"")
 	w.WriteHeader(http.StatusOK)
-	w.Write(jsonResponse)
+
+	err = h.fileService.writeArchive(r.Context(), w, userId, files, request.Password)
+	if err != nil {
+		fmt.Println("archive files", err)
+	}
+}
+
+// GetUsage reports the storage used by the user by type.
+func (h *Handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	res, err := h.fileService.getUsage(r.Context(), userId)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// SetQuota overrides the default quota of the user
+// on /admin/quotas/:user_id.
+func (h *Handler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/admin/quotas/"), 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var request SetQuotaRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+
+	err = h.fileService.setQuota(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "Quota updated"})
+}
+
+// RequestSignatures invites co-signers to sign a file on /file/:id/cosign.
+func (h *Handler) RequestSignatures(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var request CreateSigningRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+	request.FileID = fileId
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.requestSignatures(r.Context(), request)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrSigningRequestPending) {
+			status = http.StatusConflict
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// GetSigningRequest returns the signing request of a file on /file/:id/cosign.
+func (h *Handler) GetSigningRequest(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.getSigningRequest(r.Context(), userId, fileId)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// ListSigningRequests lists the signing requests awaiting
+// the signature of the user on /request/signing/list.
+func (h *Handler) ListSigningRequests(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	res, err := h.fileService.listSigningRequests(r.Context(), userId)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// RespondSigningRequest handles the response of a user to a signing
+// request on /file/:id/cosign/:action, action being sign or decline
+// for co-signers and cancel for the owner.
+func (h *Handler) RespondSigningRequest(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	action := path.Base(r.URL.Path)
+
+	fileId, _, err := parseVersionPath(path.Dir(r.URL.Path))
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var res *SigningRequest
+	switch action {
+	case "sign":
+		res, err = h.fileService.cosignFile(r.Context(), userId, fileId)
+	case "decline":
+		res, err = h.fileService.declineSigning(r.Context(), userId, fileId)
+	case "cancel":
+		res, err = h.fileService.cancelSigning(r.Context(), userId, fileId)
+	default:
+		err = errors.New("invalid signing request action")
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "redirect":
+			status = http.StatusUnauthorized
+		case errors.Is(err, ErrQuotaExceeded):
+			status = http.StatusInsufficientStorage
+		case errors.Is(err, ErrSigningInProgress):
+			status = http.StatusConflict
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// PrepareSignature starts the signature of a file by the client held
+// key of the user on /file/:id/sign/prepare, with the format in the
+// mode query parameter like SignFile.
+func (h *Handler) PrepareSignature(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.prepareSignature(r.Context(), PrepareSignatureRequest{
+		UserID: userId,
+		FileID: fileId,
+		Format: r.URL.Query().Get("mode"),
+	})
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// CompleteSignature signs a file with the signature the client made
+// of the data of its signing session on /file/:id/sign/complete.
+func (h *Handler) CompleteSignature(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var request CompleteSignatureRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+	request.FileID = fileId
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = h.fileService.completeSignature(r.Context(), request)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrSigningSessionNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrSigningSessionExpired), errors.Is(err, ErrSigningSessionStale):
+			status = http.StatusConflict
+		case errors.Is(err, ErrQuotaExceeded):
+			status = http.StatusInsufficientStorage
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+	})
+}
+
+// RevokeSignature revokes the signatures of the user of the current
+// version of a file on /file/:id/signature/revoke, the owner gets the
+// unsigned version of the file back.
+func (h *Handler) RevokeSignature(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileId, _, err := parseVersionPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var request RevokeSignatureRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && err != io.EOF {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+	request.FileID = fileId
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	res, err := h.fileService.revokeSignature(r.Context(), request)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrQuotaExceeded) {
+			status = http.StatusInsufficientStorage
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
 }
@@ -0,0 +1,243 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var errMalformedImage = errors.New("malformed image")
+
+// metadataFileTypes are the file types whose
+// image metadata is stripped on upload.
+var metadataFileTypes = []string{ProfilePicture, IDCard}
+
+// StripMetadata removes EXIF, XMP, IPTC, ICC profiles and comments
+// from JPEG, PNG and WebP images without re-encoding the pixel data.
+// Other content types are returned unchanged.
+func StripMetadata(contentType string, content []byte) ([]byte, error) {
+	switch contentType {
+	case JPEG:
+		return stripJPEG(content)
+	case PNG:
+		return stripPNG(content)
+	case WebP:
+		return stripWebP(content)
+	}
+
+	return content, nil
+}
+
+// JPEG markers.
+const (
+	jpegSOI  byte = 0xD8
+	jpegEOI  byte = 0xD9
+	jpegSOS  byte = 0xDA
+	jpegAPP0 byte = 0xE0
+	jpegAPPE byte = 0xEE
+	jpegAPPF byte = 0xEF
+	jpegCOM  byte = 0xFE
+)
+
+// isJPEGMetadata reports whether a segment carries metadata.
+// APP0 (JFIF) and APP14 (Adobe color transform) are
+// kept as they are needed to decode the image.
+func isJPEGMetadata(marker byte) bool {
+	if marker == jpegCOM {
+		return true
+	}
+
+	return marker > jpegAPP0 && marker <= jpegAPPF && marker != jpegAPPE
+}
+
+func stripJPEG(content []byte) ([]byte, error) {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != jpegSOI {
+		return nil, errMalformedImage
+	}
+
+	res := make([]byte, 0, len(content))
+	res = append(res, content[:2]...)
+
+	idx := 2
+	inScan := false
+
+	for idx < len(content) {
+		// copy entropy coded data until the next marker
+		if inScan {
+			start := idx
+			for idx+1 < len(content) {
+				if content[idx] == 0xFF {
+					next := content[idx+1]
+					// stuffed byte or restart marker
+					if next == 0x00 || (next >= 0xD0 && next <= 0xD7) {
+						idx += 2
+						continue
+					}
+					// fill byte before a marker
+					if next == 0xFF {
+						idx++
+						continue
+					}
+					break
+				}
+				idx++
+			}
+
+			if idx+1 >= len(content) {
+				return nil, errMalformedImage
+			}
+
+			res = append(res, content[start:idx]...)
+			inScan = false
+			continue
+		}
+
+		if content[idx] != 0xFF || idx+1 >= len(content) {
+			return nil, errMalformedImage
+		}
+
+		marker := content[idx+1]
+
+		// skip fill bytes
+		if marker == 0xFF {
+			idx++
+			continue
+		}
+
+		// trailing data such as appended
+		// thumbnails is dropped after EOI
+		if marker == jpegEOI {
+			res = append(res, 0xFF, jpegEOI)
+			return res, nil
+		}
+
+		if idx+4 > len(content) {
+			return nil, errMalformedImage
+		}
+
+		length := int(binary.BigEndian.Uint16(content[idx+2 : idx+4]))
+		end := idx + 2 + length
+		if length < 2 || end > len(content) {
+			return nil, errMalformedImage
+		}
+
+		if !isJPEGMetadata(marker) {
+			res = append(res, content[idx:end]...)
+		}
+
+		if marker == jpegSOS {
+			inScan = true
+		}
+
+		idx = end
+	}
+
+	return nil, errMalformedImage
+}
+
+// pngMetadataChunks are the ancillary chunks holding metadata.
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"iCCP": true,
+	"tIME": true,
+}
+
+func stripPNG(content []byte) ([]byte, error) {
+	const signatureLength = 8
+
+	if len(content) < signatureLength {
+		return nil, errMalformedImage
+	}
+
+	res := make([]byte, 0, len(content))
+	res = append(res, content[:signatureLength]...)
+
+	idx := signatureLength
+	for idx+12 <= len(content) {
+		length := int(binary.BigEndian.Uint32(content[idx : idx+4]))
+		chunkType := string(content[idx+4 : idx+8])
+		end := idx + 12 + length
+		if length < 0 || end > len(content) {
+			return nil, errMalformedImage
+		}
+
+		crc := crc32.ChecksumIEEE(content[idx+4 : idx+8+length])
+		if crc != binary.BigEndian.Uint32(content[idx+8+length:end]) {
+			return nil, errMalformedImage
+		}
+
+		if !pngMetadataChunks[chunkType] {
+			res = append(res, content[idx:end]...)
+		}
+
+		if chunkType == "IEND" {
+			return res, nil
+		}
+
+		idx = end
+	}
+
+	return nil, errMalformedImage
+}
+
+// VP8X feature flags.
+const (
+	webpFlagXMP  byte = 0x04
+	webpFlagEXIF byte = 0x08
+	webpFlagICC  byte = 0x20
+)
+
+func stripWebP(content []byte) ([]byte, error) {
+	if len(content) < 12 ||
+		!bytes.Equal(content[:4], []byte("RIFF")) ||
+		!bytes.Equal(content[8:12], []byte("WEBP")) {
+		return nil, errMalformedImage
+	}
+
+	riffEnd := 8 + int(binary.LittleEndian.Uint32(content[4:8]))
+	if riffEnd > len(content) {
+		return nil, errMalformedImage
+	}
+
+	res := make([]byte, 0, len(content))
+	res = append(res, content[:12]...)
+
+	idx := 12
+	for idx+8 <= riffEnd {
+		chunkType := string(content[idx : idx+4])
+		size := int(binary.LittleEndian.Uint32(content[idx+4 : idx+8]))
+
+		// chunks are padded to an even size
+		end := idx + 8 + size + size%2
+		if end > riffEnd {
+			if idx+8+size != riffEnd {
+				return nil, errMalformedImage
+			}
+			end = riffEnd
+		}
+
+		switch chunkType {
+		case "EXIF", "XMP ", "ICCP":
+		case "VP8X":
+			if size < 1 {
+				return nil, errMalformedImage
+			}
+
+			chunk := append([]byte{}, content[idx:end]...)
+			chunk[8] &^= webpFlagXMP | webpFlagEXIF | webpFlagICC
+			res = append(res, chunk...)
+		default:
+			res = append(res, content[idx:end]...)
+		}
+
+		idx = end
+	}
+
+	binary.LittleEndian.PutUint32(res[4:8], uint32(len(res)-8))
+
+	return res, nil
+}
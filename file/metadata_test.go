@@ -0,0 +1,97 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestStripMetadataJPEG(t *testing.T) {
+	content := jpegSample(t)
+
+	exif := append([]byte("Exif\x00\x00"), []byte("GPS 48.8584 2.2945")...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	segment = append(segment, exif...)
+
+	// insert EXIF after SOI and a thumbnail after EOI
+	withMetadata := append([]byte{}, content[:2]...)
+	withMetadata = append(withMetadata, segment...)
+	withMetadata = append(withMetadata, content[2:]...)
+	withMetadata = append(withMetadata, []byte("trailing thumbnail")...)
+
+	stripped, err := StripMetadata(JPEG, withMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(stripped, []byte("Exif")) || bytes.Contains(stripped, []byte("thumbnail")) {
+		t.Error("metadata was not stripped")
+	}
+
+	if !bytes.Equal(stripped, content) {
+		t.Error("image data was changed")
+	}
+}
+
+func TestStripMetadataPNG(t *testing.T) {
+	content, err := os.ReadFile("../guard/test_files/tux.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := []byte("Comment\x00taken at home")
+	chunk := make([]byte, 8)
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	copy(chunk[4:], "tEXt")
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// insert the text chunk after IHDR
+	ihdrEnd := 8 + 12 + 13
+	withMetadata := append([]byte{}, content[:ihdrEnd]...)
+	withMetadata = append(withMetadata, chunk...)
+	withMetadata = append(withMetadata, content[ihdrEnd:]...)
+
+	stripped, err := StripMetadata(PNG, withMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(stripped, []byte("taken at home")) {
+		t.Error("metadata was not stripped")
+	}
+
+	_, _, err = image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Errorf("stripped image can not be decoded: %v", err)
+	}
+}
+
+func TestStripMetadataWebP(t *testing.T) {
+	content := []byte("RIFF\x00\x00\x00\x00WEBP" +
+		"VP8X\x0a\x00\x00\x00\x2c\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+		"VP8 \x02\x00\x00\x00ab" +
+		"EXIF\x03\x00\x00\x00gps\x00")
+	binary.LittleEndian.PutUint32(content[4:], uint32(len(content)-8))
+
+	stripped, err := StripMetadata(WebP, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(stripped, []byte("EXIF")) {
+		t.Error("metadata was not stripped")
+	}
+
+	if stripped[20]&(webpFlagEXIF|webpFlagICC|webpFlagXMP) != 0 {
+		t.Error("metadata flags were not cleared")
+	}
+
+	if int(binary.LittleEndian.Uint32(stripped[4:])) != len(stripped)-8 {
+		t.Error("riff size was not updated")
+	}
+}
@@ -0,0 +1,147 @@
+package file
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encryption/guard/cms"
+	"encryption/pdf"
+	"encryption/user"
+	"errors"
+	"time"
+)
+
+// pdfSignatureSize is the room reserved in a PDF for its
+// CMS signature, the certificates included.
+const pdfSignatureSize = 16 << 10
+
+// pkcs7SubFilter is the legacy detached CMS sub filter, validated
+// as PAdES signatures are.
+const pkcs7SubFilter pdf.Name = "adbe.pkcs7.detached"
+
+var errUnsupportedPDFSignature = errors.New("unsupported PDF signature format")
+
+// signPDF signs content with an incremental update holding a PAdES
+// baseline signature. The signing time is the one of the signature
+// dictionary, PAdES does not allow it in the CMS signature, and is
+// proven by a timestamp of the signature.
+func (fs *fileService) signPDF(ctx context.Context, content []byte, user *user.User, privateKey *rsa.PrivateKey) ([]byte, error) {
+	chain, err := fs.certificateAuthority.Chain(ctx, user.ID, user.Username, user.Email, &privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared, err := preparePDF(content, user, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	signedAttributes, err := pdfSignedAttributes(prepared, chain[0])
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := fs.guard.SignRSA(privateKey, signedAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := fs.signedData(ctx, chain, signedAttributes, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return prepared.Embed(der)
+}
+
+// preparePDF prepares content for a signature of user at signTime.
+func preparePDF(content []byte, user *user.User, signTime time.Time) (*pdf.Prepared, error) {
+	return pdf.Prepare(content, pdf.SignatureInfo{
+		Name:        user.Username,
+		ContactInfo: user.Email,
+		Time:        signTime,
+	}, pdfSignatureSize)
+}
+
+// pdfSignedAttributes returns the attributes signed by the
+// holder of cert for the signed byte ranges of prepared.
+func pdfSignedAttributes(prepared *pdf.Prepared, cert *x509.Certificate) ([]byte, error) {
+	digest := sha256.Sum256(prepared.SignedContent())
+
+	return cms.SignedAttributes(cms.OIDData, digest[:], cert, time.Time{})
+}
+
+// signedData returns the DER encoded SignedData of the signature of
+// signedAttributes by the first certificate of chain, with a timestamp
+// of the signature.
+func (fs *fileService) signedData(ctx context.Context, chain []*x509.Certificate, signedAttributes []byte, signature []byte) ([]byte, error) {
+	signer := cms.SignerInfo{
+		Certificate:      chain[0],
+		SignedAttributes: signedAttributes,
+		Signature:        signature,
+	}
+
+	err := fs.timestampSigner(ctx, &signer)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := cms.SignedData{
+		ContentType:  cms.OIDData,
+		Certificates: chain,
+		Signers:      []cms.SignerInfo{signer},
+	}
+
+	return sd.Marshal()
+}
+
+// verifyPDF checks every signature of a PDF, its timestamp and its
+// certificate, the latest one must cover the whole document and is
+// the one the result describes. Each signature covers the ones
+// before it, co-signed documents list them all.
+func (fs *fileService) verifyPDF(ctx context.Context, content []byte, signatures []pdf.Signature, report *VerificationReport) (*VerifyResult, error) {
+	results := make([]VerifyResult, 0, len(signatures))
+
+	for _, signature := range signatures {
+		sr := report.addSignature(SignatureFormatPAdES)
+		sr.ByteRange = append([]int{}, signature.ByteRange[:]...)
+		sr.Signer.Name = signature.Name
+		sr.Signer.Contact = signature.ContactInfo
+
+		if signature.SubFilter != pdf.SubFilterCAdES && signature.SubFilter != pkcs7SubFilter {
+			return nil, errUnsupportedPDFSignature
+		}
+
+		sd, err := cms.Parse(signature.Contents)
+		if err != nil {
+			return nil, err
+		}
+
+		signer := sd.Signers[0]
+		sr.describeSigner(signer)
+
+		signedContent := signature.SignedContent(content)
+
+		err = sd.Verify(signedContent)
+		sr.checkSignedData(signer, signedContent, err)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := fs.verifySigner(ctx, signer, sd.Certificates, signature.Time, signature.ContactInfo, sr)
+		if err != nil {
+			return nil, err
+		}
+		res.Format = SignatureFormatPAdES
+
+		results = append(results, *res)
+	}
+
+	last := signatures[len(signatures)-1]
+	if !last.CoversDocument(content) {
+		return nil, ErrContentModified
+	}
+
+	return latestSignature(results), nil
+}
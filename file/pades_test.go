@@ -0,0 +1,61 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestVerifyFilePAdES(t *testing.T) {
+	content, err := os.ReadFile("../guard/test_files/gnu-c-manual.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, fingerprint := newSigningKey(t)
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + fingerprint: {Fingerprint: fingerprint, Current: true},
+	}}
+	signer := &user.User{Username: "alice", Email: "alice@example.com"}
+	authority := &fakeAuthority{chain: []*x509.Certificate{signerCertificate(t, signer, privateKey, time.Now())}}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority))
+
+	signed, err := fs.signPDF(context.Background(), content, signer, privateKey)
+	if err != nil {
+		t.Fatalf("signPDF() error = %v", err)
+	}
+
+	if !bytes.HasPrefix(signed, content) || DetectContentType(signed) != PDF {
+		t.Fatal("signed PDF is not an incremental update of the original")
+	}
+
+	res, err := fs.verifyFile(context.Background(), signed, nil)
+	if err != nil {
+		t.Fatalf("verifyFile() error = %v", err)
+	}
+	if res.Format != SignatureFormatPAdES || res.SignBy != "alice" || res.Contact != "alice@example.com" ||
+		res.Signer != SignerCurrentKey || res.KeyFingerprint != fingerprint || res.SignDate.IsZero() ||
+		res.Certificate != CertificateUntrusted || res.Timestamp == nil {
+		t.Errorf("verifyFile() = %+v", res)
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[len(content)/2] ^= 0xff
+	_, err = fs.verifyFile(context.Background(), tampered, nil)
+	if err == nil {
+		t.Error("tampered PDF was accepted")
+	}
+
+	// an update appended after the signature is not covered
+	updated := append(append([]byte{}, signed...), "1 0 obj\nnull\nendobj\n%%EOF\n"...)
+	_, err = fs.verifyFile(context.Background(), updated, nil)
+	if !errors.Is(err, ErrContentModified) {
+		t.Errorf("updated PDF error = %v, want %v", err, ErrContentModified)
+	}
+}
@@ -0,0 +1,189 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// Quota is the storage a user can use in bytes, in total and
+// for each file type. A missing or 0 limit is unlimited.
+type Quota struct {
+	Total int64            `json:"total"`
+	Types map[string]int64 `json:"types"`
+}
+
+// QuotaFromEnv returns the default quota of every user set by the
+// STORAGE_QUOTA and STORAGE_QUOTA_<TYPE> environment variables,
+// in bytes. Quotas are unlimited when unset.
+func QuotaFromEnv() Quota {
+	quota := Quota{
+		Types: make(map[string]int64),
+	}
+
+	quota.Total = quotaFromEnv("STORAGE_QUOTA")
+
+	for fileType := range defaultSizeLimits {
+		limit := quotaFromEnv("STORAGE_QUOTA_" + strings.ToUpper(fileType))
+		if limit > 0 {
+			quota.Types[fileType] = limit
+		}
+	}
+
+	return quota
+}
+
+func quotaFromEnv(name string) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		fmt.Printf("invalid storage quota %v: %v\n", name, value)
+		return 0
+	}
+
+	return limit
+}
+
+// TypeUsage is the storage used by the files of one type. Bytes
+// counts every version of the files, including the ones in the
+// trash, and SharedCopyBytes the copies made by grants created
+// before grants wrapped the file key.
+type TypeUsage struct {
+	Type            string `json:"type"`
+	Files           int64  `json:"files"`
+	Bytes           int64  `json:"bytes"`
+	SharedCopyBytes int64  `json:"shared_copy_bytes"`
+	Quota           int64  `json:"quota"`
+}
+
+// Usage is the storage used by a user, broken down by type.
+type Usage struct {
+	Bytes int64       `json:"bytes"`
+	Quota int64       `json:"quota"`
+	Types []TypeUsage `json:"types"`
+}
+
+// userQuota returns the default quota overridden by
+// the quotas set for the user.
+func (fs *fileService) userQuota(ctx context.Context, userID uint64) (Quota, error) {
+	quota := Quota{
+		Total: fs.quota.Total,
+		Types: make(map[string]int64, len(fs.quota.Types)),
+	}
+	for fileType, limit := range fs.quota.Types {
+		quota.Types[fileType] = limit
+	}
+
+	overrides, err := fs.fileRepository.GetQuotas(ctx, userID)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	for fileType, limit := range overrides {
+		if fileType == "" {
+			quota.Total = limit
+			continue
+		}
+		quota.Types[fileType] = limit
+	}
+
+	return quota, nil
+}
+
+// getUsage returns the storage used by a user and its quotas.
+func (fs *fileService) getUsage(ctx context.Context, userID uint64) (*Usage, error) {
+	quota, err := fs.userQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usages, err := fs.fileRepository.GetUsage(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := newUsage(quota, usages)
+
+	return &usage, nil
+}
+
+// newUsage sums usages, the storage used by
+// a user by type, along with its quota.
+func newUsage(quota Quota, usages []TypeUsage) Usage {
+	usageMap := make(map[string]TypeUsage, len(usages))
+	for _, usage := range usages {
+		usageMap[usage.Type] = usage
+	}
+
+	res := Usage{
+		Quota: quota.Total,
+		Types: []TypeUsage{},
+	}
+
+	for _, fileType := range []string{IDCard, ProfilePicture, Video, Docs, Misc} {
+		usage := usageMap[fileType]
+		usage.Type = fileType
+		usage.Quota = quota.Types[fileType]
+
+		res.Bytes += usage.Bytes + usage.SharedCopyBytes
+		res.Types = append(res.Types, usage)
+	}
+
+	return res
+}
+
+// check returns ErrQuotaExceeded when storing size
+// more bytes of fileType exceeds a quota of u.
+func (u Usage) check(fileType string, size int64) error {
+	if u.Quota > 0 && u.Bytes+size > u.Quota {
+		return fmt.Errorf(
+			"%w: %v of %v bytes used, %v more bytes do not fit",
+			ErrQuotaExceeded, u.Bytes, u.Quota, size,
+		)
+	}
+
+	for _, typeUsage := range u.Types {
+		used := typeUsage.Bytes + typeUsage.SharedCopyBytes
+		if typeUsage.Type == fileType && typeUsage.Quota > 0 && used+size > typeUsage.Quota {
+			return fmt.Errorf(
+				"%w for %v: %v of %v bytes used, %v more bytes do not fit",
+				ErrQuotaExceeded, fileType, used, typeUsage.Quota, size,
+			)
+		}
+	}
+
+	return nil
+}
+
+// checkQuota returns ErrQuotaExceeded when storing size more bytes
+// of fileType exceeds a quota of the user, before the content is
+// written. The quota is returned for the repository to check it
+// again when the version is created, along with concurrent writes.
+func (fs *fileService) checkQuota(ctx context.Context, userID uint64, fileType string, size int64) (Quota, error) {
+	quota, err := fs.userQuota(ctx, userID)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	usages, err := fs.fileRepository.GetUsage(ctx, userID)
+	if err != nil {
+		return Quota{}, err
+	}
+
+	return quota, newUsage(quota, usages).check(fileType, size)
+}
+
+// setQuota sets the quota of a user for a type, or for all
+// files when the type is empty. A limit of 0 is unlimited.
+func (fs *fileService) setQuota(ctx context.Context, request SetQuotaRequest) error {
+	return fs.fileRepository.SetQuota(ctx, request.UserID, request.Type, request.MaxBytes)
+}
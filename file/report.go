@@ -0,0 +1,425 @@
+package file
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encryption/ca"
+	"encryption/guard/cms"
+	"encryption/guard/timestamp"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// Verdicts of a verification report.
+//
+// - valid : every signature and its checks hold.
+// - valid_with_warnings : the signatures hold, but the reasons of the
+// report weaken them, e.g. an unknown signer or a missing timestamp.
+// - invalid : a check failed, the reasons tell which.
+// - revoked : a signature holds but was revoked by its signer.
+// - unsigned : the file holds no signature.
+const (
+	VerdictValid    string = "valid"
+	VerdictWarning  string = "valid_with_warnings"
+	VerdictInvalid  string = "invalid"
+	VerdictRevoked  string = "revoked"
+	VerdictUnsigned string = "unsigned"
+)
+
+// Outcomes of a check of a signature.
+//
+// - passed : the check holds.
+// - failed : the check does not hold, the signature is invalid.
+// - absent : the signature holds nothing to check, e.g. no timestamp.
+// - not_checked : an earlier check failed.
+const (
+	CheckPassed     string = "passed"
+	CheckFailed     string = "failed"
+	CheckAbsent     string = "absent"
+	CheckNotChecked string = "not_checked"
+)
+
+// Reason codes of a verification report, the warnings are
+// unknown_signer, untrusted_certificate and no_timestamp.
+const (
+	ReasonNoSignature          string = "no_signature"
+	ReasonMalformedSignature   string = "malformed_signature"
+	ReasonUnsupportedSignature string = "unsupported_signature"
+	ReasonSignatureMismatch    string = "signature_mismatch"
+	ReasonContentNotCovered    string = "content_not_covered"
+	ReasonContentModified      string = "content_modified"
+	ReasonKeyMismatch          string = "key_mismatch"
+	ReasonTimestampInvalid     string = "timestamp_invalid"
+	ReasonTimestampMismatch    string = "timestamp_mismatch"
+	ReasonCertificateInvalid   string = "certificate_invalid"
+	ReasonCertificateRevoked   string = "certificate_revoked"
+	ReasonSignatureRevoked     string = "signature_revoked"
+	ReasonVerificationError    string = "verification_error"
+	ReasonUnknownSigner        string = "unknown_signer"
+	ReasonUntrustedCertificate string = "untrusted_certificate"
+	ReasonNoTimestamp          string = "no_timestamp"
+)
+
+// signatureAlgorithm is the algorithm of every signature format.
+const signatureAlgorithm = "RSASSA-PKCS1-v1_5 with SHA-256"
+
+// VerificationReport details the verification of the signatures of a
+// file, along with a verdict and the reasons for it.
+type VerificationReport struct {
+	Verdict string   `json:"verdict"`
+	Reasons []Reason `json:"reasons,omitempty"`
+
+	// Signatures are the signatures checked, oldest first. A failed
+	// check stops the verification, later signatures are left out.
+	// Revocations are checked once every signature verified.
+	Signatures []*SignatureReport `json:"signatures"`
+
+	// allowRevokedKeys accepts signatures by revoked keys, their
+	// signers still revoke them once they rotated the key.
+	allowRevokedKeys bool
+}
+
+// Reason is a reason of the verdict of a report.
+type Reason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Signature is the index of the signature the
+	// reason is about, nil for the whole file.
+	Signature *int `json:"signature,omitempty"`
+}
+
+// SignatureReport details the checks of a signature.
+type SignatureReport struct {
+	// ID identifies the signature, the hex encoded sha-256
+	// of its value. Signers revoke signatures by it.
+	ID string `json:"id,omitempty"`
+
+	Format    string       `json:"format"`
+	Algorithm string       `json:"algorithm"`
+	Signer    SignerReport `json:"signer"`
+
+	// SignDate is the signing time claimed by the signer.
+	SignDate *time.Time `json:"sign_date,omitempty"`
+
+	// ByteRange holds the offset and length pairs
+	// of the bytes of the file the signature covers.
+	ByteRange []int `json:"byte_range,omitempty"`
+
+	// SignatureValue is the check of the signature value
+	// against the public key of the signer.
+	SignatureValue string           `json:"signature_value"`
+	ContentDigest  DigestCheck      `json:"content_digest"`
+	Timestamp      TimestampCheck   `json:"timestamp"`
+	Certificate    CertificateCheck `json:"certificate"`
+
+	// Revocation is the revocation of the signature
+	// by its signer, nil while the signature stands.
+	Revocation *SignatureRevocation `json:"revocation,omitempty"`
+
+	allowRevokedKey bool
+}
+
+// SignerReport is the identity of a signer.
+type SignerReport struct {
+	Name           string `json:"name"`
+	Contact        string `json:"contact,omitempty"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+
+	// Known is true when the key is registered for the user Name,
+	// Status tells whether it is its current key.
+	Known  bool   `json:"known"`
+	Status string `json:"status,omitempty"`
+}
+
+// DigestCheck compares the digest a signature holds with
+// the hex encoded sha-256 of the content it covers.
+type DigestCheck struct {
+	Status string `json:"status"`
+	Signed string `json:"signed,omitempty"`
+	Actual string `json:"actual,omitempty"`
+}
+
+// TimestampCheck is the check of the timestamp of a signature.
+type TimestampCheck struct {
+	Status    string     `json:"status"`
+	Time      *time.Time `json:"time,omitempty"`
+	Authority string     `json:"authority,omitempty"`
+}
+
+// CertificateCheck is the check of the certificate of a signer and
+// of the revocation of its key. Embedded signatures only check the
+// revocation.
+type CertificateCheck struct {
+	Status     string     `json:"status"`
+	Trust      string     `json:"trust,omitempty"`
+	Revocation string     `json:"revocation"`
+	Subject    string     `json:"subject,omitempty"`
+	Issuer     string     `json:"issuer,omitempty"`
+	Serial     string     `json:"serial,omitempty"`
+	NotBefore  *time.Time `json:"not_before,omitempty"`
+	NotAfter   *time.Time `json:"not_after,omitempty"`
+}
+
+// addSignature adds the report of a signature in format,
+// none of its checks done yet.
+func (r *VerificationReport) addSignature(format string) *SignatureReport {
+	sr := &SignatureReport{
+		Format:          format,
+		Algorithm:       signatureAlgorithm,
+		SignatureValue:  CheckNotChecked,
+		ContentDigest:   DigestCheck{Status: CheckNotChecked},
+		Timestamp:       TimestampCheck{Status: CheckNotChecked},
+		Certificate:     CertificateCheck{Status: CheckNotChecked, Revocation: CheckNotChecked},
+		allowRevokedKey: r.allowRevokedKeys,
+	}
+	r.Signatures = append(r.Signatures, sr)
+
+	return sr
+}
+
+// conclude sets the verdict of the report from err, the error
+// the verification failed with, and from the checks it reports.
+func (r *VerificationReport) conclude(err error) {
+	if errors.Is(err, ErrNoSignature) {
+		r.Verdict = VerdictUnsigned
+		r.Reasons = append(r.Reasons, Reason{Code: ReasonNoSignature, Message: err.Error()})
+		return
+	}
+
+	if err != nil {
+		r.Verdict = VerdictInvalid
+		if errors.Is(err, ErrSignatureRevoked) {
+			r.Verdict = VerdictRevoked
+		}
+
+		reason := Reason{Code: reasonCode(err), Message: err.Error()}
+		if len(r.Signatures) > 0 {
+			index := len(r.Signatures) - 1
+			for i, sr := range r.Signatures {
+				if sr.Revocation != nil {
+					index = i
+					break
+				}
+			}
+			reason.Signature = &index
+		}
+		r.Reasons = append(r.Reasons, reason)
+
+		return
+	}
+
+	for i, sr := range r.Signatures {
+		index := i
+
+		if !sr.Signer.Known {
+			r.Reasons = append(r.Reasons, Reason{
+				Code:      ReasonUnknownSigner,
+				Message:   "signing key is not registered for " + sr.Signer.Name,
+				Signature: &index,
+			})
+		}
+
+		if sr.Certificate.Trust == CertificateUntrusted {
+			r.Reasons = append(r.Reasons, Reason{
+				Code:      ReasonUntrustedCertificate,
+				Message:   "signer certificate is not issued by the certificate authority",
+				Signature: &index,
+			})
+		}
+
+		if sr.Timestamp.Status == CheckAbsent {
+			r.Reasons = append(r.Reasons, Reason{
+				Code:      ReasonNoTimestamp,
+				Message:   "signing time is only claimed by the signer",
+				Signature: &index,
+			})
+		}
+	}
+
+	r.Verdict = VerdictValid
+	if len(r.Reasons) > 0 {
+		r.Verdict = VerdictWarning
+	}
+}
+
+// reasonCode returns the reason code of a verification error.
+func reasonCode(err error) string {
+	var invalidCertificate x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, errMalformedSignature),
+		errors.Is(err, cms.ErrNotSignedData),
+		errors.Is(err, cms.ErrNoSigners),
+		errors.Is(err, cms.ErrSignerNotFound),
+		errors.Is(err, cms.ErrMissingAttribute),
+		errors.Is(err, cms.ErrContentTypeInvalid),
+		errors.Is(err, cms.ErrCounterSignature):
+		return ReasonMalformedSignature
+	case errors.Is(err, errUnsupportedPDFSignature),
+		errors.Is(err, cms.ErrUnsupportedAlgo):
+		return ReasonUnsupportedSignature
+	case errors.Is(err, rsa.ErrVerification):
+		return ReasonSignatureMismatch
+	case errors.Is(err, ErrContentNotCovered):
+		return ReasonContentNotCovered
+	case errors.Is(err, ErrContentModified),
+		errors.Is(err, cms.ErrDigestMismatch):
+		return ReasonContentModified
+	case errors.Is(err, ErrKeyMismatch):
+		return ReasonKeyMismatch
+	case errors.Is(err, ErrTimestampMismatch):
+		return ReasonTimestampMismatch
+	case errors.Is(err, timestamp.ErrNotTimestamp),
+		errors.Is(err, timestamp.ErrImprintMismatch),
+		errors.Is(err, timestamp.ErrUnsupportedAlgo),
+		errors.Is(err, timestamp.ErrNotTimestamping),
+		errors.Is(err, timestamp.ErrUntrustedTSA):
+		return ReasonTimestampInvalid
+	case errors.Is(err, ca.ErrCertificateRevoked):
+		return ReasonCertificateRevoked
+	case errors.Is(err, ErrSignatureRevoked):
+		return ReasonSignatureRevoked
+	case errors.As(err, &invalidCertificate):
+		return ReasonCertificateInvalid
+	}
+
+	return ReasonVerificationError
+}
+
+// checkStatus returns the outcome of a check failing with err.
+func checkStatus(err error) string {
+	if err != nil {
+		return CheckFailed
+	}
+	return CheckPassed
+}
+
+// setCertificate records the identity of the certificate of a signer.
+func (sr *SignatureReport) setCertificate(cert *x509.Certificate) {
+	notBefore, notAfter := cert.NotBefore, cert.NotAfter
+
+	sr.Certificate.Subject = cert.Subject.String()
+	sr.Certificate.Issuer = cert.Issuer.String()
+	sr.Certificate.Serial = serialString(cert.SerialNumber)
+	sr.Certificate.NotBefore = &notBefore
+	sr.Certificate.NotAfter = &notAfter
+}
+
+// setCertificateCheck records the outcome of the check of a
+// certificate, or of a key, that failed with err.
+func (sr *SignatureReport) setCertificateCheck(trust string, err error) {
+	sr.Certificate.Trust = trust
+	sr.Certificate.Status = checkStatus(err)
+	sr.Certificate.Revocation = revocationStatus(err)
+}
+
+// keyError returns err, the error the certificate or key check of the
+// signer failed with, or nil when the report accepts revoked keys and
+// the key of the signer was revoked.
+func (sr *SignatureReport) keyError(err error) error {
+	if sr.allowRevokedKey && errors.Is(err, ca.ErrCertificateRevoked) {
+		return nil
+	}
+	return err
+}
+
+// revocationStatus returns the outcome of the revocation check of
+// a key from err, the error its certificate check failed with.
+func revocationStatus(err error) string {
+	switch {
+	case err == nil:
+		return CheckPassed
+	case errors.Is(err, ca.ErrCertificateRevoked):
+		return CheckFailed
+	}
+	return CheckNotChecked
+}
+
+// describeSigner records the identity the certificate of signer
+// claims, before its signature is verified.
+func (sr *SignatureReport) describeSigner(signer cms.SignerInfo) {
+	sr.ID = signatureID(signer.Signature)
+
+	if signer.Certificate == nil {
+		return
+	}
+
+	sr.Signer.Name = signer.Certificate.Subject.CommonName
+	if len(signer.Certificate.EmailAddresses) > 0 {
+		sr.Signer.Contact = signer.Certificate.EmailAddresses[0]
+	}
+
+	fingerprint, err := signingkey.Fingerprint(signer.Certificate.PublicKey)
+	if err == nil {
+		sr.Signer.KeyFingerprint = fingerprint
+	}
+
+	if signingTime, ok := signer.SigningTime(); ok {
+		sr.SignDate = &signingTime
+	}
+
+	sr.setCertificate(signer.Certificate)
+}
+
+// checkSignedData records the checks of the signature of signer over
+// data, err is the error its verification failed with. The signature
+// value is only checked once the digest matches.
+func (sr *SignatureReport) checkSignedData(signer cms.SignerInfo, data []byte, err error) {
+	digest, digestErr := signer.MessageDigest()
+	if digestErr != nil {
+		return
+	}
+
+	sr.setDigest(hex.EncodeToString(digest), contentDigest(data))
+	if sr.ContentDigest.Status == CheckPassed {
+		sr.SignatureValue = checkStatus(err)
+	}
+}
+
+// setTimestamp records the outcome of the check of the
+// timestamp of a signature, token is nil when it has none.
+func (sr *SignatureReport) setTimestamp(token *timestamp.Token, err error) {
+	switch {
+	case err != nil:
+		sr.Timestamp.Status = CheckFailed
+	case token == nil:
+		sr.Timestamp.Status = CheckAbsent
+	default:
+		genTime := token.GenTime
+		sr.Timestamp.Status = CheckPassed
+		sr.Timestamp.Time = &genTime
+		sr.Timestamp.Authority = token.Certificate.Subject.CommonName
+	}
+}
+
+// setDigest records the check of the digest a
+// signature holds against the actual one.
+func (sr *SignatureReport) setDigest(signed string, actual string) {
+	sr.ContentDigest.Signed = signed
+	sr.ContentDigest.Actual = actual
+
+	sr.ContentDigest.Status = CheckPassed
+	if signed != actual {
+		sr.ContentDigest.Status = CheckFailed
+	}
+}
+
+// setSigner records the resolved signer of a valid signature.
+func (sr *SignatureReport) setSigner(res *VerifyResult) {
+	sr.Signer.Name = res.SignBy
+	sr.Signer.Contact = res.Contact
+	sr.Signer.KeyFingerprint = res.EmbeddedKeyFingerprint
+	sr.Signer.Known = res.Signer != SignerUnknown
+	sr.Signer.Status = res.Signer
+}
+
+func serialString(serial *big.Int) string {
+	if serial == nil {
+		return ""
+	}
+	return hex.EncodeToString(serial.Bytes())
+}
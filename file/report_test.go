@@ -0,0 +1,79 @@
+package file
+
+import (
+	"context"
+	"crypto/x509"
+	"encryption/ca"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReportFile(t *testing.T) {
+	ctx := context.Background()
+	privateKey, fingerprint := newSigningKey(t)
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + fingerprint: {Fingerprint: fingerprint, Current: true},
+	}}
+	alice := &user.User{Username: "alice", Email: "alice@example.com"}
+	authority := &fakeAuthority{chain: []*x509.Certificate{signerCertificate(t, alice, privateKey, time.Now())}}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority))
+
+	report := fs.reportFile(ctx, []byte("plain text"), nil)
+	if report.Verdict != VerdictUnsigned || len(report.Reasons) != 1 || report.Reasons[0].Code != ReasonNoSignature {
+		t.Errorf("unsigned report = %+v", report)
+	}
+
+	content, err := os.ReadFile("../guard/test_files/gnu-c-manual.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := fs.signPDF(ctx, content, alice, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate is not issued by the CA
+	report = fs.reportFile(ctx, signed, nil)
+	if report.Verdict != VerdictWarning || len(report.Reasons) != 1 || report.Reasons[0].Code != ReasonUntrustedCertificate {
+		t.Fatalf("signed report = %v %+v", report.Verdict, report.Reasons)
+	}
+
+	sr := report.Signatures[0]
+	if sr.Format != SignatureFormatPAdES || sr.Signer.Name != "alice" || sr.Signer.KeyFingerprint != fingerprint ||
+		!sr.Signer.Known || sr.Signer.Status != SignerCurrentKey || len(sr.ByteRange) != 4 {
+		t.Errorf("signature report = %+v", sr)
+	}
+	if sr.SignatureValue != CheckPassed || sr.ContentDigest.Status != CheckPassed || sr.Timestamp.Status != CheckPassed ||
+		sr.Timestamp.Time == nil || sr.Certificate.Status != CheckPassed || sr.Certificate.Revocation != CheckPassed {
+		t.Errorf("signature checks = %+v", sr)
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[len(content)/2] ^= 0xff
+
+	report = fs.reportFile(ctx, tampered, nil)
+	sr = report.Signatures[0]
+	if report.Verdict != VerdictInvalid || report.Reasons[0].Code != ReasonContentModified || *report.Reasons[0].Signature != 0 {
+		t.Errorf("tampered report = %v %+v", report.Verdict, report.Reasons)
+	}
+	if sr.Signer.Name != "alice" || sr.ContentDigest.Status != CheckFailed || sr.SignatureValue != CheckNotChecked ||
+		sr.Timestamp.Status != CheckNotChecked {
+		t.Errorf("tampered signature report = %+v", sr)
+	}
+
+	revokedAt := time.Now().Add(-time.Hour)
+	authority.revoked = map[string]ca.Certificate{
+		fingerprint: {Fingerprint: fingerprint, RevokedAt: &revokedAt, RevocationReason: ca.ReasonKeyCompromise},
+	}
+
+	report = fs.reportFile(ctx, signed, nil)
+	sr = report.Signatures[0]
+	if report.Verdict != VerdictInvalid || report.Reasons[0].Code != ReasonCertificateRevoked ||
+		sr.Certificate.Revocation != CheckFailed || sr.Timestamp.Status != CheckPassed {
+		t.Errorf("revoked report = %v %+v %+v", report.Verdict, report.Reasons, sr.Certificate)
+	}
+}
@@ -2,7 +2,10 @@ package file
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,9 +23,23 @@ func NewFileRepository(db DB) *fileRepository {
 	}
 }
 
-func (fr *fileRepository) Create(ctx context.Context, file File) error {
+// Create creates a file with its first version
+// and returns the id of the file. ErrQuotaExceeded
+// is returned when it does not fit in quota.
+func (fr *fileRepository) Create(ctx context.Context, file File, quota Quota) (uint64, error) {
 	var err error
 
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = fr.lockQuota(ctx, tx, file.UserID, file.Type, file.Size, quota)
+	if err != nil {
+		return 0, err
+	}
+
 	stmt := `
 	INSERT INTO
 		files (
@@ -30,17 +47,32 @@ func (fr *fileRepository) Create(ctx context.Context, file File) error {
 			filename,
 			type,
 			filepath,
-			key_reference
+			key_reference,
+			size,
+			thumbnail_path,
+			scan_status,
+			scan_signature,
+			scanned_at,
+			folder_id,
+			checksum
 		)
 	VALUES (
 		$1,
 		$2,
 		$3,
 		$4,
-		$5
+		$5,
+		$6,
+		NULLIF($7, ''),
+		$8,
+		NULLIF($9, ''),
+		$10,
+		NULLIF($11, 0),
+		$12
 	)
+	RETURNING id
 	`
-	_, err = fr.db.GetConn().Exec(
+	err = tx.QueryRow(
 		ctx,
 		stmt,
 		file.UserID,
@@ -48,12 +80,40 @@ func (fr *fileRepository) Create(ctx context.Context, file File) error {
 		file.Type,
 		file.Filepath,
 		file.KeyReference,
-	)
+		file.Size,
+		file.ThumbnailPath,
+		file.ScanStatus,
+		file.ScanSignature,
+		file.ScannedAt,
+		int64(file.FolderID),
+		file.Checksum,
+	).Scan(&file.ID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	err = fr.insertVersion(ctx, tx, Version{
+		FileID:        file.ID,
+		Version:       1,
+		Filename:      file.Filename,
+		Filepath:      file.Filepath,
+		KeyReference:  file.KeyReference,
+		Size:          file.Size,
+		IsSigned:      file.IsSigned,
+		ThumbnailPath: file.ThumbnailPath,
+		ScanStatus:    file.ScanStatus,
+		Checksum:      file.Checksum,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return file.ID, nil
 }
 
 func (fr *fileRepository) Get(ctx context.Context, id uint64) (File, error) {
@@ -65,20 +125,42 @@ func (fr *fileRepository) Get(ctx context.Context, id uint64) (File, error) {
 	 		id, 
 			user_id,
 			filename,
+			type,
 			filepath,
 			is_signed,
-			key_reference 
+			version,
+			key_reference,
+			size,
+			created_at,
+			COALESCE(thumbnail_path, ''),
+			scan_status,
+			COALESCE(scan_signature, ''),
+			scanned_at,
+			COALESCE(folder_id, 0),
+			checksum,
+			damaged
 	 FROM files 
-	 WHERE id = $1
+	 WHERE id = $1 AND deleted_at IS NULL
 	 `
 
 	err = fr.db.GetConn().QueryRow(ctx, stmt, id).Scan(
 		&file.ID,
 		&file.UserID,
 		&file.Filename,
+		&file.Type,
 		&file.Filepath,
 		&file.IsSigned,
+		&file.Version,
 		&file.KeyReference,
+		&file.Size,
+		&file.CreatedAt,
+		&file.ThumbnailPath,
+		&file.ScanStatus,
+		&file.ScanSignature,
+		&file.ScannedAt,
+		&file.FolderID,
+		&file.Checksum,
+		&file.Damaged,
 	)
 	if err != nil {
 		return File{}, err
@@ -87,24 +169,106 @@ func (fr *fileRepository) Get(ctx context.Context, id uint64) (File, error) {
 	return file, nil
 }
 
-func (fr *fileRepository) List(ctx context.Context, userID uint64, fileType string) ([]File, error) {
+// List lists the files of filter.UserID ordered by the sort column
+// and id, starting after filter.After. It also returns the total
+// number of files matching the filter regardless of the pagination.
+func (fr *fileRepository) List(ctx context.Context, filter ListFilter) ([]File, uint64, error) {
 	var files []File
+	var total uint64
 	var err error
 
+	where := `
+		 WHERE user_id = $1 AND deleted_at IS NULL
+		 `
+
+	ctr := 2
+	args := []any{filter.UserID}
+
+	if filter.Type != "" {
+		where += fmt.Sprintf(" AND type = $%v", ctr)
+		args = append(args, filter.Type)
+		ctr++
+	}
+
+	if filter.Search != "" {
+		where += fmt.Sprintf(" AND strpos(lower(filename), lower($%v)) > 0", ctr)
+		args = append(args, filter.Search)
+		ctr++
+	}
+
+	if filter.Signed != nil {
+		where += fmt.Sprintf(" AND is_signed = $%v", ctr)
+		args = append(args, *filter.Signed)
+		ctr++
+	}
+
+	if filter.FolderID != nil {
+		where += fmt.Sprintf(" AND COALESCE(folder_id, 0) = $%v", ctr)
+		args = append(args, int64(*filter.FolderID))
+		ctr++
+	}
+
+	countStmt := `SELECT count(*) FROM files` + where
+
+	err = fr.db.GetConn().QueryRow(ctx, countStmt, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var sortColumn string
+	switch filter.SortBy {
+	case SortByName:
+		sortColumn = "filename"
+	case SortBySize:
+		sortColumn = "size"
+	default:
+		sortColumn = "created_at"
+	}
+
+	direction, comparator := "ASC", ">"
+	if filter.Desc {
+		direction, comparator = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		value, err := filter.After.SortValue()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		where += fmt.Sprintf(
+			" AND (%v, id) %v ($%v, $%v)",
+			sortColumn,
+			comparator,
+			ctr,
+			ctr+1,
+		)
+		args = append(args, value, filter.After.ID)
+		ctr += 2
+	}
+
 	stmt := `
 		SELECT
 				id, 
 				filename,
 				type,
-				is_signed
+				is_signed,
+				version,
+				size,
+				created_at,
+				scan_status,
+				COALESCE(folder_id, 0),
+				damaged
 		 FROM files 
-		 WHERE type = $1
-		 AND user_id = $2
-		 `
+		 ` + where + fmt.Sprintf(`
+		 ORDER BY %v %v, id %v
+		 LIMIT $%v
+		 `, sortColumn, direction, direction, ctr)
+	args = append(args, filter.Limit)
 
-	rows, err := fr.db.GetConn().Query(ctx, stmt, fileType, userID)
+	rows, err := fr.db.GetConn().Query(ctx, stmt, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -115,18 +279,24 @@ func (fr *fileRepository) List(ctx context.Context, userID uint64, fileType stri
 			&f.Filename,
 			&f.Type,
 			&f.IsSigned,
+			&f.Version,
+			&f.Size,
+			&f.CreatedAt,
+			&f.ScanStatus,
+			&f.FolderID,
+			&f.Damaged,
 		)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		files = append(files, f)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return files, nil
+	return files, total, nil
 }
 
 func (fr *fileRepository) UpdateSignedStatus(ctx context.Context, file File) error {
@@ -150,20 +320,1247 @@ func (fr *fileRepository) UpdateSignedStatus(ctx context.Context, file File) err
 	return nil
 }
 
+// UpdateFolder moves a file to folderID, or
+// to the top level when folderID is 0.
+func (fr *fileRepository) UpdateFolder(ctx context.Context, file File) error {
+	stmt := `
+	UPDATE
+		files SET
+			folder_id = NULLIF($2, 0)
+	WHERE id = $1
+	`
+
+	_, err := fr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		file.ID,
+		int64(file.FolderID),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListInFolder lists the files in a folder and its subfolders.
+func (fr *fileRepository) ListInFolder(ctx context.Context, folderID uint64) ([]File, error) {
+	var files []File
+
+	stmt := `
+		WITH RECURSIVE subfolders AS (
+			SELECT id FROM folders WHERE id = $1
+			UNION
+			SELECT f.id FROM folders f
+			JOIN subfolders s ON f.parent_id = s.id
+		)
+		SELECT
+				id,
+				user_id,
+				filename,
+				folder_id
+		 FROM files
+		 WHERE folder_id IN (SELECT id FROM subfolders)
+		 	AND deleted_at IS NULL
+		 ORDER BY id
+		 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f File
+		err := rows.Scan(
+			&f.ID,
+			&f.UserID,
+			&f.Filename,
+			&f.FolderID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (fr *fileRepository) UpdateScanStatus(ctx context.Context, file File) error {
+	// the current version is updated along with the file
+	stmt := `
+	WITH f AS (
+		UPDATE
+			files SET
+				scan_status = $2,
+				scan_signature = NULLIF($3, ''),
+				scanned_at = $4
+		WHERE id = $1
+		RETURNING id, version
+	)
+	UPDATE
+		file_versions v SET
+			scan_status = $2
+	FROM f
+	WHERE v.file_id = f.id
+	AND v.version = f.version
+	`
+
+	_, err := fr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		file.ID,
+		file.ScanStatus,
+		file.ScanSignature,
+		file.ScannedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListByScanStatus lists the files of every user
+// having the given scan status.
+func (fr *fileRepository) ListByScanStatus(ctx context.Context, status string) ([]File, error) {
+	var files []File
+
+	stmt := `
+		SELECT
+				id,
+				user_id,
+				filepath,
+				key_reference
+		 FROM files
+		 WHERE scan_status = $1 AND deleted_at IS NULL
+		 ORDER BY id
+		 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f File
+		err := rows.Scan(
+			&f.ID,
+			&f.UserID,
+			&f.Filepath,
+			&f.KeyReference,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Delete deletes a file with its versions, permissions, permission
+// requests, share links, signing requests and signing sessions. The
+// blobs and keys are not deleted.
 func (fr *fileRepository) Delete(ctx context.Context, id uint64) error {
 	var err error
 
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM file_versions WHERE file_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM file_permissions WHERE file_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM file_notifications WHERE file_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM share_links WHERE file_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM signing_requests WHERE file_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM signing_sessions WHERE file_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
 	stmt := `
 	DELETE  
 	 FROM files 
 	 WHERE id = $1
 	 `
 
-	_, err = fr.db.GetConn().Exec(ctx, stmt, id)
+	_, err = tx.Exec(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Trash moves a file to the trash.
+func (fr *fileRepository) Trash(ctx context.Context, id uint64) error {
+	stmt := `
+	UPDATE
+		files SET
+			deleted_at = now()
+	WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	_, err := fr.db.GetConn().Exec(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Restore moves a file out of the trash.
+func (fr *fileRepository) Restore(ctx context.Context, id uint64) error {
+	stmt := `
+	UPDATE
+		files SET
+			deleted_at = NULL
+	WHERE id = $1
+	`
+
+	_, err := fr.db.GetConn().Exec(ctx, stmt, id)
 	if err != nil {
 		return err
 	}
 
 	return nil
+}
+
+// GetTrashed gets a file in the trash.
+func (fr *fileRepository) GetTrashed(ctx context.Context, id uint64) (File, error) {
+	var file File
+
+	stmt := `
+	SELECT
+			id,
+			user_id,
+			filename,
+			type,
+			COALESCE(folder_id, 0),
+			key_reference,
+			deleted_at
+	 FROM files
+	 WHERE id = $1 AND deleted_at IS NOT NULL
+	 `
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, id).Scan(
+		&file.ID,
+		&file.UserID,
+		&file.Filename,
+		&file.Type,
+		&file.FolderID,
+		&file.KeyReference,
+		&file.DeletedAt,
+	)
+	if err != nil {
+		return File{}, err
+	}
+
+	return file, nil
+}
+
+// ListTrash lists the files in the trash of a user, or the files
+// trashed before the given time of all users when userID is 0.
+func (fr *fileRepository) ListTrash(ctx context.Context, userID uint64, before time.Time) ([]File, error) {
+	var files []File
+
+	stmt := `
+		SELECT
+				id,
+				user_id,
+				filename,
+				type,
+				is_signed,
+				version,
+				size,
+				created_at,
+				COALESCE(folder_id, 0),
+				deleted_at
+		 FROM files
+		 WHERE deleted_at IS NOT NULL
+		 	AND ($1 = 0 OR user_id = $1)
+		 	AND deleted_at < $2
+		 ORDER BY deleted_at DESC, id DESC
+		 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, int64(userID), before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f File
+		err := rows.Scan(
+			&f.ID,
+			&f.UserID,
+			&f.Filename,
+			&f.Type,
+			&f.IsSigned,
+			&f.Version,
+			&f.Size,
+			&f.CreatedAt,
+			&f.FolderID,
+			&f.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (fr *fileRepository) insertVersion(ctx context.Context, tx pgx.Tx, version Version) error {
+	stmt := `
+	INSERT INTO
+		file_versions (
+			file_id,
+			version,
+			filename,
+			filepath,
+			key_reference,
+			size,
+			is_signed,
+			thumbnail_path,
+			scan_status,
+			checksum,
+			signature_path
+		)
+	VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6,
+		$7,
+		NULLIF($8, ''),
+		$9,
+		$10,
+		NULLIF($11, '')
+	)
+	`
+
+	_, err := tx.Exec(
+		ctx,
+		stmt,
+		version.FileID,
+		version.Version,
+		version.Filename,
+		version.Filepath,
+		version.KeyReference,
+		version.Size,
+		version.IsSigned,
+		version.ThumbnailPath,
+		version.ScanStatus,
+		version.Checksum,
+		version.SignaturePath,
+	)
+
+	return err
+}
+
+// CreateVersion adds a version after the latest version of the file
+// and makes it the current version. The number of the created
+// version is returned, ErrQuotaExceeded when it does not fit in
+// the quota of the owner.
+func (fr *fileRepository) CreateVersion(ctx context.Context, version Version, quota Quota) (int, error) {
+	var err error
+
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the file to serialize version numbers
+	var latest int
+	var userID uint64
+	var fileType string
+	err = tx.QueryRow(
+		ctx,
+		`SELECT version, user_id, type FROM files WHERE id = $1 FOR UPDATE`,
+		version.FileID,
+	).Scan(&latest, &userID, &fileType)
+	if err != nil {
+		return 0, err
+	}
+
+	err = fr.lockQuota(ctx, tx, userID, fileType, version.Size, quota)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM file_versions WHERE file_id = $1`,
+		version.FileID,
+	).Scan(&version.Version)
+	if err != nil {
+		return 0, err
+	}
+	version.Version = max(version.Version, latest) + 1
+
+	err = fr.insertVersion(ctx, tx, version)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `
+	UPDATE
+		files SET
+			version = $2,
+			filename = $3,
+			filepath = $4,
+			key_reference = $5,
+			size = $6,
+			is_signed = $7,
+			thumbnail_path = NULLIF($8, ''),
+			scan_status = $9,
+			checksum = $10,
+			damaged = FALSE
+	WHERE id = $1
+	`
+
+	_, err = tx.Exec(
+		ctx,
+		stmt,
+		version.FileID,
+		version.Version,
+		version.Filename,
+		version.Filepath,
+		version.KeyReference,
+		version.Size,
+		version.IsSigned,
+		version.ThumbnailPath,
+		version.ScanStatus,
+		version.Checksum,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return version.Version, nil
+}
+
+func (fr *fileRepository) GetVersion(ctx context.Context, fileID uint64, version int) (Version, error) {
+	var v Version
+
+	stmt := `
+	SELECT
+			id,
+			file_id,
+			version,
+			filename,
+			filepath,
+			key_reference,
+			size,
+			is_signed,
+			COALESCE(thumbnail_path, ''),
+			scan_status,
+			checksum,
+			damaged,
+			COALESCE(signature_path, ''),
+			created_at
+	 FROM file_versions
+	 WHERE file_id = $1
+	 AND version = $2
+	 `
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, fileID, version).Scan(
+		&v.ID,
+		&v.FileID,
+		&v.Version,
+		&v.Filename,
+		&v.Filepath,
+		&v.KeyReference,
+		&v.Size,
+		&v.IsSigned,
+		&v.ThumbnailPath,
+		&v.ScanStatus,
+		&v.Checksum,
+		&v.Damaged,
+		&v.SignaturePath,
+		&v.CreatedAt,
+	)
+	if err != nil {
+		return Version{}, err
+	}
+
+	return v, nil
+}
+
+// ListVersions lists the versions of a file, latest first.
+func (fr *fileRepository) ListVersions(ctx context.Context, fileID uint64) ([]Version, error) {
+	var versions []Version
+
+	stmt := `
+	SELECT
+			id,
+			file_id,
+			version,
+			filename,
+			filepath,
+			key_reference,
+			size,
+			is_signed,
+			COALESCE(thumbnail_path, ''),
+			scan_status,
+			damaged,
+			COALESCE(signature_path, ''),
+			created_at
+	 FROM file_versions
+	 WHERE file_id = $1
+	 ORDER BY version DESC
+	 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v Version
+		err := rows.Scan(
+			&v.ID,
+			&v.FileID,
+			&v.Version,
+			&v.Filename,
+			&v.Filepath,
+			&v.KeyReference,
+			&v.Size,
+			&v.IsSigned,
+			&v.ThumbnailPath,
+			&v.ScanStatus,
+			&v.Damaged,
+			&v.SignaturePath,
+			&v.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// SetSignature stores the detached signature of a version and marks
+// it signed, along with the file when it is its current version.
+func (fr *fileRepository) SetSignature(ctx context.Context, fileID uint64, version int, signaturePath string) error {
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	stmt := `
+	UPDATE
+		file_versions SET
+			signature_path = $3,
+			is_signed = TRUE
+	WHERE file_id = $1
+	AND version = $2
+	`
+
+	_, err = tx.Exec(ctx, stmt, fileID, version, signaturePath)
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+	UPDATE
+		files SET
+			is_signed = TRUE
+	WHERE id = $1
+	AND version = $2
+	`
+
+	_, err = tx.Exec(ctx, stmt, fileID, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetUsage returns the storage used by the files of a user for each
+// type, counting every version and the legacy copies of grants.
+func (fr *fileRepository) GetUsage(ctx context.Context, userID uint64) ([]TypeUsage, error) {
+	rows, err := fr.db.GetConn().Query(ctx, usageStmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanUsages(rows)
+}
+
+// lockQuota locks the storage of a user until tx ends, writes of the
+// user wait for each other, and returns ErrQuotaExceeded when size
+// more bytes of fileType exceed quota.
+func (fr *fileRepository) lockQuota(ctx context.Context, tx pgx.Tx, userID uint64, fileType string, size int64, quota Quota) error {
+	if quota.Total == 0 && quota.Types[fileType] == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, usageStmt, userID)
+	if err != nil {
+		return err
+	}
+
+	usages, err := scanUsages(rows)
+	if err != nil {
+		return err
+	}
+
+	return newUsage(quota, usages).check(fileType, size)
+}
+
+// usageStmt selects the storage used by a user by type.
+const usageStmt = `
+	SELECT
+			type,
+			SUM(files)::BIGINT,
+			SUM(bytes)::BIGINT,
+			SUM(shared_copy_bytes)::BIGINT
+	 FROM (
+		SELECT
+				f.type,
+				1 AS files,
+				(SELECT COALESCE(SUM(v.size), 0) FROM file_versions v WHERE v.file_id = f.id) AS bytes,
+				0 AS shared_copy_bytes
+		 FROM files f
+		 WHERE f.user_id = $1
+		UNION ALL
+		SELECT
+				f.type,
+				0,
+				0,
+				f.size
+		 FROM file_permissions fp
+		 JOIN files f ON fp.file_id = f.id
+		 WHERE f.user_id = $1
+		 	AND fp.filepath <> ''
+	 ) usage
+	 GROUP BY type
+	 ORDER BY type
+	 `
+
+func scanUsages(rows pgx.Rows) ([]TypeUsage, error) {
+	var usages []TypeUsage
+	defer rows.Close()
+
+	for rows.Next() {
+		var usage TypeUsage
+		err := rows.Scan(
+			&usage.Type,
+			&usage.Files,
+			&usage.Bytes,
+			&usage.SharedCopyBytes,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		usages = append(usages, usage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return usages, nil
+}
+
+// GetQuotas returns the quotas set for a user by type,
+// the empty type being the quota of all files together.
+func (fr *fileRepository) GetQuotas(ctx context.Context, userID uint64) (map[string]int64, error) {
+	quotas := make(map[string]int64)
+
+	stmt := `SELECT type, max_bytes FROM user_quotas WHERE user_id = $1`
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fileType string
+		var maxBytes int64
+		err := rows.Scan(&fileType, &maxBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		quotas[fileType] = maxBytes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return quotas, nil
+}
+
+func (fr *fileRepository) SetQuota(ctx context.Context, userID uint64, fileType string, maxBytes int64) error {
+	stmt := `
+	INSERT INTO user_quotas (user_id, type, max_bytes)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, type) DO UPDATE SET max_bytes = EXCLUDED.max_bytes
+	`
+
+	_, err := fr.db.GetConn().Exec(ctx, stmt, userID, fileType, maxBytes)
+
+	return err
+}
+
+// CreateSigningRequest creates a signing request with its
+// co-signers and returns the id of the request.
+func (fr *fileRepository) CreateSigningRequest(ctx context.Context, request SigningRequest) (uint64, error) {
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	stmt := `
+	INSERT INTO
+		signing_requests (
+			file_id,
+			user_id,
+			version,
+			ordered,
+			status,
+			created_at
+		)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id
+	`
+
+	var id uint64
+	err = tx.QueryRow(
+		ctx,
+		stmt,
+		request.FileID,
+		request.UserID,
+		request.Version,
+		request.Ordered,
+		request.Status,
+		request.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `
+	INSERT INTO
+		signing_request_signers (
+			request_id,
+			user_id,
+			position,
+			status,
+			notified_at
+		)
+	VALUES ($1, $2, $3, $4, $5)
+	`
+
+	for _, signer := range request.Signers {
+		_, err = tx.Exec(
+			ctx,
+			stmt,
+			id,
+			signer.UserID,
+			signer.Position,
+			signer.Status,
+			signer.NotifiedAt,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetSigningRequest returns the latest signing request of a file
+// with its co-signers.
+func (fr *fileRepository) GetSigningRequest(ctx context.Context, fileID uint64) (SigningRequest, error) {
+	var r SigningRequest
+
+	stmt := `
+	SELECT
+			sr.id,
+			sr.file_id,
+			f.filename,
+			sr.user_id,
+			sr.version,
+			sr.ordered,
+			sr.status,
+			sr.created_at,
+			sr.completed_at
+	 FROM signing_requests sr
+	 JOIN files f ON f.id = sr.file_id
+	 WHERE sr.file_id = $1
+	 ORDER BY sr.id DESC
+	 LIMIT 1
+	 `
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, fileID).Scan(
+		&r.ID,
+		&r.FileID,
+		&r.Filename,
+		&r.UserID,
+		&r.Version,
+		&r.Ordered,
+		&r.Status,
+		&r.CreatedAt,
+		&r.CompletedAt,
+	)
+	if err != nil {
+		return SigningRequest{}, err
+	}
+
+	r.Signers, err = fr.listCoSigners(ctx, r.ID)
+	if err != nil {
+		return SigningRequest{}, err
+	}
+
+	return r, nil
+}
+
+// ListAwaitingSignature lists the pending signing requests asking
+// the user to sign, oldest first.
+func (fr *fileRepository) ListAwaitingSignature(ctx context.Context, userID uint64) ([]SigningRequest, error) {
+	var requests []SigningRequest
+
+	stmt := `
+	SELECT
+			sr.id,
+			sr.file_id,
+			f.filename,
+			sr.user_id,
+			sr.version,
+			sr.ordered,
+			sr.status,
+			sr.created_at,
+			sr.completed_at
+	 FROM signing_requests sr
+	 JOIN signing_request_signers s ON s.request_id = sr.id
+	 JOIN files f ON f.id = sr.file_id
+	 WHERE s.user_id = $1
+	 AND s.status = $2
+	 AND s.notified_at IS NOT NULL
+	 AND sr.status = $3
+	 AND f.deleted_at IS NULL
+	 ORDER BY s.notified_at, sr.id
+	 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, userID, CoSignerPending, SigningPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r SigningRequest
+		err := rows.Scan(
+			&r.ID,
+			&r.FileID,
+			&r.Filename,
+			&r.UserID,
+			&r.Version,
+			&r.Ordered,
+			&r.Status,
+			&r.CreatedAt,
+			&r.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range requests {
+		requests[i].Signers, err = fr.listCoSigners(ctx, requests[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return requests, nil
+}
+
+func (fr *fileRepository) listCoSigners(ctx context.Context, requestID uint64) ([]CoSigner, error) {
+	var signers []CoSigner
+
+	stmt := `
+	SELECT
+			s.user_id,
+			u.username,
+			s.position,
+			s.status,
+			s.notified_at,
+			s.signed_at
+	 FROM signing_request_signers s
+	 JOIN users u ON u.id = s.user_id
+	 WHERE s.request_id = $1
+	 ORDER BY s.position
+	 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s CoSigner
+		err := rows.Scan(
+			&s.UserID,
+			&s.Username,
+			&s.Position,
+			&s.Status,
+			&s.NotifiedAt,
+			&s.SignedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		signers = append(signers, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return signers, nil
+}
+
+// LockSigningRequest locks a pending signing request while a co-signer
+// signs, a lock taken before expired is released. False is returned
+// when the request is locked.
+func (fr *fileRepository) LockSigningRequest(ctx context.Context, id uint64, now time.Time, expired time.Time) (bool, error) {
+	stmt := `
+	UPDATE
+		signing_requests SET
+			locked_at = $2
+	WHERE id = $1
+	AND status = $4
+	AND (locked_at IS NULL OR locked_at < $3)
+	`
+
+	tag, err := fr.db.GetConn().Exec(ctx, stmt, id, now, expired, SigningPending)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (fr *fileRepository) UnlockSigningRequest(ctx context.Context, id uint64) error {
+	_, err := fr.db.GetConn().Exec(ctx, `UPDATE signing_requests SET locked_at = NULL WHERE id = $1`, id)
+
+	return err
+}
+
+// UpdateSigningRequest stores the status of a pending signing
+// request and of its co-signers, and releases its lock.
+func (fr *fileRepository) UpdateSigningRequest(ctx context.Context, request SigningRequest) error {
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	stmt := `
+	UPDATE
+		signing_requests SET
+			version = $2,
+			status = $3,
+			completed_at = $4,
+			locked_at = NULL
+	WHERE id = $1
+	AND status = $5
+	`
+
+	tag, err := tx.Exec(
+		ctx,
+		stmt,
+		request.ID,
+		request.Version,
+		request.Status,
+		request.CompletedAt,
+		SigningPending,
+	)
+	if err != nil {
+		return err
+	}
+
+	// the request ended meanwhile
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	stmt = `
+	UPDATE
+		signing_request_signers SET
+			status = $3,
+			notified_at = $4,
+			signed_at = $5
+	WHERE request_id = $1
+	AND user_id = $2
+	`
+
+	for _, signer := range request.Signers {
+		_, err = tx.Exec(
+			ctx,
+			stmt,
+			request.ID,
+			signer.UserID,
+			signer.Status,
+			signer.NotifiedAt,
+			signer.SignedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CreateSigningSession creates a signing session and returns its id.
+// The expired sessions of the user are removed.
+func (fr *fileRepository) CreateSigningSession(ctx context.Context, session SigningSession) (uint64, error) {
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM signing_sessions WHERE user_id = $1 AND expires_at < $2`, session.UserID, session.SignTime)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `
+	INSERT INTO
+		signing_sessions (
+			file_id,
+			user_id,
+			version,
+			format,
+			fingerprint,
+			signed_data,
+			sign_time,
+			expires_at
+		)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id
+	`
+
+	var id uint64
+	err = tx.QueryRow(
+		ctx,
+		stmt,
+		session.FileID,
+		session.UserID,
+		session.Version,
+		session.Format,
+		session.Fingerprint,
+		session.SignedData,
+		session.SignTime,
+		session.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (fr *fileRepository) GetSigningSession(ctx context.Context, id uint64) (SigningSession, error) {
+	var s SigningSession
+
+	stmt := `
+	SELECT
+			id,
+			file_id,
+			user_id,
+			version,
+			format,
+			fingerprint,
+			signed_data,
+			sign_time,
+			expires_at
+	 FROM signing_sessions
+	 WHERE id = $1
+	 `
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, id).Scan(
+		&s.ID,
+		&s.FileID,
+		&s.UserID,
+		&s.Version,
+		&s.Format,
+		&s.Fingerprint,
+		&s.SignedData,
+		&s.SignTime,
+		&s.ExpiresAt,
+	)
+	if err != nil {
+		return SigningSession{}, err
+	}
+
+	return s, nil
+}
+
+// DeleteSigningSession removes a signing session, false is
+// returned when it was already removed.
+func (fr *fileRepository) DeleteSigningSession(ctx context.Context, id uint64) (bool, error) {
+	tag, err := fr.db.GetConn().Exec(ctx, `DELETE FROM signing_sessions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// CreateSignatureRevocation publishes the revocation
+// of a signature and returns its id.
+func (fr *fileRepository) CreateSignatureRevocation(ctx context.Context, revocation SignatureRevocation) (uint64, error) {
+	stmt := `
+	INSERT INTO
+		signature_revocations (
+			signature_id,
+			file_id,
+			version,
+			user_id,
+			fingerprint,
+			reason,
+			revoked_at
+		)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+	`
+
+	var id uint64
+	err := fr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		revocation.SignatureID,
+		revocation.FileID,
+		revocation.Version,
+		revocation.UserID,
+		revocation.Fingerprint,
+		revocation.Reason,
+		revocation.RevokedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (fr *fileRepository) GetSignatureRevocation(ctx context.Context, signatureID string) (SignatureRevocation, error) {
+	var r SignatureRevocation
+
+	stmt := `
+	SELECT
+			id,
+			signature_id,
+			file_id,
+			version,
+			user_id,
+			fingerprint,
+			reason,
+			revoked_at
+	 FROM signature_revocations
+	 WHERE signature_id = $1
+	 `
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, signatureID).Scan(
+		&r.ID,
+		&r.SignatureID,
+		&r.FileID,
+		&r.Version,
+		&r.UserID,
+		&r.Fingerprint,
+		&r.Reason,
+		&r.RevokedAt,
+	)
+	if err != nil {
+		return SignatureRevocation{}, err
+	}
 
+	return r, nil
 }
@@ -0,0 +1,246 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Reasons a signer revokes a signature for.
+//
+// - signed_in_error : the signer signed the wrong document.
+// - key_compromise : the signing key may be held by someone else.
+// - unspecified : no reason given.
+const (
+	RevocationSignedInError string = "signed_in_error"
+	RevocationKeyCompromise string = "key_compromise"
+	RevocationUnspecified   string = "unspecified"
+)
+
+var (
+	ErrSignatureRevoked  = errors.New("signature was revoked by its signer")
+	ErrNotSigned         = errors.New("Requested file is not signed")
+	ErrNoOwnSignature    = errors.New("file holds no signature of your signing keys")
+	ErrNoUnsignedVersion = errors.New("file has no unsigned version to restore")
+)
+
+// SignatureRevocation is the revocation of a signature by its signer.
+// It is published by the id of the signature, verifying any copy of
+// the signed file reports it. Fingerprint is the key of the verified
+// signer, the revocation only applies to a signature by that key.
+type SignatureRevocation struct {
+	ID          uint64    `json:"-"`
+	SignatureID string    `json:"signature_id"`
+	FileID      uint64    `json:"file_id"`
+	Version     int       `json:"version"`
+	UserID      uint64    `json:"-"`
+	Fingerprint string    `json:"fingerprint"`
+	Reason      string    `json:"reason"`
+	RevokedAt   time.Time `json:"revoked_at"`
+}
+
+// signatureID returns the id of a signature from its value.
+func signatureID(signature []byte) string {
+	return contentDigest(signature)
+}
+
+// revokeSignature revokes the signatures a user made of the current
+// version of a file, only signatures that verify are revoked.
+// Revoking the signature of the owner unsigns the file, the content
+// it had before it was signed is restored as a new version for
+// further edits.
+func (fs *fileService) revokeSignature(ctx context.Context, request RevokeSignatureRequest) (*RevokeSignatureResponse, error) {
+	file, err := fs.fileRepository.Get(ctx, request.FileID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, errors.New("Requested file not found")
+	}
+
+	if file.UserID != request.UserID {
+		_, err = fs.getFilePermission(ctx, request.UserID, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !file.IsSigned {
+		return nil, ErrNotSigned
+	}
+
+	version, err := fs.fileRepository.GetVersion(ctx, file.ID, file.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fs.readVersion(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var detached []byte
+	if version.SignaturePath != "" {
+		detached, err = fs.readSignature(ctx, version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// revocations are left out, a signature revoked earlier keeps
+	// its first revocation. Signers revoke the signatures of a key
+	// they revoked as compromised too
+	report := &VerificationReport{allowRevokedKeys: true}
+	_, err = fs.verifySignatures(ctx, content, detached, report)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := fs.userService.GetUserById(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := request.Reason
+	if reason == "" {
+		reason = RevocationUnspecified
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	res := &RevokeSignatureResponse{}
+
+	for _, sr := range report.Signatures {
+		// the name a signature claims is only trusted
+		// along with a key registered for the user
+		if sr.Signer.Name != user.Username || !sr.Signer.Known {
+			continue
+		}
+
+		revocation, err := fs.revoke(ctx, SignatureRevocation{
+			SignatureID: sr.ID,
+			FileID:      file.ID,
+			Version:     version.Version,
+			UserID:      user.ID,
+			Fingerprint: sr.Signer.KeyFingerprint,
+			Reason:      reason,
+			RevokedAt:   now,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		res.Revocations = append(res.Revocations, revocation)
+	}
+
+	if len(res.Revocations) == 0 {
+		return nil, ErrNoOwnSignature
+	}
+
+	if file.UserID == request.UserID {
+		res.Version, err = fs.unsign(ctx, file, version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// revoke publishes revocation, a signature revoked
+// earlier keeps its first revocation.
+func (fs *fileService) revoke(ctx context.Context, revocation SignatureRevocation) (SignatureRevocation, error) {
+	revoked, err := fs.fileRepository.GetSignatureRevocation(ctx, revocation.SignatureID)
+	if err != nil && err != pgx.ErrNoRows {
+		return SignatureRevocation{}, err
+	}
+	if err == nil {
+		return revoked, nil
+	}
+
+	revocation.ID, err = fs.fileRepository.CreateSignatureRevocation(ctx, revocation)
+	if err != nil {
+		return SignatureRevocation{}, err
+	}
+
+	return revocation, nil
+}
+
+// unsign stores the content file had before it was signed as a new
+// version, version being its current signed version. Detached
+// signatures leave the content of version as it was, embedded ones
+// are undone by the latest unsigned version before it.
+func (fs *fileService) unsign(ctx context.Context, file File, version Version) (*Version, error) {
+	source := version
+
+	if version.SignaturePath == "" {
+		versions, err := fs.fileRepository.ListVersions(ctx, file.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// versions are listed latest first
+		found := false
+		for _, v := range versions {
+			if v.Version < version.Version && !v.IsSigned {
+				source = v
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrNoUnsignedVersion
+		}
+	}
+
+	content, err := fs.readVersion(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := fs.checkQuota(ctx, file.UserID, file.Type, int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned, err := fs.writeContent(ctx, file.Type, DetectContentType(content), content)
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned.FileID = file.ID
+	unsigned.Filename = source.Filename
+	unsigned.ScanStatus = source.ScanStatus
+
+	unsigned.Version, err = fs.fileRepository.CreateVersion(ctx, unsigned, quota)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.syncShares(ctx, file.ID)
+
+	return &unsigned, nil
+}
+
+// checkRevocation checks that the verified signature sr reports on
+// was not revoked by its signer. Revocations made with another key
+// than the one of the signer do not apply.
+func (fs *fileService) checkRevocation(ctx context.Context, sr *SignatureReport) error {
+	revocation, err := fs.fileRepository.GetSignatureRevocation(ctx, sr.ID)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if revocation.Fingerprint != sr.Signer.KeyFingerprint {
+		return nil
+	}
+
+	sr.Revocation = &revocation
+
+	return fmt.Errorf("%w on %s, reason: %s", ErrSignatureRevoked, revocation.RevokedAt.Format(time.RFC3339), revocation.Reason)
+}
@@ -0,0 +1,281 @@
+package file
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"encryption/ca"
+	"encryption/guard"
+	"encryption/guard/cms"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeKeys holds the key stored last, every
+// key reference resolves to that key.
+type fakeKeys struct {
+	key guard.Key
+}
+
+func (f *fakeKeys) GetKey(ctx context.Context, table string, id uint64) (guard.Key, error) {
+	return f.key, nil
+}
+
+func (f *fakeKeys) StoreKey(ctx context.Context, table string, key guard.Key) (guard.Key, error) {
+	f.key = key
+	return key, nil
+}
+
+func (f *fakeKeys) DeleteKey(ctx context.Context, table string, id uint64) error {
+	return nil
+}
+
+func (f *fakeKeys) ListKeys(ctx context.Context, table string) ([]guard.KeyInfo, error) {
+	return nil, nil
+}
+
+// fakeFileSystem keeps written files in memory.
+type fakeFileSystem map[string][]byte
+
+func (f fakeFileSystem) Read(filepath string) ([]byte, error) {
+	data, ok := f[filepath]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return data, nil
+}
+
+func (f fakeFileSystem) Write(filepath string, data []byte) error {
+	f[filepath] = data
+	return nil
+}
+
+func (f fakeFileSystem) Remove(filepath string) error {
+	delete(f, filepath)
+	return nil
+}
+
+// fakeVersions holds a single file and its versions,
+// oldest first, along with signature revocations.
+type fakeVersions struct {
+	*fakeFiles
+	file     File
+	versions []Version
+}
+
+func (f *fakeVersions) Get(ctx context.Context, id uint64) (File, error) {
+	return f.file, nil
+}
+
+func (f *fakeVersions) GetVersion(ctx context.Context, fileID uint64, version int) (Version, error) {
+	return f.versions[version-1], nil
+}
+
+func (f *fakeVersions) ListVersions(ctx context.Context, fileID uint64) ([]Version, error) {
+	versions := make([]Version, 0, len(f.versions))
+	for i := len(f.versions) - 1; i >= 0; i-- {
+		versions = append(versions, f.versions[i])
+	}
+	return versions, nil
+}
+
+func (f *fakeVersions) CreateVersion(ctx context.Context, version Version, quota Quota) (int, error) {
+	version.Version = len(f.versions) + 1
+	f.versions = append(f.versions, version)
+	f.file.Version = version.Version
+	f.file.IsSigned = version.IsSigned
+	return version.Version, nil
+}
+
+func (f *fakeVersions) GetQuotas(ctx context.Context, userID uint64) (map[string]int64, error) {
+	return nil, nil
+}
+
+func (f *fakeVersions) GetUsage(ctx context.Context, userID uint64) ([]TypeUsage, error) {
+	return nil, nil
+}
+
+// fakePermissions has no permission to sync.
+type fakePermissions struct {
+	PermissionService
+}
+
+func (f *fakePermissions) SyncFilePermissions(ctx context.Context, fileID uint64) error {
+	return nil
+}
+
+func TestSignatureRevocation(t *testing.T) {
+	ctx := context.Background()
+	privateKey, fingerprint := newSigningKey(t)
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + fingerprint: {Fingerprint: fingerprint, Current: true},
+	}}
+	alice := &user.User{
+		ID:       1,
+		Username: "alice",
+		Email:    "alice@example.com",
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PUBLIC KEY",
+			Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+		})),
+	}
+	cert := signerCertificate(t, alice, privateKey, time.Now())
+	files := &fakeFiles{}
+	fs := newTestFileService(t, withUsers(users), withFiles(files))
+
+	embedded, err := fs.signEmbedded(ctx, []byte("contract"), alice, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("\x89PNG\r\n\x1a\nnot a real image")
+	detached, err := cms.SignDetached(content, privateKey, []*x509.Certificate{cert}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for format, sample := range map[string][2][]byte{
+		SignatureFormatEmbedded: {embedded, nil},
+		SignatureFormatDetached: {content, detached},
+	} {
+		t.Run(format, func(t *testing.T) {
+			report := fs.reportFile(ctx, sample[0], sample[1])
+			signer := report.Signatures[0].Signer
+			if report.Verdict == VerdictInvalid || signer.Name != "alice" || !signer.Known || signer.KeyFingerprint != fingerprint {
+				t.Fatalf("report before revocation = %v %+v %+v", report.Verdict, report.Reasons, signer)
+			}
+			id := report.Signatures[0].ID
+
+			// a revocation by another key does not apply
+			_, err := fs.revoke(ctx, SignatureRevocation{SignatureID: id, Fingerprint: "forged", Reason: RevocationUnspecified})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = fs.verifyFile(ctx, sample[0], sample[1])
+			if err != nil {
+				t.Fatalf("verifyFile() with forged revocation error = %v", err)
+			}
+			delete(files.revocations, id)
+
+			revocation, err := fs.revoke(ctx, SignatureRevocation{
+				SignatureID: id,
+				Fingerprint: fingerprint,
+				Reason:      RevocationSignedInError,
+				RevokedAt:   time.Now().UTC().Truncate(time.Second),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// revoking again keeps the first revocation
+			again, err := fs.revoke(ctx, SignatureRevocation{SignatureID: id, Fingerprint: fingerprint, Reason: RevocationKeyCompromise})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Reason != RevocationSignedInError || !again.RevokedAt.Equal(revocation.RevokedAt) {
+				t.Errorf("revoke() again = %+v, want %+v", again, revocation)
+			}
+
+			_, err = fs.verifyFile(ctx, sample[0], sample[1])
+			if !errors.Is(err, ErrSignatureRevoked) {
+				t.Errorf("verifyFile() error = %v, want %v", err, ErrSignatureRevoked)
+			}
+
+			report = fs.reportFile(ctx, sample[0], sample[1])
+			sr := report.Signatures[0]
+			if report.Verdict != VerdictRevoked || report.Reasons[0].Code != ReasonSignatureRevoked ||
+				sr.Revocation == nil || sr.Revocation.Reason != RevocationSignedInError || sr.SignatureValue != CheckPassed {
+				t.Errorf("revoked report = %v %+v %+v", report.Verdict, report.Reasons, sr)
+			}
+		})
+	}
+}
+
+func TestRevokeCompromisedKeySignature(t *testing.T) {
+	ctx := context.Background()
+	privateKey, fingerprint := newSigningKey(t)
+	keys := &fakeKeys{}
+	fileSystem := fakeFileSystem{}
+	authority := &fakeAuthority{revoked: map[string]ca.Certificate{}}
+	users := &fakeUsers{
+		keys:  map[string]signingkey.SigningKey{"alice/" + fingerprint: {UserID: 1, Fingerprint: fingerprint, Current: true}},
+		users: map[uint64]*user.User{1: {ID: 1, Username: "alice"}},
+	}
+	files := &fakeVersions{fakeFiles: &fakeFiles{}}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority), func(fs *fileService) {
+		fs.guard = *guard.NewGuard(1, []byte("0123456789abcdef0123456789abcdef"), keys)
+		fs.fileRepository = files
+		fs.fileSystem = fileSystem
+		fs.permissionService = &fakePermissions{}
+	})
+
+	key, err := fs.guard.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.key = guard.Key{PlainKey: key}
+	keyReference, err := fs.guard.GenerateMetadata(keys.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := []byte("contract")
+	signed := signSample(t, &fs.guard, privateKey, content, SignatureMetadata{
+		SignDate:       time.Now().Add(-time.Hour),
+		SignBy:         "alice",
+		Digest:         contentDigest(content),
+		KeyFingerprint: fingerprint,
+	})
+
+	for i, data := range [][]byte{content, signed} {
+		encrypted, err := fs.guard.Encrypt(key, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filepath := fmt.Sprintf("files/%v", i+1)
+		fileSystem[filepath] = encrypted
+		files.versions = append(files.versions, Version{
+			FileID:       1,
+			Version:      i + 1,
+			Filename:     "contract.txt",
+			Filepath:     filepath,
+			KeyReference: keyReference,
+			IsSigned:     i == 1,
+		})
+	}
+	files.file = File{ID: 1, UserID: 1, Type: Misc, Version: 2, IsSigned: true}
+
+	// alice rotates her key as compromised, the
+	// untimestamped signature no longer verifies
+	revokedAt := time.Now()
+	authority.revoked[fingerprint] = ca.Certificate{Fingerprint: fingerprint, RevokedAt: &revokedAt, RevocationReason: ca.ReasonKeyCompromise}
+	users.keys["alice/"+fingerprint] = signingkey.SigningKey{UserID: 1, Fingerprint: fingerprint}
+
+	_, err = fs.verifyFile(ctx, signed, nil)
+	if !errors.Is(err, ca.ErrCertificateRevoked) {
+		t.Fatalf("verifyFile() error = %v, want %v", err, ca.ErrCertificateRevoked)
+	}
+
+	res, err := fs.revokeSignature(ctx, RevokeSignatureRequest{UserID: 1, FileID: 1, Reason: RevocationKeyCompromise})
+	if err != nil {
+		t.Fatalf("revokeSignature() error = %v", err)
+	}
+	if len(res.Revocations) != 1 || res.Revocations[0].Fingerprint != fingerprint || res.Revocations[0].Reason != RevocationKeyCompromise {
+		t.Errorf("revokeSignature() revocations = %+v", res.Revocations)
+	}
+
+	if res.Version == nil || res.Version.Version != 3 || res.Version.IsSigned {
+		t.Fatalf("revokeSignature() version = %+v, want unsigned version 3", res.Version)
+	}
+	unsigned, err := fs.readVersion(ctx, *res.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(unsigned) != string(content) {
+		t.Errorf("unsigned content = %q, want %q", unsigned, content)
+	}
+}
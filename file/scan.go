@@ -0,0 +1,176 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encryption/scanner"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	ErrInfected    = errors.New("file is infected")
+	ErrQuarantined = errors.New("file is quarantined until it is scanned")
+)
+
+// ScanPolicy defines how uploads are handled
+// when the scanner is unavailable.
+//
+// - open : the file is stored as unscanned.
+// - closed : the file is stored as quarantined.
+type ScanPolicy string
+
+const (
+	FailOpen   ScanPolicy = "open"
+	FailClosed ScanPolicy = "closed"
+)
+
+// ScanPolicyFromEnv returns the SCAN_FAIL_POLICY policy,
+// defaulting to FailClosed.
+func ScanPolicyFromEnv() ScanPolicy {
+	if ScanPolicy(os.Getenv("SCAN_FAIL_POLICY")) == FailOpen {
+		return FailOpen
+	}
+
+	return FailClosed
+}
+
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (scanner.Result, error)
+}
+
+// scanContent scans a plain file content and sets the scan result
+// on file. ErrInfected is returned when malware is found.
+func (fs *fileService) scanContent(ctx context.Context, file *File, content []byte) error {
+	// scanning is disabled
+	if fs.scanner == nil {
+		file.ScanStatus = ScanUnscanned
+		return nil
+	}
+
+	res, err := fs.scanner.Scan(ctx, bytes.NewReader(content))
+	if err != nil {
+		fmt.Println(err)
+
+		file.ScanStatus = ScanUnscanned
+		if fs.scanPolicy == FailClosed {
+			file.ScanStatus = ScanQuarantined
+		}
+
+		return nil
+	}
+
+	return setScanResult(file, res)
+}
+
+// setScanResult sets the result of a scan on file.
+// ErrInfected is returned when malware is found.
+func setScanResult(file *File, res scanner.Result) error {
+	scannedAt := time.Now()
+	file.ScannedAt = &scannedAt
+
+	if res.Infected {
+		file.ScanStatus = ScanInfected
+		file.ScanSignature = res.Signature
+		return fmt.Errorf("%w (%v)", ErrInfected, res.Signature)
+	}
+
+	file.ScanStatus = ScanClean
+
+	return nil
+}
+
+// checkScanStatus returns an error for files that
+// can not be accessed because of their scan result.
+func checkScanStatus(file File) error {
+	switch file.ScanStatus {
+	case ScanQuarantined:
+		return ErrQuarantined
+	case ScanInfected:
+		return fmt.Errorf("%w (%v)", ErrInfected, file.ScanSignature)
+	}
+
+	return nil
+}
+
+// RescanQuarantined scans the quarantined files again and releases
+// the clean ones. A file failing to be read or scanned stays in
+// quarantine without holding back the others, the pass only stops
+// when the scanner is unavailable.
+func (fs *fileService) RescanQuarantined(ctx context.Context) error {
+	if fs.scanner == nil {
+		return nil
+	}
+
+	files, err := fs.fileRepository.ListByScanStatus(ctx, ScanQuarantined)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		content, err := fs.readQuarantined(ctx, file)
+		if err != nil {
+			fmt.Println("rescan file", file.ID, err)
+			continue
+		}
+
+		res, err := fs.scanner.Scan(ctx, bytes.NewReader(content))
+		if errors.Is(err, scanner.ErrUnavailable) {
+			return err
+		}
+		if err != nil {
+			// the scanner refused this file, e.g. over its size limit
+			fmt.Println("rescan file", file.ID, err)
+			continue
+		}
+
+		err = setScanResult(&file, res)
+		if err != nil && !errors.Is(err, ErrInfected) {
+			return err
+		}
+
+		err = fs.fileRepository.UpdateScanStatus(ctx, file)
+		if err != nil {
+			fmt.Println("rescan file", file.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// readQuarantined reads and decrypts the content of a quarantined file.
+func (fs *fileService) readQuarantined(ctx context.Context, file File) ([]byte, error) {
+	fileContent, err := fs.fileSystem.Read(file.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := fs.guard.GetKey(ctx, fileTable, file.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.guard.Decrypt(key.PlainKey, fileContent)
+}
+
+// RunQuarantineRescan calls RescanQuarantined every
+// interval until ctx is done.
+func (fs *fileService) RunQuarantineRescan(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := fs.RescanQuarantined(ctx)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
@@ -3,15 +3,19 @@ package file
 import (
 	"context"
 	"crypto/rsa"
-	"encoding/json"
+	"crypto/x509"
 	"encryption/cache"
 	"encryption/guard"
+	"encryption/guard/timestamp"
+	"encryption/pdf"
 	"encryption/user"
 	filepermission "encryption/user/file_permission"
+	signingkey "encryption/user/signing_key"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -34,19 +38,59 @@ type Guard interface {
 type FileSystem interface {
 	Read(filepath string) ([]byte, error)
 	Write(filepath string, data []byte) error
+	Remove(filepath string) error
 }
 
 type FileRepository interface {
-	List(ctx context.Context, userID uint64, fileType string) ([]File, error)
-	Create(ctx context.Context, file File) error
+	List(ctx context.Context, filter ListFilter) ([]File, uint64, error)
+	Create(ctx context.Context, file File, quota Quota) (uint64, error)
 	Get(ctx context.Context, id uint64) (File, error)
+	CreateVersion(ctx context.Context, version Version, quota Quota) (int, error)
+	GetVersion(ctx context.Context, fileID uint64, version int) (Version, error)
+	ListVersions(ctx context.Context, fileID uint64) ([]Version, error)
 	UpdateSignedStatus(ctx context.Context, file File) error
+	SetSignature(ctx context.Context, fileID uint64, version int, signaturePath string) error
+	UpdateFolder(ctx context.Context, file File) error
+	UpdateScanStatus(ctx context.Context, file File) error
+	ListByScanStatus(ctx context.Context, status string) ([]File, error)
+	Trash(ctx context.Context, id uint64) error
+	Restore(ctx context.Context, id uint64) error
+	GetTrashed(ctx context.Context, id uint64) (File, error)
+	ListTrash(ctx context.Context, userID uint64, before time.Time) ([]File, error)
 	Delete(ctx context.Context, id uint64) error
+	GetUsage(ctx context.Context, userID uint64) ([]TypeUsage, error)
+	GetQuotas(ctx context.Context, userID uint64) (map[string]int64, error)
+	SetQuota(ctx context.Context, userID uint64, fileType string, maxBytes int64) error
+	CreateSigningRequest(ctx context.Context, request SigningRequest) (uint64, error)
+	GetSigningRequest(ctx context.Context, fileID uint64) (SigningRequest, error)
+	ListAwaitingSignature(ctx context.Context, userID uint64) ([]SigningRequest, error)
+	LockSigningRequest(ctx context.Context, id uint64, now time.Time, expired time.Time) (bool, error)
+	UnlockSigningRequest(ctx context.Context, id uint64) error
+	UpdateSigningRequest(ctx context.Context, request SigningRequest) error
+	CreateSigningSession(ctx context.Context, session SigningSession) (uint64, error)
+	GetSigningSession(ctx context.Context, id uint64) (SigningSession, error)
+	DeleteSigningSession(ctx context.Context, id uint64) (bool, error)
+	CreateSignatureRevocation(ctx context.Context, revocation SignatureRevocation) (uint64, error)
+	GetSignatureRevocation(ctx context.Context, signatureID string) (SignatureRevocation, error)
 }
 
 type UserService interface {
 	GetUserByUsername(context.Context, string) (*user.User, error)
 	GetUserWithRSA(context.Context, uint64) (*user.User, error)
+	GetUserById(context.Context, uint64) (*user.User, error)
+	GetSigningKey(ctx context.Context, username string, fingerprint string) (*signingkey.SigningKey, error)
+	GetCurrentSigningKey(ctx context.Context, userID uint64) (*signingkey.SigningKey, error)
+}
+
+type CertificateAuthority interface {
+	Chain(ctx context.Context, userID uint64, username string, email string, publicKey *rsa.PublicKey) ([]*x509.Certificate, error)
+	Check(ctx context.Context, cert *x509.Certificate, intermediates []*x509.Certificate, signTime time.Time, proven bool) error
+	CheckKey(ctx context.Context, fingerprint string, signTime time.Time, proven bool) error
+}
+
+type TimestampAuthority interface {
+	Timestamp(ctx context.Context, data []byte) ([]byte, error)
+	Verify(token []byte, data []byte) (*timestamp.Token, error)
 }
 
 type PermissionService interface {
@@ -55,6 +99,9 @@ type PermissionService interface {
 		sourceUserID uint64,
 		targetUserID uint64,
 	) (bool, error)
+
+	ShareFolderFile(ctx context.Context, fileID uint64) error
+	SyncFilePermissions(ctx context.Context, fileID uint64) error
 }
 
 type FilePermissionRepository interface {
@@ -85,6 +132,11 @@ type FilePermissionRepository interface {
 		sourceUserID uint64,
 		targetUserID uint64,
 	) ([]filepermission.FilePermission, error)
+
+	ListByFileID(
+		ctx context.Context,
+		fileID uint64,
+	) ([]filepermission.FilePermission, error)
 }
 
 type fileService struct {
@@ -94,7 +146,14 @@ type fileService struct {
 	userService              UserService
 	fileSystem               FileSystem
 	fileRepository           FileRepository
+	folderRepository         FolderRepository
 	guard                    guard.Guard
+	contentValidator         *ContentValidator
+	scanner                  Scanner
+	scanPolicy               ScanPolicy
+	quota                    Quota
+	certificateAuthority     CertificateAuthority
+	timestampAuthority       TimestampAuthority
 }
 
 func NewFileService(
@@ -104,7 +163,14 @@ func NewFileService(
 	us UserService,
 	fs FileSystem,
 	fr FileRepository,
+	fdr FolderRepository,
 	g guard.Guard,
+	cv *ContentValidator,
+	sc Scanner,
+	sp ScanPolicy,
+	q Quota,
+	ca CertificateAuthority,
+	ta TimestampAuthority,
 ) fileService {
 	return fileService{
 		filePermissionRepository: fpr,
@@ -113,23 +179,28 @@ func NewFileService(
 		userService:              us,
 		fileSystem:               fs,
 		fileRepository:           fr,
+		folderRepository:         fdr,
 		guard:                    g,
+		contentValidator:         cv,
+		scanner:                  sc,
+		scanPolicy:               sp,
+		quota:                    q,
+		certificateAuthority:     ca,
+		timestampAuthority:       ta,
 	}
 }
 
-// ListFiles returns a list of file. Listed attributes are
-// id, filename, type, and filepath.
+// ListFiles returns a page of files of the target user. Listed
+// attributes are id, filename, type, is_signed, size and created_at.
 func (fs *fileService) listFiles(
 	ctx context.Context,
-	userID uint64,
-	fileType string,
-	targetUsername string,
-) ([]File, error) {
+	request ListFilesRequest,
+) (*ListFilesResponse, error) {
 	var err error
 
 	// token := ctx.Value("user_token").(string)
 
-	targetUser, err := fs.userService.GetUserByUsername(ctx, targetUsername)
+	targetUser, err := fs.userService.GetUserByUsername(ctx, request.TargetUsername)
 	if err != nil {
 		return nil, err
 	}
@@ -144,16 +215,49 @@ func (fs *fileService) listFiles(
 
 	// return from json if permission exists
 
-	res, err := fs.fileRepository.List(ctx, targetUser.ID, fileType)
+	filter := ListFilter{
+		UserID:   targetUser.ID,
+		Type:     request.Type,
+		Search:   request.Search,
+		Signed:   request.Signed,
+		FolderID: request.FolderID,
+		SortBy:   request.SortBy,
+		Desc:     request.Order == "desc",
+		// fetch one more file to know whether a next page exists
+		Limit: request.Limit + 1,
+	}
+
+	if request.Cursor != "" {
+		filter.After, err = DecodeListCursor(request.Cursor, filter.SortBy, filter.Desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, total, err := fs.fileRepository.List(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
+	response := ListFilesResponse{
+		Files: []File{},
+		Total: total,
+	}
+
+	if len(res) > request.Limit {
+		res = res[:request.Limit]
+
+		response.NextCursor, err = NewListCursor(filter.SortBy, filter.Desc, res[len(res)-1]).Encode()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// get user's permissions if user is not owner
-	if userID != targetUser.ID {
+	if request.UserID != targetUser.ID {
 		filePermissions, err := fs.filePermissionRepository.ListByUserFilePermission(
 			ctx,
-			userID,
+			request.UserID,
 			targetUser.ID,
 		)
 		if err != nil {
@@ -171,12 +275,53 @@ func (fs *fileService) listFiles(
 		}
 	}
 
-	return res, nil
+	response.Files = append(response.Files, res...)
+
+	return &response, nil
 }
 
-func (fs *fileService) getFile(ctx context.Context, userID uint64, id uint64) (*File, error) {
+// getFilePermission checks that a user who is not the owner of data
+// has unlocked the owner's profile and was granted a permission to
+// the file, and returns that permission.
+func (fs *fileService) getFilePermission(
+	ctx context.Context,
+	userID uint64,
+	data File,
+) (filepermission.FilePermission, error) {
 	token := ctx.Value("user_token").(string)
 
+	// check cache
+	permissionCache, err := fs.redisClient.Get(
+		ctx,
+		fmt.Sprintf("permission:%v_%v", token, data.UserID),
+	)
+	if err != nil {
+		return filepermission.FilePermission{}, err
+	}
+
+	if len(permissionCache) <= 0 &&
+		string(permissionCache) != "true" {
+		return filepermission.FilePermission{}, errors.New("redirect")
+	}
+	// check if user has file permission
+	filePermission, err := fs.filePermissionRepository.GetByUserFilePermission(
+		ctx,
+		userID,
+		data.UserID,
+		data.ID,
+	)
+	if err != nil {
+		return filepermission.FilePermission{}, err
+	}
+
+	if filePermission.ID == 0 {
+		return filepermission.FilePermission{}, errors.New("permission does not exist")
+	}
+
+	return filePermission, nil
+}
+
+func (fs *fileService) getFile(ctx context.Context, userID uint64, id uint64) (*File, error) {
 	var err error
 	// get data from db
 	data, err := fs.fileRepository.Get(ctx, id)
@@ -184,35 +329,20 @@ func (fs *fileService) getFile(ctx context.Context, userID uint64, id uint64) (*
 		return nil, err
 	}
 
+	err = checkScanStatus(data)
+	if err != nil {
+		return nil, err
+	}
+
 	// handle if userID is another user
 	if data.UserID != userID {
-
-		// check cache
-		permissionCache, err := fs.redisClient.Get(
-			ctx,
-			fmt.Sprintf("permission:%v_%v", token, data.UserID),
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if len(permissionCache) <= 0 &&
-			string(permissionCache) != "true" {
-			return nil, errors.New("redirect")
-		}
-		// check if user has file permission
-		filePermission, err := fs.filePermissionRepository.GetByUserFilePermission(
-			ctx,
-			userID,
-			data.UserID,
-			data.ID,
-		)
+		filePermission, err := fs.getFilePermission(ctx, userID, data)
 		if err != nil {
 			return nil, err
 		}
 
-		if filePermission.ID == 0 {
-			return nil, errors.New("permission does not exist")
+		if filePermission.Damaged {
+			return nil, ErrDamaged
 		}
 
 		// get symmetric key from permission
@@ -228,12 +358,51 @@ func (fs *fileService) getFile(ctx context.Context, userID uint64, id uint64) (*
 			return nil, err
 		}
 
-		fileContent, err := fs.fileSystem.Read(filePermission.Filepath)
+		// legacy grants hold a copy encrypted with the symmetric key
+		if filePermission.WrappedKey == nil {
+			fileContent, err := fs.fileSystem.Read(filePermission.Filepath)
+			if err != nil {
+				return nil, err
+			}
+
+			res, err := fs.guard.Decrypt(symmetricKey, fileContent)
+			if err != nil {
+				return nil, err
+			}
+
+			return &File{
+				Filename: data.Filename,
+				Content:  res,
+			}, nil
+		}
+
+		fileKey, err := fs.guard.Decrypt(symmetricKey, filePermission.WrappedKey)
 		if err != nil {
 			return nil, err
 		}
 
-		res, err := fs.guard.Decrypt(symmetricKey, fileContent)
+		// the key was wrapped for an older version
+		// when the file changed after the grant
+		filepath, damaged := data.Filepath, data.Damaged
+		if filePermission.Version != data.Version {
+			v, err := fs.fileRepository.GetVersion(ctx, data.ID, filePermission.Version)
+			if err != nil {
+				return nil, err
+			}
+
+			filepath, damaged = v.Filepath, v.Damaged
+		}
+
+		if damaged {
+			return nil, ErrDamaged
+		}
+
+		fileContent, err := fs.fileSystem.Read(filepath)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := fs.guard.Decrypt(fileKey, fileContent)
 		if err != nil {
 			return nil, err
 		}
@@ -244,6 +413,10 @@ func (fs *fileService) getFile(ctx context.Context, userID uint64, id uint64) (*
 		}, nil
 	}
 
+	if data.Damaged {
+		return nil, ErrDamaged
+	}
+
 	// get file from filesystem
 	fileContent, err := fs.fileSystem.Read(data.Filepath)
 	if err != nil {
@@ -268,253 +441,418 @@ func (fs *fileService) getFile(ctx context.Context, userID uint64, id uint64) (*
 	}, nil
 }
 
-func (fs *fileService) storeFile(
-	ctx context.Context,
-	userID uint64,
+// getThumbnail returns the decrypted thumbnail of a file to its
+// owner or to users having a permission to the file.
+func (fs *fileService) getThumbnail(ctx context.Context, userID uint64, id uint64) (*File, error) {
+	data, err := fs.fileRepository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkScanStatus(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.UserID != userID {
+		_, err = fs.getFilePermission(ctx, userID, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if data.ThumbnailPath == "" {
+		return nil, errNoThumbnail
+	}
+
+	thumbnail, err := fs.fileSystem.Read(data.ThumbnailPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// thumbnails are encrypted with the file's own key
+	key, err := fs.guard.GetKey(ctx, fileTable, data.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := fs.guard.Decrypt(key.PlainKey, thumbnail)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Filename: data.Filename,
+		Content:  res,
+	}, nil
+}
+
+// readUpload reads an uploaded file and runs the content
+// validation and processing steps before encryption.
+// The processed content and its content type are returned.
+func (fs *fileService) readUpload(
 	header multipart.FileHeader,
 	file multipart.File,
 	fileType string,
-) ([]byte, error) {
-	var err error
-	var dFile File
+	options UploadOptions,
+) ([]byte, string, error) {
+	// reject oversized files before reading them
+	err := fs.contentValidator.CheckSize(fileType, header.Size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// read file
+	fileContent, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// validate content before encryption
+	contentType, err := fs.contentValidator.Validate(fileType, fileContent)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// strip location, device and other
+	// embedded metadata from images
+	if slices.Contains(metadataFileTypes, fileType) && !options.KeepMetadata {
+		fileContent, err = StripMetadata(contentType, fileContent)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return fileContent, contentType, nil
+}
 
+// writeContent encrypts a plain content with a new key and writes
+// it, along with its thumbnail, to the filesystem. The returned
+// version holds the blob location and key reference.
+func (fs *fileService) writeContent(
+	ctx context.Context,
+	fileType string,
+	contentType string,
+	content []byte,
+) (Version, error) {
 	// create key
 	key, err := fs.guard.GenerateKey()
 	if err != nil {
-		return nil, err
+		return Version{}, err
 	}
 
 	// store key to db
 	metadata, err := fs.guard.StoreKey(ctx, fileTable, guard.Key{
 		PlainKey: key,
 	})
+	if err != nil {
+		return Version{}, err
+	}
+
+	// encrypt file using key
+	res, err := fs.guard.Encrypt(key, content)
+	if err != nil {
+		return Version{}, err
+	}
+
+	filepath := "files/" + uuid.New().String()
+	err = fs.fileSystem.Write(filepath, res)
+	if err != nil {
+		return Version{}, err
+	}
+
+	version := Version{
+		Filepath:     filepath,
+		KeyReference: metadata,
+		Size:         int64(len(content)),
+		Checksum:     Checksum(res),
+	}
+
+	// store a thumbnail encrypted with the file's key
+	if slices.Contains(thumbnailFileTypes, fileType) {
+		thumbnail, err := GenerateThumbnail(contentType, content)
+		if err != nil && err != errNoThumbnail {
+			return Version{}, err
+		}
+
+		if thumbnail != nil {
+			encryptedThumbnail, err := fs.guard.Encrypt(key, thumbnail)
+			if err != nil {
+				return Version{}, err
+			}
+
+			err = fs.fileSystem.Write(filepath+".thumb", encryptedThumbnail)
+			if err != nil {
+				return Version{}, err
+			}
+
+			version.ThumbnailPath = filepath + ".thumb"
+		}
+	}
+
+	return version, nil
+}
+
+func (fs *fileService) storeFile(
+	ctx context.Context,
+	userID uint64,
+	header multipart.FileHeader,
+	file multipart.File,
+	fileType string,
+	options UploadOptions,
+) (*File, error) {
+	var err error
+	var dFile File
+
+	err = fs.checkFolder(ctx, userID, options.FolderID)
 	if err != nil {
 		return nil, err
 	}
 
-	// read file
-	fileContent, err := io.ReadAll(file)
+	fileContent, contentType, err := fs.readUpload(header, file, fileType, options)
 	if err != nil {
 		return nil, err
 	}
 
-	// encrypt file using key
-	res, err := fs.guard.Encrypt(key, fileContent)
+	quota, err := fs.checkQuota(ctx, userID, fileType, int64(len(fileContent)))
 	if err != nil {
 		return nil, err
 	}
 
-	filepath := uuid.New().String()
-	fs.fileSystem.Write("files/"+filepath, res)
+	// scan the plain content before it is
+	// stored and shared to other users
+	err = fs.scanContent(ctx, &dFile, fileContent)
+	if err != nil {
+		return nil, err
+	}
 
-	dFile = File{
-		UserID:       userID,
-		Filename:     header.Filename,
-		Type:         fileType,
-		Filepath:     "files/" + filepath,
-		KeyReference: metadata,
+	version, err := fs.writeContent(ctx, fileType, contentType, fileContent)
+	if err != nil {
+		return nil, err
 	}
 
+	dFile.UserID = userID
+	dFile.Filename = header.Filename
+	dFile.Type = fileType
+	dFile.Filepath = version.Filepath
+	dFile.KeyReference = version.KeyReference
+	dFile.Size = version.Size
+	dFile.ThumbnailPath = version.ThumbnailPath
+	dFile.Checksum = version.Checksum
+	dFile.FolderID = options.FolderID
+	dFile.Version = 1
+
 	// save file to db
-	err = fs.fileRepository.Create(ctx, dFile)
+	dFile.ID, err = fs.fileRepository.Create(ctx, dFile, quota)
 	if err != nil {
 		return nil, err
 	}
 
-	return res, nil
+	fs.shareToFolder(ctx, dFile)
+
+	return &dFile, nil
 }
 
+// deleteFile moves a file of the user to the trash. Users having
+// a permission to the file lose access until it is restored.
 func (fs *fileService) deleteFile(ctx context.Context, userID uint64, id uint64) error {
-	// get data from db
-	data, err := fs.fileRepository.Get(ctx, id)
+	_, err := fs.getOwnedFile(ctx, userID, id)
 	if err != nil {
 		return err
 	}
 
-	// return if userID doesnt match
-	if data.UserID != userID {
-		return errors.New("unauthorized")
+	return fs.fileRepository.Trash(ctx, id)
+}
+
+// signFile signs the current version of a file in format, PDF
+// documents default to PAdES and other files to a detached signature.
+func (fs *fileService) signFile(ctx context.Context, userId uint64, fileId uint64, format string) error {
+	file, content, format, err := fs.signingTarget(ctx, userId, fileId, format)
+	if err != nil {
+		return err
 	}
 
-	err = fs.fileRepository.Delete(ctx, id)
+	// get user
+	user, err := fs.userService.GetUserWithRSA(ctx, userId)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	privateKey, err := fs.signingKey(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	// detached signatures leave the content as it is
+	if format == SignatureFormatDetached {
+		return fs.signDetached(ctx, file, user, privateKey, content)
+	}
+
+	var fullFileContent []byte
+	if format == SignatureFormatPAdES {
+		fullFileContent, err = fs.signPDF(ctx, content, user, privateKey)
+	} else {
+		fullFileContent, err = fs.signEmbedded(ctx, content, user, privateKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = fs.storeSigned(ctx, file, fullFileContent)
+	return err
 }
 
-func (fs *fileService) signFile(ctx context.Context, userId uint64, fileId uint64) error {
+// signingTarget returns the file a user signs in format, the content
+// of its current version and the format resolved for it.
+func (fs *fileService) signingTarget(ctx context.Context, userId uint64, fileId uint64, format string) (File, []byte, string, error) {
+	switch format {
+	case "", SignatureFormatPAdES, SignatureFormatDetached, SignatureFormatEmbedded:
+	default:
+		return File{}, nil, "", errors.New("invalid signature format")
+	}
+
 	// get file
 	// if not found, return error
 	file, err := fs.fileRepository.Get(ctx, fileId)
 	if err != nil && err != pgx.ErrNoRows {
-		return err
+		return File{}, nil, "", err
 	}
 	if err == pgx.ErrNoRows {
-		return errors.New("Requested file not found")
+		return File{}, nil, "", errors.New("Requested file not found")
 	}
 
 	// check user authority
 	if userId != file.UserID {
-		return errors.New("You do not have access to this resource data")
+		return File{}, nil, "", errors.New("You do not have access to this resource data")
 	}
 
 	// check: if already signed, return error
 	if file.IsSigned {
-		return errors.New("Requested file already signed")
-	}
-
-	// get user
-	user, err := fs.userService.GetUserWithRSA(ctx, userId)
-	if err != nil {
-		return err
+		return File{}, nil, "", errors.New("Requested file already signed")
 	}
 
-	// create signature metadata about the file and user
-	signatureMetadata := SignatureMetadata{
-		SignDate: time.Now(),
-		SignBy:   user.Username,
-		Contact:  user.Email,
-	}
-
-	// encrypt with private
-	privateKey, err := fs.guard.ParsePrivateKey(user.PrivateKey)
-	if err != nil {
-		return err
-	}
-
-	byteSignatureMetadata, err := json.Marshal(signatureMetadata)
+	// read file
+	decryptedFile, err := fs.getFile(ctx, userId, fileId)
 	if err != nil {
-		return err
+		return File{}, nil, "", err
 	}
 
-	signature, err := fs.guard.SignRSA(privateKey, []byte(byteSignatureMetadata))
-	if err != nil {
-		return err
+	// PDFs are signed with a signature dictionary readers can
+	// validate, appending to other files would corrupt them
+	isPDF := file.Type == Docs && DetectContentType(decryptedFile.Content) == PDF
+	if format == "" {
+		format = SignatureFormatDetached
+		if isPDF {
+			format = SignatureFormatPAdES
+		}
 	}
 
-	fullDataComment := []byte{}
-	fullDataComment = append(fullDataComment, []byte("\n%"+DataCommentKey)...)
-	fullDataComment = append(fullDataComment, byteSignatureMetadata...)
-
-	fullSignatureComment := []byte{}
-	fullSignatureComment = append(fullSignatureComment, []byte("\n%"+SignatureCommentKey)...)
-	fullSignatureComment = append(fullSignatureComment, signature...)
-
-	fullPublicKeyComment := []byte{}
-	fullPublicKeyComment = append(fullPublicKeyComment, []byte("\n%"+PublicKeyCommentKey)...)
-	fullPublicKeyComment = append(fullPublicKeyComment, []byte(user.PublicKey)...)
-
-	// read file
-	decryptedFile, err := fs.getFile(ctx, user.ID, fileId)
-	if err != nil {
-		return err
+	if format == SignatureFormatPAdES && !isPDF {
+		return File{}, nil, "", errors.New("PAdES signatures are only available for PDF documents")
 	}
 
-	// append signature & public key to file
-	fullFileContent := []byte{}
-	fullFileContent = append(fullFileContent, decryptedFile.Content...)
-	fullFileContent = append(fullFileContent, fullDataComment...)
-	fullFileContent = append(fullFileContent, fullSignatureComment...)
-	fullFileContent = append(fullFileContent, fullPublicKeyComment...)
+	return file, decryptedFile.Content, format, nil
+}
 
-	// encrypt file
-	key, err := fs.guard.GetKey(ctx, fileTable, file.KeyReference)
+// storeSigned stores the signed content of file as a new version,
+// keeping the unsigned original in the file's history, and returns
+// its number. The version counts towards the quota of the owner.
+func (fs *fileService) storeSigned(ctx context.Context, file File, content []byte) (int, error) {
+	quota, err := fs.checkQuota(ctx, file.UserID, file.Type, int64(len(content)))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// res, err := fs.guard.Encrypt(key, fileContent)
-	res, err := fs.guard.Encrypt(key.PlainKey, fullFileContent)
+	version, err := fs.writeContent(ctx, file.Type, DetectContentType(content), content)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// overwrite file content
-	fs.fileSystem.Write(file.Filepath, res)
+	version.FileID = file.ID
+	version.Filename = file.Filename
+	version.IsSigned = true
+	version.ScanStatus = file.ScanStatus
 
-	// update file (is_signed: true) to db
-	file.IsSigned = true
-	err = fs.fileRepository.UpdateSignedStatus(ctx, file)
+	version.Version, err = fs.fileRepository.CreateVersion(ctx, version, quota)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// TODO: handle duplicate file in sharing to other users
+	fs.syncShares(ctx, file.ID)
 
-	return nil
+	return version.Version, nil
 }
 
-func (fs *fileService) verifyFile(ctx context.Context, fileContent []byte) (SignatureMetadata, error) {
-
-	// Parse file with tokens,
-	// tokens in tokens should be by order of
-	// the tokens inside the file.
-	tokens := []string{
-		"%" + DataCommentKey,
-		"%" + SignatureCommentKey,
-		"%" + PublicKeyCommentKey,
-	}
-
-	// the result follows the token content sequence
-	results := [3]string{}
-
-	// counter is a pointer to the token that is
-	// going to be parsed
-	ctr := 0
-
-	// idx is a pointer to where the file is reading.
-	idx := 0
-
-	stringFileContent := string(fileContent)
+// verifyFile checks the signature of a file and resolves its signer
+// from the signing key registry, the public key embedded in the file
+// only proves that the signature matches it.
+func (fs *fileService) verifyFile(ctx context.Context, fileContent []byte, signature []byte) (*VerifyResult, error) {
+	return fs.verify(ctx, fileContent, signature, &VerificationReport{})
+}
 
-	var buffer []byte
-	for idx < len(stringFileContent) {
-		if ctr <= 2 &&
-			idx+len(tokens[ctr]) < len(stringFileContent) &&
-			stringFileContent[idx:idx+len(tokens[ctr])] == tokens[ctr] {
+// reportFile verifies the signatures of a file and reports
+// the outcome of each of their checks along with a verdict.
+func (fs *fileService) reportFile(ctx context.Context, fileContent []byte, signature []byte) *VerificationReport {
+	report := &VerificationReport{}
 
-			if ctr > 0 && len(buffer) > 0 {
-				results[ctr-1] = string(buffer[:len(buffer)-1])
-				buffer = []byte{}
-			}
+	_, err := fs.verify(ctx, fileContent, signature, report)
+	report.conclude(err)
 
-			idx += len(stringFileContent[idx : idx+len(tokens[ctr])])
-			ctr++
-		}
+	return report
+}
 
-		if ctr > 0 {
-			buffer = append(buffer, stringFileContent[idx])
-		}
+// verify checks the signatures of a file, recording their checks in
+// report as they are done. A signature revoked by its signer fails
+// once every other check of every signature holds.
+func (fs *fileService) verify(ctx context.Context, fileContent []byte, signature []byte, report *VerificationReport) (*VerifyResult, error) {
+	res, err := fs.verifySignatures(ctx, fileContent, signature, report)
+	if err != nil {
+		return nil, err
+	}
 
-		if idx == len(stringFileContent)-1 && ctr != 0 {
-			results[ctr-1] = string(buffer)
+	for _, sr := range report.Signatures {
+		err = fs.checkRevocation(ctx, sr)
+		if err != nil {
+			return nil, err
 		}
-
-		idx++
 	}
 
-	if ctr != 3 {
-		return SignatureMetadata{}, errors.New("no signature detected")
+	return res, nil
+}
+
+// verifySignatures checks the signatures of a file in their format,
+// leaving out whether their signers revoked them.
+func (fs *fileService) verifySignatures(ctx context.Context, fileContent []byte, signature []byte, report *VerificationReport) (*VerifyResult, error) {
+	if signature != nil {
+		return fs.verifyDetached(ctx, fileContent, signature, report)
 	}
 
-	pubKey, err := fs.guard.ParsePublicKey(results[2])
-	if err != nil {
-		return SignatureMetadata{}, err
+	if DetectContentType(fileContent) == PDF {
+		signatures := pdf.Signatures(fileContent)
+		if len(signatures) > 0 {
+			return fs.verifyPDF(ctx, fileContent, signatures, report)
+		}
 	}
 
-	var signatureMetadata SignatureMetadata
+	return fs.verifyEmbedded(ctx, fileContent, report)
+}
 
-	err = json.Unmarshal([]byte(results[0]), &signatureMetadata)
+// resolveSigner sets the signer status of res from the
+// registered keys of the user the signature claims.
+func (fs *fileService) resolveSigner(ctx context.Context, res *VerifyResult) error {
+	key, err := fs.userService.GetSigningKey(ctx, res.SignBy, res.EmbeddedKeyFingerprint)
 	if err != nil {
-		return SignatureMetadata{}, err
+		return err
 	}
 
-	err = fs.guard.VerifyRSA(pubKey, []byte(results[1]), []byte(results[0]))
-	if err != nil {
-		return SignatureMetadata{}, err
+	switch {
+	case key == nil:
+		res.Signer = SignerUnknown
+	case key.Current:
+		res.Signer = SignerCurrentKey
+	default:
+		res.Signer = SignerHistoricalKey
 	}
 
-	return signatureMetadata, nil
+	return nil
 }
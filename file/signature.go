@@ -0,0 +1,341 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encryption/guard/cms"
+	"encryption/guard/timestamp"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoSignature        = errors.New("no signature detected")
+	ErrContentNotCovered  = errors.New("signature does not cover the file content, the file must be signed again")
+	ErrContentModified    = errors.New("file content was modified after it was signed")
+	ErrKeyMismatch        = errors.New("signed key fingerprint does not match the embedded public key")
+	errMalformedSignature = errors.New("malformed signature block")
+)
+
+// Markers of the signature block appended to signed files.
+var (
+	dataMarker      = []byte("\n%" + DataCommentKey)
+	signatureMarker = []byte("\n%" + SignatureCommentKey)
+	publicKeyMarker = []byte("\n%" + PublicKeyCommentKey)
+	timestampMarker = []byte("\n%" + TimestampCommentKey)
+)
+
+// signedBlock is a signature block split from a signed file.
+type signedBlock struct {
+	// Content is the content preceding the block,
+	// the part of the file covered by the signature.
+	Content   []byte
+	Metadata  []byte
+	Signature []byte
+	PublicKey []byte
+
+	// Timestamp is the timestamp token over the signature,
+	// nil for blocks signed before timestamps.
+	Timestamp []byte
+}
+
+// contentDigest returns the hex encoded sha-256 of content.
+func contentDigest(content []byte) string {
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:])
+}
+
+// signEmbedded signs metadata about content and its signer, appending
+// the signature block and a timestamp of the signature to content.
+func (fs *fileService) signEmbedded(ctx context.Context, content []byte, user *user.User, privateKey *rsa.PrivateKey) ([]byte, error) {
+	fingerprint, err := signingkey.Fingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	byteSignatureMetadata, err := embeddedMetadata(content, user, fingerprint, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := fs.guard.SignRSA(privateKey, byteSignatureMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := fs.timestampAuthority.Timestamp(ctx, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	// append signature & public key to file
+	return appendSignature(content, byteSignatureMetadata, signature, []byte(user.PublicKey), token), nil
+}
+
+// embeddedMetadata returns the signed metadata of an embedded
+// signature of content by the key of user with the fingerprint.
+func embeddedMetadata(content []byte, user *user.User, fingerprint string, signDate time.Time) ([]byte, error) {
+	// create signature metadata about the file and user, the
+	// digest binds the signature to the content of the file
+	return json.Marshal(SignatureMetadata{
+		SignDate:       signDate,
+		SignBy:         user.Username,
+		Contact:        user.Email,
+		Digest:         contentDigest(content),
+		KeyFingerprint: fingerprint,
+	})
+}
+
+// appendSignature appends the signature block of metadata to
+// content. The timestamp token is base64 encoded so that it can
+// not hold a marker, it is left out when nil.
+func appendSignature(content []byte, metadata []byte, signature []byte, publicKey []byte, token []byte) []byte {
+	res := make([]byte, 0, len(content)+len(metadata)+len(signature)+len(publicKey)+len(token)*2+64)
+	res = append(res, content...)
+	res = append(res, dataMarker...)
+	res = append(res, metadata...)
+	res = append(res, signatureMarker...)
+	res = append(res, signature...)
+	res = append(res, publicKeyMarker...)
+	res = append(res, publicKey...)
+
+	if token != nil {
+		res = append(res, timestampMarker...)
+		res = append(res, base64.StdEncoding.EncodeToString(token)...)
+	}
+
+	return res
+}
+
+// parseSignature splits the last signature block from content. The
+// metadata is JSON and can not hold a raw marker, while the binary
+// signature is delimited by the last public key marker.
+func parseSignature(content []byte) (signedBlock, error) {
+	dataIdx := bytes.LastIndex(content, dataMarker)
+	if dataIdx < 0 {
+		return signedBlock{}, ErrNoSignature
+	}
+
+	rest := content[dataIdx+len(dataMarker):]
+	signatureIdx := bytes.Index(rest, signatureMarker)
+	if signatureIdx < 0 {
+		return signedBlock{}, errMalformedSignature
+	}
+
+	metadata := rest[:signatureIdx]
+	rest = rest[signatureIdx+len(signatureMarker):]
+
+	publicKeyIdx := bytes.LastIndex(rest, publicKeyMarker)
+	if publicKeyIdx < 0 {
+		return signedBlock{}, errMalformedSignature
+	}
+
+	block := signedBlock{
+		Content:   content[:dataIdx],
+		Metadata:  metadata,
+		Signature: rest[:publicKeyIdx],
+		PublicKey: rest[publicKeyIdx+len(publicKeyMarker):],
+	}
+
+	timestampIdx := bytes.Index(block.PublicKey, timestampMarker)
+	if timestampIdx >= 0 {
+		token, err := base64.StdEncoding.DecodeString(string(block.PublicKey[timestampIdx+len(timestampMarker):]))
+		if err != nil {
+			return signedBlock{}, errMalformedSignature
+		}
+
+		block.Timestamp = token
+		block.PublicKey = block.PublicKey[:timestampIdx]
+	}
+
+	return block, nil
+}
+
+// verifyEmbedded checks the signature block appended to content, its
+// timestamp and the revocation of its key and resolves its signer.
+func (fs *fileService) verifyEmbedded(ctx context.Context, content []byte, report *VerificationReport) (*VerifyResult, error) {
+	block, err := parseSignature(content)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := report.addSignature(SignatureFormatEmbedded)
+	sr.ID = signatureID(block.Signature)
+	sr.ByteRange = []int{0, len(block.Content)}
+	sr.Certificate.Status = CheckAbsent
+
+	pubKey, err := fs.guard.ParsePublicKey(string(block.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	var signatureMetadata SignatureMetadata
+
+	err = json.Unmarshal(block.Metadata, &signatureMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	sr.Signer.Name = signatureMetadata.SignBy
+	sr.Signer.Contact = signatureMetadata.Contact
+	sr.Signer.KeyFingerprint = signatureMetadata.KeyFingerprint
+	sr.SignDate = &signatureMetadata.SignDate
+
+	err = fs.guard.VerifyRSA(pubKey, block.Signature, block.Metadata)
+	sr.SignatureValue = checkStatus(err)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signature only proves the metadata, the content
+	// is checked against the digest it holds
+	if signatureMetadata.Digest == "" {
+		sr.ContentDigest.Status = CheckFailed
+		return nil, ErrContentNotCovered
+	}
+
+	sr.setDigest(signatureMetadata.Digest, contentDigest(block.Content))
+	if sr.ContentDigest.Status == CheckFailed {
+		return nil, ErrContentModified
+	}
+
+	fingerprint, err := signingkey.Fingerprint(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if signatureMetadata.KeyFingerprint != "" && signatureMetadata.KeyFingerprint != fingerprint {
+		return nil, ErrKeyMismatch
+	}
+	sr.Signer.KeyFingerprint = fingerprint
+
+	var token *timestamp.Token
+	if block.Timestamp != nil {
+		token, err = fs.timestampAuthority.Verify(block.Timestamp, block.Signature)
+	}
+	sr.setTimestamp(token, err)
+	if err != nil {
+		return nil, err
+	}
+
+	checkTime, err := provenTime(signatureMetadata.SignDate, token)
+	if err != nil {
+		sr.Timestamp.Status = CheckFailed
+		return nil, err
+	}
+
+	// embedded signatures carry no certificate, only
+	// the revocation of their key is checked
+	err = fs.certificateAuthority.CheckKey(ctx, fingerprint, checkTime, token != nil)
+	sr.Certificate.Revocation = revocationStatus(err)
+	err = sr.keyError(err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := VerifyResult{
+		SignatureMetadata:      signatureMetadata,
+		EmbeddedKeyFingerprint: fingerprint,
+		Format:                 SignatureFormatEmbedded,
+	}
+	res.setTimestamp(token)
+
+	err = fs.resolveSigner(ctx, &res)
+	if err != nil {
+		return nil, err
+	}
+	sr.setSigner(&res)
+
+	return &res, nil
+}
+
+// verifySigner checks the timestamp and certificate of signer, whose
+// signature was verified, and describes it. signDate and contact are
+// the ones claimed outside of the signature, the signing time and the
+// certificate of signer are used instead when they hold them.
+func (fs *fileService) verifySigner(
+	ctx context.Context,
+	signer cms.SignerInfo,
+	certs []*x509.Certificate,
+	signDate time.Time,
+	contact string,
+	sr *SignatureReport,
+) (*VerifyResult, error) {
+	digest, err := signer.MessageDigest()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := signingkey.Fingerprint(signer.Certificate.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if signingTime, ok := signer.SigningTime(); ok && signDate.IsZero() {
+		signDate = signingTime
+	}
+	sr.SignDate = &signDate
+
+	token, err := fs.verifySignerTimestamp(signer)
+	sr.setTimestamp(token, err)
+	if err != nil {
+		return nil, err
+	}
+
+	checkTime, err := provenTime(signDate, token)
+	if err != nil {
+		sr.Timestamp.Status = CheckFailed
+		return nil, err
+	}
+
+	certificate, err := fs.checkCertificate(ctx, signer, certs, checkTime, token != nil)
+	sr.setCertificateCheck(certificate, err)
+	err = sr.keyError(err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signer.Certificate.EmailAddresses) > 0 {
+		contact = signer.Certificate.EmailAddresses[0]
+	}
+
+	res := VerifyResult{
+		SignatureMetadata: SignatureMetadata{
+			SignDate:       signDate,
+			SignBy:         signer.Certificate.Subject.CommonName,
+			Contact:        contact,
+			Digest:         hex.EncodeToString(digest),
+			KeyFingerprint: fingerprint,
+		},
+		EmbeddedKeyFingerprint: fingerprint,
+		Certificate:            certificate,
+	}
+	res.setTimestamp(token)
+
+	err = fs.resolveSigner(ctx, &res)
+	if err != nil {
+		return nil, err
+	}
+	sr.setSigner(&res)
+
+	return &res, nil
+}
+
+// latestSignature returns the result of the latest of the signatures
+// of a file, oldest first, listing them all when it has several.
+func latestSignature(results []VerifyResult) *VerifyResult {
+	res := results[len(results)-1]
+	if len(results) > 1 {
+		res.Signatures = results
+	}
+
+	return &res
+}
@@ -0,0 +1,291 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"encryption/ca"
+	"encryption/guard"
+	"encryption/user"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeUsers resolves signing keys by username and fingerprint.
+type fakeUsers struct {
+	keys  map[string]signingkey.SigningKey
+	users map[uint64]*user.User
+}
+
+func (f *fakeUsers) GetUserByUsername(ctx context.Context, username string) (*user.User, error) {
+	for _, u := range f.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, errors.New("User with related username does not exists")
+}
+
+func (f *fakeUsers) GetUserWithRSA(ctx context.Context, userID uint64) (*user.User, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeUsers) GetUserById(ctx context.Context, userID uint64) (*user.User, error) {
+	u, ok := f.users[userID]
+	if !ok {
+		return nil, errors.New("User with related username does not exists")
+	}
+	return u, nil
+}
+
+func (f *fakeUsers) GetCurrentSigningKey(ctx context.Context, userID uint64) (*signingkey.SigningKey, error) {
+	for _, key := range f.keys {
+		if key.UserID == userID && key.Current {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeUsers) GetSigningKey(ctx context.Context, username string, fingerprint string) (*signingkey.SigningKey, error) {
+	key, ok := f.keys[username+"/"+fingerprint]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+// fakeFiles only holds the signature revocations of a file repository.
+type fakeFiles struct {
+	FileRepository
+	revocations map[string]SignatureRevocation
+}
+
+func (f *fakeFiles) CreateSignatureRevocation(ctx context.Context, revocation SignatureRevocation) (uint64, error) {
+	if f.revocations == nil {
+		f.revocations = map[string]SignatureRevocation{}
+	}
+	f.revocations[revocation.SignatureID] = revocation
+	return uint64(len(f.revocations)), nil
+}
+
+func (f *fakeFiles) GetSignatureRevocation(ctx context.Context, signatureID string) (SignatureRevocation, error) {
+	revocation, ok := f.revocations[signatureID]
+	if !ok {
+		return SignatureRevocation{}, pgx.ErrNoRows
+	}
+	return revocation, nil
+}
+
+// newTestFileService returns a file service signing and verifying with
+// fakes, no user holds a signing key and the authority trusts no
+// certificate. opts replace its dependencies.
+func newTestFileService(t *testing.T, opts ...func(*fileService)) *fileService {
+	fs := &fileService{
+		guard:                guard.Guard{Mode: 1},
+		fileRepository:       &fakeFiles{},
+		userService:          &fakeUsers{},
+		certificateAuthority: &fakeAuthority{},
+		timestampAuthority:   newTimestamps(t),
+	}
+
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	return fs
+}
+
+func withUsers(users *fakeUsers) func(*fileService) {
+	return func(fs *fileService) { fs.userService = users }
+}
+
+func withAuthority(authority *fakeAuthority) func(*fileService) {
+	return func(fs *fileService) { fs.certificateAuthority = authority }
+}
+
+func withFiles(files *fakeFiles) func(*fileService) {
+	return func(fs *fileService) { fs.fileRepository = files }
+}
+
+func newSigningKey(t *testing.T) (*rsa.PrivateKey, string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint, err := signingkey.Fingerprint(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return privateKey, fingerprint
+}
+
+// fakeAuthority hands out a fixed chain, it trusts no
+// certificate and only knows revoked keys by fingerprint.
+type fakeAuthority struct {
+	chain   []*x509.Certificate
+	revoked map[string]ca.Certificate
+}
+
+func (f *fakeAuthority) Chain(ctx context.Context, userID uint64, username string, email string, publicKey *rsa.PublicKey) ([]*x509.Certificate, error) {
+	return f.chain, nil
+}
+
+func (f *fakeAuthority) Check(ctx context.Context, cert *x509.Certificate, intermediates []*x509.Certificate, signTime time.Time, proven bool) error {
+	return ca.ErrUntrustedCertificate
+}
+
+func (f *fakeAuthority) CheckKey(ctx context.Context, fingerprint string, signTime time.Time, proven bool) error {
+	if cert, ok := f.revoked[fingerprint]; ok && cert.Revokes(signTime, proven) {
+		return ca.ErrCertificateRevoked
+	}
+	return nil
+}
+
+// signerCertificate returns a self-signed certificate
+// binding privateKey to the username and email of user.
+func signerCertificate(t *testing.T, user *user.User, privateKey *rsa.PrivateKey, now time.Time) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: user.Username},
+		EmailAddresses: []string{user.Email},
+		NotBefore:      now.Add(-time.Minute),
+		NotAfter:       now.AddDate(1, 0, 0),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func signSample(t *testing.T, g *guard.Guard, privateKey *rsa.PrivateKey, content []byte, metadata SignatureMetadata) []byte {
+	byteMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := g.SignRSA(privateKey, byteMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+	})
+
+	return appendSignature(content, byteMetadata, signature, publicKey, nil)
+}
+
+func TestVerifyFileContentDigest(t *testing.T) {
+	fs := newTestFileService(t)
+	privateKey, _ := newSigningKey(t)
+	content := []byte("%PDF-1.4\nquarterly report\n%%EOF")
+
+	metadata := SignatureMetadata{
+		SignDate: time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC),
+		SignBy:   "alice",
+		Contact:  "alice@example.com",
+		Digest:   contentDigest(content),
+	}
+
+	signed := signSample(t, &fs.guard, privateKey, content, metadata)
+
+	res, err := fs.verifyFile(context.Background(), signed, nil)
+	if err != nil {
+		t.Fatalf("verifyFile() error = %v", err)
+	}
+	if res.SignBy != "alice" || res.Digest != metadata.Digest {
+		t.Errorf("verifyFile() = %+v, want %+v", res.SignatureMetadata, metadata)
+	}
+
+	tampered := append([]byte{}, signed...)
+	tampered[10] = 'Q'
+	_, err = fs.verifyFile(context.Background(), tampered, nil)
+	if !errors.Is(err, ErrContentModified) {
+		t.Errorf("tampered content error = %v, want %v", err, ErrContentModified)
+	}
+
+	metadata.Digest = ""
+	_, err = fs.verifyFile(context.Background(), signSample(t, &fs.guard, privateKey, content, metadata), nil)
+	if !errors.Is(err, ErrContentNotCovered) {
+		t.Errorf("metadata without digest error = %v, want %v", err, ErrContentNotCovered)
+	}
+
+	_, err = fs.verifyFile(context.Background(), content, nil)
+	if !errors.Is(err, ErrNoSignature) {
+		t.Errorf("unsigned content error = %v, want %v", err, ErrNoSignature)
+	}
+}
+
+func TestVerifyFileSigner(t *testing.T) {
+	currentKey, currentFingerprint := newSigningKey(t)
+	retiredKey, retiredFingerprint := newSigningKey(t)
+	forgedKey, forgedFingerprint := newSigningKey(t)
+
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + currentFingerprint: {Fingerprint: currentFingerprint, Current: true},
+		"alice/" + retiredFingerprint: {Fingerprint: retiredFingerprint},
+	}}
+	fs := newTestFileService(t, withUsers(users))
+	content := []byte("contract")
+
+	tests := []struct {
+		name        string
+		key         *rsa.PrivateKey
+		fingerprint string
+		want        string
+	}{
+		{"current key", currentKey, currentFingerprint, SignerCurrentKey},
+		{"retired key", retiredKey, retiredFingerprint, SignerHistoricalKey},
+		{"key claiming alice", forgedKey, forgedFingerprint, SignerUnknown},
+	}
+
+	for _, tt := range tests {
+		signed := signSample(t, &fs.guard, tt.key, content, SignatureMetadata{
+			SignBy:         "alice",
+			Digest:         contentDigest(content),
+			KeyFingerprint: tt.fingerprint,
+		})
+
+		res, err := fs.verifyFile(context.Background(), signed, nil)
+		if err != nil {
+			t.Fatalf("%v: verifyFile() error = %v", tt.name, err)
+		}
+		if res.Signer != tt.want || res.EmbeddedKeyFingerprint != tt.fingerprint {
+			t.Errorf("%v: signer = %v (%v), want %v (%v)", tt.name, res.Signer, res.EmbeddedKeyFingerprint, tt.want, tt.fingerprint)
+		}
+	}
+
+	// the signed fingerprint must match the embedded key
+	signed := signSample(t, &fs.guard, forgedKey, content, SignatureMetadata{
+		SignBy:         "alice",
+		Digest:         contentDigest(content),
+		KeyFingerprint: currentFingerprint,
+	})
+	_, err := fs.verifyFile(context.Background(), signed, nil)
+	if err == nil {
+		t.Error("mismatching key fingerprint was accepted")
+	}
+}
@@ -0,0 +1,111 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// Thumbnail settings.
+const (
+	ThumbnailSize    = 256
+	thumbnailQuality = 80
+
+	// maxImagePixels bounds the images decoded for a thumbnail,
+	// a small file can declare dimensions that do not fit in memory
+	maxImagePixels = 50_000_000
+)
+
+var errNoThumbnail = errors.New("thumbnail is not available")
+
+// thumbnailFileTypes are the file types
+// having a thumbnail generated on upload.
+var thumbnailFileTypes = []string{ProfilePicture, IDCard}
+
+// GenerateThumbnail decodes an image and returns a JPEG encoded
+// copy scaled down to fit in ThumbnailSize x ThumbnailSize.
+// errNoThumbnail is returned for contents that can not be decoded,
+// ErrFileTooLarge for images of more than maxImagePixels pixels.
+func GenerateThumbnail(contentType string, content []byte) ([]byte, error) {
+	if contentType != JPEG && contentType != PNG {
+		return nil, errNoThumbnail
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, fmt.Errorf("%w (%vx%v pixels)", ErrFileTooLarge, config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	dst := resize(src, ThumbnailSize)
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// resize scales src down to fit in a size x size box keeping its
+// aspect ratio. Each destination pixel is the average of the
+// source pixels it covers.
+func resize(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	dstW, dstH := srcW, srcH
+	if srcW > size || srcH > size {
+		if srcW >= srcH {
+			dstW, dstH = size, max(1, srcH*size/srcW)
+		} else {
+			dstW, dstH = max(1, srcW*size/srcH), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// colors are alpha premultiplied, transparent
+					// pixels are blended onto a white background
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,61 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func TestGenerateThumbnail(t *testing.T) {
+	content, err := os.ReadFile("../guard/test_files/tux.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumbnail, err := GenerateThumbnail(PNG, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if format != "jpeg" {
+		t.Errorf("thumbnail format = %v, want jpeg", format)
+	}
+
+	if config.Width > ThumbnailSize || config.Height > ThumbnailSize {
+		t.Errorf("thumbnail size = %vx%v, want at most %v", config.Width, config.Height, ThumbnailSize)
+	}
+
+	_, err = GenerateThumbnail(PDF, content)
+	if err != errNoThumbnail {
+		t.Errorf("pdf thumbnail error = %v, want %v", err, errNoThumbnail)
+	}
+}
+
+func TestGenerateThumbnailDimensions(t *testing.T) {
+	// the header of a PNG declaring 50000x50000 pixels
+	var content bytes.Buffer
+	err := png.Encode(&content, image.NewGray(image.Rect(0, 0, 1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := content.Bytes()
+	binary.BigEndian.PutUint32(header[16:], 50000)
+	binary.BigEndian.PutUint32(header[20:], 50000)
+	binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+
+	_, err = GenerateThumbnail(PNG, header)
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("oversized image error = %v, want %v", err, ErrFileTooLarge)
+	}
+}
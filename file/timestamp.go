@@ -0,0 +1,68 @@
+package file
+
+import (
+	"context"
+	"encryption/guard/cms"
+	"encryption/guard/timestamp"
+	"errors"
+	"time"
+)
+
+// timestampTolerance is how far the signing time claimed by a signer
+// may be after the time attested by the timestamp of its signature,
+// the clocks of the server and of a remote TSA may drift.
+const timestampTolerance = 5 * time.Minute
+
+var ErrTimestampMismatch = errors.New("signing time is later than the timestamp of the signature")
+
+// timestampSigner attaches a timestamp token over the
+// signature value of signer to its unsigned attributes.
+func (fs *fileService) timestampSigner(ctx context.Context, signer *cms.SignerInfo) error {
+	token, err := fs.timestampAuthority.Timestamp(ctx, signer.Signature)
+	if err != nil {
+		return err
+	}
+
+	signer.UnsignedAttributes = append(signer.UnsignedAttributes, cms.Attribute{
+		Type:  cms.OIDAttributeTimeStampToken,
+		Value: token,
+	})
+
+	return nil
+}
+
+// verifySignerTimestamp verifies the timestamp token of
+// signer, nil when the signature was not timestamped.
+func (fs *fileService) verifySignerTimestamp(signer cms.SignerInfo) (*timestamp.Token, error) {
+	token, ok := signer.UnsignedAttribute(cms.OIDAttributeTimeStampToken)
+	if !ok {
+		return nil, nil
+	}
+
+	return fs.timestampAuthority.Verify(token, signer.Signature)
+}
+
+// provenTime returns the time a signature is checked at, the time
+// attested by its timestamp or else the one claimed by its signer.
+func provenTime(claimed time.Time, token *timestamp.Token) (time.Time, error) {
+	if token == nil {
+		return claimed, nil
+	}
+
+	if claimed.After(token.GenTime.Add(timestampTolerance)) {
+		return time.Time{}, ErrTimestampMismatch
+	}
+
+	return token.GenTime, nil
+}
+
+// setTimestamp records the timestamp of the signature in res.
+func (res *VerifyResult) setTimestamp(token *timestamp.Token) {
+	if token == nil {
+		return
+	}
+
+	genTime := token.GenTime
+	res.Timestamp = &genTime
+	res.TimestampAuthority = token.Certificate.Subject.CommonName
+}
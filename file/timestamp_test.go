@@ -0,0 +1,197 @@
+package file
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"encryption/ca"
+	"encryption/guard/timestamp"
+	signingkey "encryption/user/signing_key"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// tsaIssuer certifies the key of a local TSA with a throwaway root.
+type tsaIssuer struct {
+	root    *x509.Certificate
+	rootKey *rsa.PrivateKey
+}
+
+func (ti *tsaIssuer) IssueTimestampCertificate(ctx context.Context, publicKey *rsa.PublicKey) ([]*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ti.root, publicKey, ti.rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*x509.Certificate{cert, ti.root}, nil
+}
+
+// newTimestamps returns an authority timestamping with a local TSA.
+func newTimestamps(t *testing.T) *timestamp.Authority {
+	rootKey, _ := newSigningKey(t)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := timestamp.NewLocalAuthority(context.Background(), &tsaIssuer{root: root, rootKey: rootKey}, timestamp.OIDAnyPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return timestamp.NewAuthority(local, []*x509.Certificate{root})
+}
+
+func TestVerifyFileTimestamp(t *testing.T) {
+	ctx := context.Background()
+	privateKey, fingerprint := newSigningKey(t)
+	users := &fakeUsers{keys: map[string]signingkey.SigningKey{
+		"alice/" + fingerprint: {Fingerprint: fingerprint},
+	}}
+	authority := &fakeAuthority{}
+	fs := newTestFileService(t, withUsers(users), withAuthority(authority))
+	content := []byte("contract")
+
+	publicKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+	})
+
+	// sign claiming signDate, with a timestamp of now
+	sign := func(signDate time.Time) []byte {
+		metadata, err := json.Marshal(SignatureMetadata{
+			SignDate:       signDate,
+			SignBy:         "alice",
+			Digest:         contentDigest(content),
+			KeyFingerprint: fingerprint,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature, err := fs.guard.SignRSA(privateKey, metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := fs.timestampAuthority.Timestamp(ctx, signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return appendSignature(content, metadata, signature, publicKey, token)
+	}
+
+	// the key was superseded after the signature was timestamped
+	revokedAt := time.Now().Add(time.Minute)
+	authority.revoked = map[string]ca.Certificate{
+		fingerprint: {RevokedAt: &revokedAt, RevocationReason: ca.ReasonSuperseded},
+	}
+
+	signDate := time.Now().Add(2 * time.Minute)
+	res, err := fs.verifyFile(ctx, sign(signDate), nil)
+	if err != nil {
+		t.Fatalf("verifyFile() error = %v", err)
+	}
+	if res.Timestamp == nil || res.Timestamp.After(revokedAt) || res.TimestampAuthority != "Test TSA" {
+		t.Errorf("verifyFile() timestamp = %v by %q", res.Timestamp, res.TimestampAuthority)
+	}
+
+	// without the timestamp only the claimed time is known
+	_, err = fs.verifyFile(ctx, signSample(t, &fs.guard, privateKey, content, SignatureMetadata{
+		SignDate:       signDate,
+		SignBy:         "alice",
+		Digest:         contentDigest(content),
+		KeyFingerprint: fingerprint,
+	}), nil)
+	if !errors.Is(err, ca.ErrCertificateRevoked) {
+		t.Errorf("untimestamped error = %v, want %v", err, ca.ErrCertificateRevoked)
+	}
+
+	// a compromised key keeps the signatures timestamped before
+	// the revocation, not the ones only claimed to be earlier
+	authority.revoked = map[string]ca.Certificate{
+		fingerprint: {RevokedAt: &revokedAt, RevocationReason: ca.ReasonKeyCompromise},
+	}
+
+	_, err = fs.verifyFile(ctx, sign(signDate), nil)
+	if err != nil {
+		t.Errorf("key compromise: verifyFile() error = %v", err)
+	}
+
+	_, err = fs.verifyFile(ctx, signSample(t, &fs.guard, privateKey, content, SignatureMetadata{
+		SignDate:       time.Now().Add(-time.Hour),
+		SignBy:         "alice",
+		Digest:         contentDigest(content),
+		KeyFingerprint: fingerprint,
+	}), nil)
+	if !errors.Is(err, ca.ErrCertificateRevoked) {
+		t.Errorf("key compromise: untimestamped error = %v, want %v", err, ca.ErrCertificateRevoked)
+	}
+
+	expiredAt := time.Now().Add(-time.Minute)
+	authority.revoked = map[string]ca.Certificate{
+		fingerprint: {RevokedAt: &expiredAt, RevocationReason: ca.ReasonKeyCompromise},
+	}
+
+	_, err = fs.verifyFile(ctx, sign(time.Now()), nil)
+	if !errors.Is(err, ca.ErrCertificateRevoked) {
+		t.Errorf("key compromise: timestamped after revocation error = %v, want %v", err, ca.ErrCertificateRevoked)
+	}
+
+	_, err = fs.verifyFile(ctx, sign(time.Now().Add(time.Hour)), nil)
+	if !errors.Is(err, ErrTimestampMismatch) {
+		t.Errorf("claimed time after timestamp error = %v, want %v", err, ErrTimestampMismatch)
+	}
+
+	// a token over another signature is rejected
+	signed, err := parseSignature(sign(signDate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := parseSignature(sign(signDate.Add(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fs.verifyFile(ctx, appendSignature(content, signed.Metadata, signed.Signature, publicKey, other.Timestamp), nil)
+	if !errors.Is(err, timestamp.ErrImprintMismatch) {
+		t.Errorf("swapped timestamp error = %v, want %v", err, timestamp.ErrImprintMismatch)
+	}
+}
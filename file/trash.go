@@ -0,0 +1,184 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultTrashRetention is the time files stay in
+// the trash before they are purged.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashRetentionFromEnv returns the TRASH_RETENTION duration,
+// defaulting to DefaultTrashRetention.
+func TrashRetentionFromEnv() time.Duration {
+	retention, err := time.ParseDuration(os.Getenv("TRASH_RETENTION"))
+	if err != nil || retention < 0 {
+		return DefaultTrashRetention
+	}
+
+	return retention
+}
+
+// getTrashedFile gets a file in the trash of userID.
+func (fs *fileService) getTrashedFile(ctx context.Context, userID uint64, id uint64) (File, error) {
+	file, err := fs.fileRepository.GetTrashed(ctx, id)
+	if err != nil && err != pgx.ErrNoRows {
+		return File{}, err
+	}
+	if err == pgx.ErrNoRows {
+		return File{}, errors.New("Requested file not found in trash")
+	}
+
+	if file.UserID != userID {
+		return File{}, errors.New("You do not have access to this resource data")
+	}
+
+	return file, nil
+}
+
+func (fs *fileService) listTrash(ctx context.Context, userID uint64) ([]File, error) {
+	files, err := fs.fileRepository.ListTrash(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]File{}, files...), nil
+}
+
+// restoreFile moves a file out of the trash. Permissions to the
+// file are kept while it is in the trash and apply again.
+func (fs *fileService) restoreFile(ctx context.Context, userID uint64, id uint64) error {
+	file, err := fs.getTrashedFile(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	err = fs.fileRepository.Restore(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// share to folder permissions granted while the file was trashed
+	fs.shareToFolder(ctx, file)
+
+	return nil
+}
+
+// purgeFile deletes a file in the trash permanently.
+func (fs *fileService) purgeFile(ctx context.Context, userID uint64, id uint64) error {
+	file, err := fs.getTrashedFile(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return fs.purge(ctx, file)
+}
+
+// emptyTrash deletes every file in the trash of the user permanently.
+func (fs *fileService) emptyTrash(ctx context.Context, userID uint64) error {
+	files, err := fs.fileRepository.ListTrash(ctx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err = fs.purge(ctx, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purge deletes a file with its versions, shared copies and keys.
+// Rows are deleted first, blobs and keys left over by a failure
+// afterwards are no longer referenced and are only logged.
+func (fs *fileService) purge(ctx context.Context, file File) error {
+	versions, err := fs.fileRepository.ListVersions(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+
+	filePermissions, err := fs.filePermissionRepository.ListByFileID(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+
+	err = fs.fileRepository.Delete(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, version := range versions {
+		paths = append(paths, version.Filepath)
+		if version.ThumbnailPath != "" {
+			paths = append(paths, version.ThumbnailPath)
+		}
+		if version.SignaturePath != "" {
+			paths = append(paths, version.SignaturePath)
+		}
+
+		err = fs.guard.DeleteKey(ctx, fileTable, version.KeyReference)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	for _, filePermission := range filePermissions {
+		if filePermission.Filepath != "" {
+			paths = append(paths, filePermission.Filepath)
+		}
+	}
+
+	for _, path := range paths {
+		err = fs.fileSystem.Remove(path)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return nil
+}
+
+// PurgeTrash deletes the files trashed for longer than retention.
+func (fs *fileService) PurgeTrash(ctx context.Context, retention time.Duration) error {
+	files, err := fs.fileRepository.ListTrash(ctx, 0, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err = fs.purge(ctx, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunTrashPurge calls PurgeTrash every interval until ctx is done.
+func (fs *fileService) RunTrashPurge(ctx context.Context, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := fs.PurgeTrash(ctx, retention)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// getOwnedFile gets a file and checks that userID is its owner.
+func (fs *fileService) getOwnedFile(ctx context.Context, userID uint64, fileID uint64) (File, error) {
+	file, err := fs.fileRepository.Get(ctx, fileID)
+	if err != nil && err != pgx.ErrNoRows {
+		return File{}, err
+	}
+	if err == pgx.ErrNoRows {
+		return File{}, errors.New("Requested file not found")
+	}
+
+	if file.UserID != userID {
+		return File{}, errors.New("You do not have access to this resource data")
+	}
+
+	return file, nil
+}
+
+// storeVersion uploads a new version of a file. The content goes
+// through the same processing steps as a new file of the same type.
+func (fs *fileService) storeVersion(
+	ctx context.Context,
+	userID uint64,
+	fileID uint64,
+	header multipart.FileHeader,
+	file multipart.File,
+	options UploadOptions,
+) (*Version, error) {
+	data, err := fs.getOwnedFile(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	fileContent, contentType, err := fs.readUpload(header, file, data.Type, options)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := fs.checkQuota(ctx, userID, data.Type, int64(len(fileContent)))
+	if err != nil {
+		return nil, err
+	}
+
+	var scanned File
+	err = fs.scanContent(ctx, &scanned, fileContent)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := fs.writeContent(ctx, data.Type, contentType, fileContent)
+	if err != nil {
+		return nil, err
+	}
+
+	version.FileID = data.ID
+	version.Filename = header.Filename
+	version.ScanStatus = scanned.ScanStatus
+
+	version.Version, err = fs.fileRepository.CreateVersion(ctx, version, quota)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.syncShares(ctx, data.ID)
+
+	return &version, nil
+}
+
+// listVersions lists the history of a file, latest first.
+func (fs *fileService) listVersions(ctx context.Context, userID uint64, fileID uint64) ([]Version, error) {
+	_, err := fs.getOwnedFile(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := fs.fileRepository.ListVersions(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// readVersion reads and decrypts the content of a version.
+func (fs *fileService) readVersion(ctx context.Context, version Version) ([]byte, error) {
+	if version.ScanStatus == ScanQuarantined || version.ScanStatus == ScanInfected {
+		return nil, ErrQuarantined
+	}
+
+	if version.Damaged {
+		return nil, ErrDamaged
+	}
+
+	fileContent, err := fs.fileSystem.Read(version.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := fs.guard.GetKey(ctx, fileTable, version.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.guard.Decrypt(key.PlainKey, fileContent)
+}
+
+func (fs *fileService) getOwnedVersion(
+	ctx context.Context,
+	userID uint64,
+	fileID uint64,
+	version int,
+) (File, Version, error) {
+	data, err := fs.getOwnedFile(ctx, userID, fileID)
+	if err != nil {
+		return File{}, Version{}, err
+	}
+
+	v, err := fs.fileRepository.GetVersion(ctx, fileID, version)
+	if err != nil && err != pgx.ErrNoRows {
+		return File{}, Version{}, err
+	}
+	if err == pgx.ErrNoRows {
+		return File{}, Version{}, errors.New("Requested version not found")
+	}
+
+	return data, v, nil
+}
+
+// getVersion returns the decrypted content of a specific version.
+func (fs *fileService) getVersion(ctx context.Context, userID uint64, fileID uint64, version int) (*File, error) {
+	_, v, err := fs.getOwnedVersion(ctx, userID, fileID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := fs.readVersion(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Filename: v.Filename,
+		Content:  content,
+	}, nil
+}
+
+// restoreVersion makes the content of a previous version the current
+// one by storing it as a new version encrypted with a new key.
+func (fs *fileService) restoreVersion(ctx context.Context, userID uint64, fileID uint64, version int) (*Version, error) {
+	data, v, err := fs.getOwnedVersion(ctx, userID, fileID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Version == data.Version {
+		return nil, errors.New("Requested version is already the current version")
+	}
+
+	content, err := fs.readVersion(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	quota, err := fs.checkQuota(ctx, userID, data.Type, int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := fs.writeContent(ctx, data.Type, DetectContentType(content), content)
+	if err != nil {
+		return nil, err
+	}
+
+	restored.FileID = data.ID
+	restored.Filename = v.Filename
+	restored.IsSigned = v.IsSigned
+	restored.ScanStatus = v.ScanStatus
+
+	// the detached signature still matches the restored content
+	if v.SignaturePath != "" {
+		signature, err := fs.readSignature(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+
+		restored.SignaturePath, err = fs.writeSignature(ctx, restored, signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	restored.Version, err = fs.fileRepository.CreateVersion(ctx, restored, quota)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.syncShares(ctx, data.ID)
+
+	return &restored, nil
+}
@@ -0,0 +1,180 @@
+package file
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// WinZip AES (AE-2) parameters for AES-256 entries.
+const (
+	zipMethodAES          = 99
+	zipFlagEncrypted      = 0x1
+	zipFlagDataDescriptor = 0x8
+	winzipAESExtraID      = 0x9901
+	winzipAESVersion      = 2
+	winzipAES256          = 3
+
+	// zip 5.1 is the first version with AES encryption
+	zipVersionAES = 51
+
+	zipAESKeySize    = 32
+	zipAESSaltSize   = 16
+	zipAESVerifySize = 2
+	zipAESMACSize    = 10
+	zipAESIterations = 1000
+)
+
+// writeEncryptedEntry writes content as a deflated entry encrypted
+// with WinZip AES-256, readable by 7-Zip, WinZip and most archivers.
+// The content is compressed and encrypted as it is read.
+func writeEncryptedEntry(zw *zip.Writer, fh zip.FileHeader, content io.Reader, password string) error {
+	salt := make([]byte, zipAESSaltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return err
+	}
+
+	keys := pbkdf2.Key([]byte(password), salt, zipAESIterations, 2*zipAESKeySize+zipAESVerifySize, sha1.New)
+	encryptionKey, macKey, verifier := keys[:zipAESKeySize], keys[zipAESKeySize:2*zipAESKeySize], keys[2*zipAESKeySize:]
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	// AE-2 entries carry no CRC, the MAC authenticates the data. The
+	// sizes are only known once the data is written, they follow it
+	// in a data descriptor
+	fh.Method = zipMethodAES
+	fh.Flags |= zipFlagEncrypted | zipFlagDataDescriptor
+	fh.CRC32 = 0
+	fh.CreatorVersion = zipVersionAES
+	fh.ReaderVersion = zipVersionAES
+	fh.ModifiedTime, fh.ModifiedDate = msDosTime(fh.Modified)
+	fh.Extra = binary.LittleEndian.AppendUint16(fh.Extra, winzipAESExtraID)
+	fh.Extra = binary.LittleEndian.AppendUint16(fh.Extra, 7)
+	fh.Extra = binary.LittleEndian.AppendUint16(fh.Extra, winzipAESVersion)
+	fh.Extra = append(fh.Extra, 'A', 'E', winzipAES256)
+	fh.Extra = binary.LittleEndian.AppendUint16(fh.Extra, zip.Deflate)
+
+	w, err := zw.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(salt, verifier...))
+	if err != nil {
+		return err
+	}
+
+	aw := &zipAESWriter{w: w, stream: newWinZipCTR(block), mac: hmac.New(sha1.New, macKey)}
+
+	fw, err := flate.NewWriter(aw, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+
+	size, err := io.Copy(fw, content)
+	if err != nil {
+		return err
+	}
+
+	err = fw.Close()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(aw.mac.Sum(nil)[:zipAESMACSize])
+	if err != nil {
+		return err
+	}
+
+	// the zip writer reads the sizes of fh once the entry is closed
+	fh.UncompressedSize64 = uint64(size)
+	fh.CompressedSize64 = uint64(zipAESSaltSize + zipAESVerifySize + aw.n + zipAESMACSize)
+	fh.UncompressedSize = uint32(min(fh.UncompressedSize64, math.MaxUint32))
+	fh.CompressedSize = uint32(min(fh.CompressedSize64, math.MaxUint32))
+
+	return nil
+}
+
+// zipAESWriter encrypts the data written to w with
+// WinZip AES and authenticates the encrypted data.
+type zipAESWriter struct {
+	w      io.Writer
+	stream cipher.Stream
+	mac    hash.Hash
+	buf    []byte
+
+	// n counts the bytes written to w
+	n int64
+}
+
+func (aw *zipAESWriter) Write(p []byte) (int, error) {
+	aw.buf = slices.Grow(aw.buf[:0], len(p))[:len(p)]
+	aw.stream.XORKeyStream(aw.buf, p)
+	aw.mac.Write(aw.buf)
+
+	n, err := aw.w.Write(aw.buf)
+	aw.n += int64(n)
+
+	return n, err
+}
+
+// winZipCTR is AES in the counter mode of WinZip,
+// a little endian counter starting at 1.
+type winZipCTR struct {
+	block   cipher.Block
+	counter uint64
+	stream  [aes.BlockSize]byte
+
+	// used counts the bytes of stream already used
+	used int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst []byte, src []byte) {
+	for len(src) > 0 {
+		if c.used == aes.BlockSize {
+			var counter [aes.BlockSize]byte
+			c.counter++
+			binary.LittleEndian.PutUint64(counter[:8], c.counter)
+			c.block.Encrypt(c.stream[:], counter[:])
+			c.used = 0
+		}
+
+		n := subtle.XORBytes(dst, src, c.stream[c.used:])
+		c.used += n
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// msDosTime converts t to the date and time fields of a zip header,
+// which raw entries do not fill from Modified.
+func msDosTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		return 0, 1<<5 | 1
+	}
+
+	fTime := uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+	fDate := uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+
+	return fTime, fDate
+}
@@ -0,0 +1,74 @@
+package folder
+
+import (
+	"errors"
+	"strings"
+)
+
+const maxNameLength = 255
+
+type CreateFolderRequest struct {
+	UserID   uint64
+	Name     string `json:"name"`
+	ParentID uint64 `json:"parent_id"`
+}
+
+func (r *CreateFolderRequest) Validate() error {
+	name, err := validateName(r.Name)
+	if err != nil {
+		return err
+	}
+	r.Name = name
+
+	return nil
+}
+
+// UpdateFolderRequest renames a folder and/or moves it
+// to another parent. Nil fields are left unchanged.
+type UpdateFolderRequest struct {
+	UserID   uint64
+	ID       uint64
+	Name     *string `json:"name"`
+	ParentID *uint64 `json:"parent_id"`
+}
+
+func (r *UpdateFolderRequest) Validate() error {
+	if r.Name == nil && r.ParentID == nil {
+		return errors.New("Request invalid. Name or parent_id is required")
+	}
+
+	if r.Name != nil {
+		name, err := validateName(*r.Name)
+		if err != nil {
+			return err
+		}
+		r.Name = &name
+	}
+
+	return nil
+}
+
+type ListFoldersRequest struct {
+	UserID         uint64
+	TargetUsername string
+
+	// ParentID lists the subfolders of a folder,
+	// top level folders are listed when 0.
+	ParentID uint64
+}
+
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return "", errors.New("Request invalid. Folder name is required")
+	}
+	if len(name) > maxNameLength {
+		return "", errors.New("Request invalid. Folder name is too long")
+	}
+	if strings.ContainsAny(name, "/\\") {
+		return "", errors.New("Request invalid. Folder name can not contain slashes")
+	}
+
+	return name, nil
+}
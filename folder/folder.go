@@ -0,0 +1,16 @@
+package folder
+
+import "time"
+
+// Folder represents a folder of a user's files.
+type Folder struct {
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"user_id"`
+
+	// ParentID is the id of the parent folder,
+	// 0 for top level folders.
+	ParentID uint64 `json:"parent_id"`
+
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,151 @@
+package folder
+
+import (
+	"context"
+	"encoding/json"
+	"encryption/helper"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type FolderService interface {
+	createFolder(ctx context.Context, request CreateFolderRequest) (*Folder, error)
+	listFolders(ctx context.Context, request ListFoldersRequest) ([]Folder, error)
+	updateFolder(ctx context.Context, request UpdateFolderRequest) (*Folder, error)
+	deleteFolder(ctx context.Context, userID uint64, id uint64) error
+}
+
+type Handler struct {
+	folderService FolderService
+}
+
+func NewFolderHandler(
+	fs FolderService,
+) Handler {
+	return Handler{
+		folderService: fs,
+	}
+}
+
+func (h *Handler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	var request CreateFolderRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+
+	res, err := h.folderService.createFolder(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) ListFolders(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	request := ListFoldersRequest{
+		UserID:         userId,
+		TargetUsername: strings.TrimPrefix(r.URL.Path, "/folders/"),
+	}
+
+	if qParent := r.URL.Query().Get("parent"); qParent != "" {
+		parentID, err := strconv.ParseUint(qParent, 10, 64)
+		if err != nil {
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{
+				Message: "Request invalid. Parent must be a folder id",
+			})
+			return
+		}
+		request.ParentID = parentID
+	}
+
+	res, err := h.folderService.listFolders(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/folder/"), 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var request UpdateFolderRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+	request.ID = id
+
+	res, err := h.folderService.updateFolder(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/folder/"), 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = h.folderService.deleteFolder(r.Context(), userId, id)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrFolderNotEmpty) {
+			status = http.StatusConflict
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "success"})
+}
@@ -0,0 +1,216 @@
+package folder
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DB interface {
+	GetConn() *pgxpool.Pool
+}
+
+type folderRepository struct {
+	db DB
+}
+
+func NewFolderRepository(db DB) *folderRepository {
+	return &folderRepository{
+		db: db,
+	}
+}
+
+func (fr *folderRepository) Create(ctx context.Context, folder Folder) (uint64, error) {
+	stmt := `
+	INSERT INTO
+		folders (
+			user_id,
+			parent_id,
+			name
+		)
+	VALUES (
+		$1,
+		NULLIF($2, 0),
+		$3
+	)
+	RETURNING id
+	`
+
+	err := fr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		folder.UserID,
+		int64(folder.ParentID),
+		folder.Name,
+	).Scan(&folder.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return folder.ID, nil
+}
+
+func (fr *folderRepository) Get(ctx context.Context, id uint64) (Folder, error) {
+	var folder Folder
+
+	stmt := `
+	SELECT
+			id,
+			user_id,
+			COALESCE(parent_id, 0),
+			name,
+			created_at
+	 FROM folders
+	 WHERE id = $1
+	 `
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, id).Scan(
+		&folder.ID,
+		&folder.UserID,
+		&folder.ParentID,
+		&folder.Name,
+		&folder.CreatedAt,
+	)
+	if err != nil {
+		return Folder{}, err
+	}
+
+	return folder, nil
+}
+
+// List lists the folders of a user under parentID,
+// or the top level folders when parentID is 0.
+func (fr *folderRepository) List(ctx context.Context, userID uint64, parentID uint64) ([]Folder, error) {
+	var folders []Folder
+
+	stmt := `
+	SELECT
+			id,
+			user_id,
+			COALESCE(parent_id, 0),
+			name,
+			created_at
+	 FROM folders
+	 WHERE user_id = $1 AND COALESCE(parent_id, 0) = $2
+	 ORDER BY name, id
+	 `
+
+	rows, err := fr.db.GetConn().Query(ctx, stmt, userID, int64(parentID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Folder
+		err := rows.Scan(
+			&f.ID,
+			&f.UserID,
+			&f.ParentID,
+			&f.Name,
+			&f.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		folders = append(folders, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+func (fr *folderRepository) Update(ctx context.Context, folder Folder) error {
+	stmt := `
+		UPDATE
+			folders SET
+				parent_id = NULLIF($2, 0),
+				name = $3
+		WHERE id = $1
+	`
+
+	_, err := fr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		folder.ID,
+		int64(folder.ParentID),
+		folder.Name,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete deletes a folder along with its
+// permissions and permission requests.
+func (fr *folderRepository) Delete(ctx context.Context, id uint64) error {
+	tx, err := fr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM folder_permissions WHERE folder_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM folder_notifications WHERE folder_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM folders WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CountContents returns the number of subfolders and
+// files in a folder, including the files in the trash.
+func (fr *folderRepository) CountContents(ctx context.Context, id uint64) (uint64, error) {
+	var count uint64
+
+	stmt := `
+	SELECT
+		(SELECT count(*) FROM folders WHERE parent_id = $1) +
+		(SELECT count(*) FROM files WHERE folder_id = $1)
+	`
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, id).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// IsDescendant reports whether folder id is
+// ancestorID or one of its subfolders.
+func (fr *folderRepository) IsDescendant(ctx context.Context, id uint64, ancestorID uint64) (bool, error) {
+	var isDescendant bool
+
+	stmt := `
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id FROM folders WHERE id = $1
+		UNION
+		SELECT f.id, f.parent_id FROM folders f
+		JOIN ancestors a ON f.id = a.parent_id
+	)
+	SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+	`
+
+	err := fr.db.GetConn().QueryRow(ctx, stmt, id, ancestorID).Scan(&isDescendant)
+	if err != nil {
+		return false, err
+	}
+
+	return isDescendant, nil
+}
@@ -0,0 +1,157 @@
+package folder
+
+import (
+	"context"
+	"encryption/user"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrFolderNotEmpty = errors.New("Folder is not empty. Move or delete its contents first, including the files in the trash.")
+
+type FolderRepository interface {
+	Create(ctx context.Context, folder Folder) (uint64, error)
+	Get(ctx context.Context, id uint64) (Folder, error)
+	List(ctx context.Context, userID uint64, parentID uint64) ([]Folder, error)
+	Update(ctx context.Context, folder Folder) error
+	Delete(ctx context.Context, id uint64) error
+	CountContents(ctx context.Context, id uint64) (uint64, error)
+	IsDescendant(ctx context.Context, id uint64, ancestorID uint64) (bool, error)
+}
+
+type UserService interface {
+	GetUserByUsername(context.Context, string) (*user.User, error)
+}
+
+type folderService struct {
+	folderRepository FolderRepository
+	userService      UserService
+}
+
+func NewFolderService(
+	fr FolderRepository,
+	us UserService,
+) *folderService {
+	return &folderService{
+		folderRepository: fr,
+		userService:      us,
+	}
+}
+
+// getOwnedFolder returns a folder owned by userID.
+func (fs *folderService) getOwnedFolder(ctx context.Context, userID uint64, id uint64) (Folder, error) {
+	folder, err := fs.folderRepository.Get(ctx, id)
+	if err != nil && err != pgx.ErrNoRows {
+		return Folder{}, err
+	}
+	if err == pgx.ErrNoRows {
+		return Folder{}, errors.New("Requested folder not found")
+	}
+
+	if folder.UserID != userID {
+		return Folder{}, errors.New("You do not have access to this resource data")
+	}
+
+	return folder, nil
+}
+
+func (fs *folderService) createFolder(ctx context.Context, request CreateFolderRequest) (*Folder, error) {
+	if request.ParentID != 0 {
+		_, err := fs.getOwnedFolder(ctx, request.UserID, request.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	folder := Folder{
+		UserID:   request.UserID,
+		ParentID: request.ParentID,
+		Name:     request.Name,
+	}
+
+	id, err := fs.folderRepository.Create(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err = fs.folderRepository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// listFolders lists the subfolders of request.ParentID
+// owned by the target user.
+func (fs *folderService) listFolders(ctx context.Context, request ListFoldersRequest) ([]Folder, error) {
+	targetUser, err := fs.userService.GetUserByUsername(ctx, request.TargetUsername)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := fs.folderRepository.List(ctx, targetUser.ID, request.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]Folder{}, folders...), nil
+}
+
+// updateFolder renames a folder and/or moves it to another
+// parent. A folder can not be moved into its own subtree.
+func (fs *folderService) updateFolder(ctx context.Context, request UpdateFolderRequest) (*Folder, error) {
+	folder, err := fs.getOwnedFolder(ctx, request.UserID, request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Name != nil {
+		folder.Name = *request.Name
+	}
+
+	if request.ParentID != nil && *request.ParentID != 0 {
+		_, err := fs.getOwnedFolder(ctx, request.UserID, *request.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		isDescendant, err := fs.folderRepository.IsDescendant(ctx, *request.ParentID, folder.ID)
+		if err != nil {
+			return nil, err
+		}
+		if isDescendant {
+			return nil, errors.New("Request invalid. A folder can not be moved into itself.")
+		}
+	}
+
+	if request.ParentID != nil {
+		folder.ParentID = *request.ParentID
+	}
+
+	err = fs.folderRepository.Update(ctx, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// deleteFolder deletes an empty folder.
+func (fs *folderService) deleteFolder(ctx context.Context, userID uint64, id uint64) error {
+	_, err := fs.getOwnedFolder(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := fs.folderRepository.CountContents(ctx, id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrFolderNotEmpty
+	}
+
+	return fs.folderRepository.Delete(ctx, id)
+}
@@ -33,6 +33,14 @@ func (m *MockGuardRepo) StoreKey(ctx context.Context, table string, key Key) (Ke
 	return Key{}, errors.New("invalid mode")
 }
 
+func (m *MockGuardRepo) DeleteKey(ctx context.Context, table string, id uint64) error {
+	return nil
+}
+
+func (m *MockGuardRepo) ListKeys(ctx context.Context, table string) ([]KeyInfo, error) {
+	return nil, nil
+}
+
 func BenchmarkAESText(b *testing.B) {
 	guardRepo := MockGuardRepo{GuardMode: 1}
 	guard := NewGuard(1, []byte("12345678912345678912345678900000"), &guardRepo)
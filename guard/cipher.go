@@ -23,6 +23,8 @@ import (
 type Repository interface {
 	GetKey(ctx context.Context, table string, id uint64) (Key, error)
 	StoreKey(ctx context.Context, table string, key Key) (Key, error)
+	DeleteKey(ctx context.Context, table string, id uint64) error
+	ListKeys(ctx context.Context, table string) ([]KeyInfo, error)
 }
 
 // Guard is a cipher tool to encrypt, decrypt, and store keys
@@ -49,12 +51,12 @@ func NewGuard(mode int, metadataKey []byte, repository Repository) *Guard {
 // Get gets the plain key
 func (g *Guard) GetKey(ctx context.Context, table string, metadata []byte) (Key, error) {
 	var err error
-	keyRef, err := g.Decrypt(g.MetadataKey, metadata)
+	id, err := g.KeyID(metadata)
 	if err != nil {
 		return Key{}, err
 	}
 
-	key, err := g.repository.GetKey(ctx, table, binary.BigEndian.Uint64(keyRef))
+	key, err := g.repository.GetKey(ctx, table, id)
 	if err != nil {
 		return Key{}, err
 	}
@@ -62,6 +64,30 @@ func (g *Guard) GetKey(ctx context.Context, table string, metadata []byte) (Key,
 	return key, nil
 }
 
+// KeyID returns the id of the key referenced by metadata.
+func (g *Guard) KeyID(metadata []byte) (uint64, error) {
+	keyRef, err := g.Decrypt(g.MetadataKey, metadata)
+	if err != nil {
+		return 0, err
+	}
+	if len(keyRef) != 8 {
+		return 0, errors.New("invalid key metadata")
+	}
+
+	return binary.BigEndian.Uint64(keyRef), nil
+}
+
+// ListKeys lists the keys stored in table.
+func (g *Guard) ListKeys(ctx context.Context, table string) ([]KeyInfo, error) {
+	return g.repository.ListKeys(ctx, table)
+}
+
+// DeleteKeyID deletes a key by its id, for keys
+// that are no longer referenced by any metadata.
+func (g *Guard) DeleteKeyID(ctx context.Context, table string, id uint64) error {
+	return g.repository.DeleteKey(ctx, table, id)
+}
+
 // StoreKey returns key metadata
 func (g *Guard) StoreKey(ctx context.Context, table string, key Key) ([]byte, error) {
 	key, err := g.repository.StoreKey(ctx, table, key)
@@ -77,6 +103,16 @@ func (g *Guard) StoreKey(ctx context.Context, table string, key Key) ([]byte, er
 	return metadata, nil
 }
 
+// DeleteKey deletes the key referenced by metadata.
+func (g *Guard) DeleteKey(ctx context.Context, table string, metadata []byte) error {
+	id, err := g.KeyID(metadata)
+	if err != nil {
+		return err
+	}
+
+	return g.repository.DeleteKey(ctx, table, id)
+}
+
 // GenerateMetadata generates a encrypted reference of the key.
 func (g *Guard) GenerateMetadata(key Key) ([]byte, error) {
 	keyRef := make([]byte, 8)
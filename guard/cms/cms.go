@@ -0,0 +1,679 @@
+// Package cms builds and parses CMS SignedData (RFC 5652) signed
+// with RSA PKCS#1 v1.5 over SHA-256 digests.
+package cms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+)
+
+var (
+	OIDData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	OIDSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	OIDAttributeContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDAttributeMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	OIDAttributeSigningTime          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	OIDAttributeCounterSignature     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	OIDAttributeSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	OIDAttributeTimeStampToken       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	sha256AlgorithmID      = pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	rsaEncryptionAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+)
+
+var (
+	ErrNotSignedData      = errors.New("cms: content is not signed data")
+	ErrNoSigners          = errors.New("cms: signed data has no signer")
+	ErrSignerNotFound     = errors.New("cms: signer certificate not found")
+	ErrUnsupportedAlgo    = errors.New("cms: unsupported digest or signature algorithm")
+	ErrDigestMismatch     = errors.New("cms: message digest does not match the content")
+	ErrMissingAttribute   = errors.New("cms: missing signed attribute")
+	ErrContentTypeInvalid = errors.New("cms: content type attribute does not match the content")
+	ErrCounterSignature   = errors.New("cms: countersignature holds a content type attribute")
+)
+
+// SignedData is a parsed or to be built CMS SignedData.
+type SignedData struct {
+	ContentType asn1.ObjectIdentifier
+
+	// Content is the encapsulated content, nil
+	// when the signature is detached.
+	Content []byte
+
+	Certificates []*x509.Certificate
+	Signers      []SignerInfo
+}
+
+// SignerInfo is the signature of a single signer.
+type SignerInfo struct {
+	Certificate *x509.Certificate
+
+	// SignedAttributes is the DER encoded SET OF
+	// attributes covered by the signature.
+	SignedAttributes []byte
+	Signature        []byte
+
+	// UnsignedAttributes are attached after signing,
+	// e.g. a timestamp token over the signature.
+	UnsignedAttributes []Attribute
+}
+
+// Attribute is a single valued attribute, Value is DER encoded.
+type Attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value []byte
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// SignedAttributes returns the DER encoded attributes signed for
+// content of contentType with the digest, binding the signature to
+// cert. The signing time is left out when zero, as PAdES requires.
+func SignedAttributes(contentType asn1.ObjectIdentifier, digest []byte, cert *x509.Certificate, signingTime time.Time) ([]byte, error) {
+	value, err := asn1.Marshal(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return signedAttributes([]Attribute{{Type: OIDAttributeContentType, Value: value}}, digest, cert, signingTime)
+}
+
+func signedAttributes(attrs []Attribute, digest []byte, cert *x509.Certificate, signingTime time.Time) ([]byte, error) {
+	value, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, Attribute{Type: OIDAttributeMessageDigest, Value: value})
+
+	certHash := sha256.Sum256(cert.Raw)
+	value, err = asn1.Marshal(signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}})
+	if err != nil {
+		return nil, err
+	}
+	attrs = append(attrs, Attribute{Type: OIDAttributeSigningCertificateV2, Value: value})
+
+	if !signingTime.IsZero() {
+		value, err = asn1.MarshalWithParams(signingTime.UTC(), "utc")
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, Attribute{Type: OIDAttributeSigningTime, Value: value})
+	}
+
+	set, err := marshalAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapSet(set)
+}
+
+// Sign signs the DER encoded signed attributes with key.
+func Sign(key crypto.Signer, signedAttributes []byte) ([]byte, error) {
+	digest := sha256.Sum256(signedAttributes)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// SignDetached returns a detached SignedData of content signed by key
+// with the first certificate of chain.
+func SignDetached(content []byte, key crypto.Signer, chain []*x509.Certificate, signingTime time.Time) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, ErrSignerNotFound
+	}
+
+	digest := sha256.Sum256(content)
+
+	attrs, err := SignedAttributes(OIDData, digest[:], chain[0], signingTime)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := Sign(key, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := SignedData{
+		ContentType:  OIDData,
+		Certificates: chain,
+		Signers: []SignerInfo{{
+			Certificate:      chain[0],
+			SignedAttributes: attrs,
+			Signature:        signature,
+		}},
+	}
+
+	return sd.Marshal()
+}
+
+// Marshal encodes the signed data as a DER ContentInfo.
+func (sd *SignedData) Marshal() ([]byte, error) {
+	if len(sd.Signers) == 0 {
+		return nil, ErrNoSigners
+	}
+
+	version := 1
+	if !sd.ContentType.Equal(OIDData) {
+		version = 3
+	}
+
+	res := signedData{
+		Version:          version,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256AlgorithmID},
+		EncapContentInfo: encapContentInfo{
+			ContentType: sd.ContentType,
+			Content:     sd.Content,
+		},
+	}
+
+	if len(sd.Certificates) > 0 {
+		var certs []byte
+		for _, cert := range sd.Certificates {
+			certs = append(certs, cert.Raw...)
+		}
+
+		res.Certificates = asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      certs,
+		}
+	}
+
+	for _, signer := range sd.Signers {
+		info, err := signer.marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		res.SignerInfos = append(res.SignerInfos, info)
+	}
+
+	content, err := asn1.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: OIDSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      content,
+		},
+	})
+}
+
+// CounterSign returns the countersignature by key with cert of the
+// signature value of s (RFC 5652, section 11.4). It covers the content
+// through the signature of s, its signed attributes hold no content type.
+func (s SignerInfo) CounterSign(key crypto.Signer, cert *x509.Certificate, signingTime time.Time) (SignerInfo, error) {
+	digest := sha256.Sum256(s.Signature)
+
+	attrs, err := signedAttributes(nil, digest[:], cert, signingTime)
+	if err != nil {
+		return SignerInfo{}, err
+	}
+
+	signature, err := Sign(key, attrs)
+	if err != nil {
+		return SignerInfo{}, err
+	}
+
+	return SignerInfo{
+		Certificate:      cert,
+		SignedAttributes: attrs,
+		Signature:        signature,
+	}, nil
+}
+
+// SetCounterSignature attaches counter to the unsigned attributes of s,
+// replacing its countersignature if it has one.
+func (s *SignerInfo) SetCounterSignature(counter SignerInfo) error {
+	info, err := counter.marshal()
+	if err != nil {
+		return err
+	}
+
+	value, err := asn1.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	attrs := make([]Attribute, 0, len(s.UnsignedAttributes)+1)
+	for _, attr := range s.UnsignedAttributes {
+		if !attr.Type.Equal(OIDAttributeCounterSignature) {
+			attrs = append(attrs, attr)
+		}
+	}
+	s.UnsignedAttributes = append(attrs, Attribute{Type: OIDAttributeCounterSignature, Value: value})
+
+	return nil
+}
+
+// CounterSignature returns the countersignature of s, its certificate
+// is looked up in certs. False is returned when s has none.
+func (s SignerInfo) CounterSignature(certs []*x509.Certificate) (SignerInfo, bool, error) {
+	value, ok := s.UnsignedAttribute(OIDAttributeCounterSignature)
+	if !ok {
+		return SignerInfo{}, false, nil
+	}
+
+	var info signerInfo
+	_, err := asn1.Unmarshal(value, &info)
+	if err != nil {
+		return SignerInfo{}, false, err
+	}
+
+	counter, err := parseSignerInfo(info, certs)
+	if err != nil {
+		return SignerInfo{}, false, err
+	}
+
+	return counter, true, nil
+}
+
+// VerifyCounterSignature checks that counter signed the signature value of s.
+func (s SignerInfo) VerifyCounterSignature(counter SignerInfo) error {
+	if counter.Certificate == nil {
+		return ErrSignerNotFound
+	}
+
+	if len(counter.SignedAttributes) == 0 {
+		return ErrMissingAttribute
+	}
+
+	if _, ok := counter.Attribute(OIDAttributeContentType); ok {
+		return ErrCounterSignature
+	}
+
+	messageDigest, err := counter.MessageDigest()
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(s.Signature)
+	if !bytes.Equal(messageDigest, digest[:]) {
+		return ErrDigestMismatch
+	}
+
+	return counter.Certificate.CheckSignature(x509.SHA256WithRSA, counter.SignedAttributes, counter.Signature)
+}
+
+func (s SignerInfo) marshal() (signerInfo, error) {
+	if s.Certificate == nil {
+		return signerInfo{}, ErrSignerNotFound
+	}
+
+	var signed asn1.RawValue
+	_, err := asn1.Unmarshal(s.SignedAttributes, &signed)
+	if err != nil {
+		return signerInfo{}, err
+	}
+
+	info := signerInfo{
+		Version: 1,
+		SID: issuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: s.Certificate.RawIssuer},
+			SerialNumber: s.Certificate.SerialNumber,
+		},
+		DigestAlgorithm: sha256AlgorithmID,
+		SignedAttrs: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      signed.Bytes,
+		},
+		SignatureAlgorithm: rsaEncryptionAlgorithm,
+		Signature:          s.Signature,
+	}
+
+	if len(s.UnsignedAttributes) > 0 {
+		unsigned, err := marshalAttributes(s.UnsignedAttributes)
+		if err != nil {
+			return signerInfo{}, err
+		}
+
+		info.UnsignedAttrs = asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1,
+			IsCompound: true,
+			Bytes:      unsigned,
+		}
+	}
+
+	return info, nil
+}
+
+// Parse parses a DER ContentInfo holding a SignedData.
+func Parse(der []byte) (*SignedData, error) {
+	var info contentInfo
+	_, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.ContentType.Equal(OIDSignedData) {
+		return nil, ErrNotSignedData
+	}
+
+	var sd signedData
+	_, err = asn1.Unmarshal(info.Content.Bytes, &sd)
+	if err != nil {
+		return nil, err
+	}
+
+	res := SignedData{
+		ContentType: sd.EncapContentInfo.ContentType,
+		Content:     sd.EncapContentInfo.Content,
+	}
+
+	if len(sd.Certificates.Bytes) > 0 {
+		res.Certificates, err = x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, info := range sd.SignerInfos {
+		signer, err := parseSignerInfo(info, res.Certificates)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Signers = append(res.Signers, signer)
+	}
+
+	if len(res.Signers) == 0 {
+		return nil, ErrNoSigners
+	}
+
+	return &res, nil
+}
+
+func parseSignerInfo(info signerInfo, certs []*x509.Certificate) (SignerInfo, error) {
+	var err error
+
+	signer := SignerInfo{
+		Certificate: findCertificate(certs, info.SID),
+		Signature:   info.Signature,
+	}
+
+	if len(info.SignedAttrs.Bytes) > 0 {
+		signer.SignedAttributes, err = wrapSet(info.SignedAttrs.Bytes)
+		if err != nil {
+			return SignerInfo{}, err
+		}
+	}
+
+	if len(info.UnsignedAttrs.Bytes) > 0 {
+		signer.UnsignedAttributes, err = parseAttributes(info.UnsignedAttrs.Bytes)
+		if err != nil {
+			return SignerInfo{}, err
+		}
+	}
+
+	if !info.DigestAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!(info.SignatureAlgorithm.Algorithm.Equal(oidRSAEncryption) || info.SignatureAlgorithm.Algorithm.Equal(oidSHA256WithRSA)) {
+		return SignerInfo{}, ErrUnsupportedAlgo
+	}
+
+	return signer, nil
+}
+
+// Verify checks the signature of every signer over content, the
+// encapsulated content is used when content is nil.
+func (sd *SignedData) Verify(content []byte) error {
+	if content == nil {
+		content = sd.Content
+	}
+
+	digest := sha256.Sum256(content)
+
+	for _, signer := range sd.Signers {
+		err := signer.verify(sd.ContentType, digest[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s SignerInfo) verify(contentType asn1.ObjectIdentifier, digest []byte) error {
+	if s.Certificate == nil {
+		return ErrSignerNotFound
+	}
+
+	if len(s.SignedAttributes) == 0 {
+		return ErrMissingAttribute
+	}
+
+	value, ok := s.Attribute(OIDAttributeContentType)
+	if !ok {
+		return ErrMissingAttribute
+	}
+
+	var signedType asn1.ObjectIdentifier
+	_, err := asn1.Unmarshal(value, &signedType)
+	if err != nil {
+		return err
+	}
+
+	if !signedType.Equal(contentType) {
+		return ErrContentTypeInvalid
+	}
+
+	messageDigest, err := s.MessageDigest()
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(messageDigest, digest) {
+		return ErrDigestMismatch
+	}
+
+	return s.Certificate.CheckSignature(x509.SHA256WithRSA, s.SignedAttributes, s.Signature)
+}
+
+// Attribute returns the value of the signed attribute of type oid.
+func (s SignerInfo) Attribute(oid asn1.ObjectIdentifier) ([]byte, bool) {
+	if len(s.SignedAttributes) == 0 {
+		return nil, false
+	}
+
+	var set asn1.RawValue
+	_, err := asn1.Unmarshal(s.SignedAttributes, &set)
+	if err != nil {
+		return nil, false
+	}
+
+	attrs, err := parseAttributes(set.Bytes)
+	if err != nil {
+		return nil, false
+	}
+
+	return findAttribute(attrs, oid)
+}
+
+// UnsignedAttribute returns the value of the unsigned attribute of type oid.
+func (s SignerInfo) UnsignedAttribute(oid asn1.ObjectIdentifier) ([]byte, bool) {
+	return findAttribute(s.UnsignedAttributes, oid)
+}
+
+// MessageDigest returns the digest of the content the signer signed.
+func (s SignerInfo) MessageDigest() ([]byte, error) {
+	value, ok := s.Attribute(OIDAttributeMessageDigest)
+	if !ok {
+		return nil, ErrMissingAttribute
+	}
+
+	var digest []byte
+	_, err := asn1.Unmarshal(value, &digest)
+	if err != nil {
+		return nil, err
+	}
+
+	return digest, nil
+}
+
+// SigningTime returns the signing time claimed by the signer,
+// false when the signed attributes do not hold one.
+func (s SignerInfo) SigningTime() (time.Time, bool) {
+	value, ok := s.Attribute(OIDAttributeSigningTime)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	var signingTime time.Time
+	_, err := asn1.Unmarshal(value, &signingTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return signingTime, true
+}
+
+func findCertificate(certs []*x509.Certificate, sid issuerAndSerial) *x509.Certificate {
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(sid.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, sid.Issuer.FullBytes) {
+			return cert
+		}
+	}
+
+	return nil
+}
+
+func findAttribute(attrs []Attribute, oid asn1.ObjectIdentifier) ([]byte, bool) {
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) {
+			return attr.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// marshalAttributes returns the content of the SET OF attrs,
+// sorted by their encoding as DER requires.
+func marshalAttributes(attrs []Attribute) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attrs))
+
+	for _, attr := range attrs {
+		values, err := wrapSet(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := asn1.Marshal(attribute{
+			Type:   attr.Type,
+			Values: asn1.RawValue{FullBytes: values},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded = append(encoded, value)
+	}
+
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	return bytes.Join(encoded, nil), nil
+}
+
+// parseAttributes parses the content of a SET OF attributes,
+// keeping the first value of each.
+func parseAttributes(content []byte) ([]Attribute, error) {
+	var attrs []Attribute
+
+	for len(content) > 0 {
+		var attr attribute
+
+		rest, err := asn1.Unmarshal(content, &attr)
+		if err != nil {
+			return nil, err
+		}
+		content = rest
+
+		var value asn1.RawValue
+		_, err = asn1.Unmarshal(attr.Values.Bytes, &value)
+		if err != nil {
+			return nil, err
+		}
+
+		attrs = append(attrs, Attribute{Type: attr.Type, Value: value.FullBytes})
+	}
+
+	return attrs, nil
+}
+
+// wrapSet encodes content as a universal SET.
+func wrapSet(content []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassUniversal,
+		Tag:        asn1.TagSet,
+		IsCompound: true,
+		Bytes:      content,
+	})
+}
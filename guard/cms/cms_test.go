@@ -0,0 +1,163 @@
+package cms
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newCertificate(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, cert
+}
+
+func TestSignDetached(t *testing.T) {
+	key, cert := newCertificate(t, "alice")
+	content := []byte("quarterly report")
+	signingTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	der, err := SignDetached(content, key, []*x509.Certificate{cert}, signingTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sd.Content != nil {
+		t.Fatal("detached signature holds the content")
+	}
+
+	if len(sd.Signers) != 1 || sd.Signers[0].Certificate == nil || !sd.Signers[0].Certificate.Equal(cert) {
+		t.Fatal("signer certificate not resolved")
+	}
+
+	got, ok := sd.Signers[0].SigningTime()
+	if !ok || !got.Equal(signingTime) {
+		t.Fatalf("signing time = %v, want %v", got, signingTime)
+	}
+
+	if err := sd.Verify(content); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sd.Verify([]byte("quarterly rep0rt")); err != ErrDigestMismatch {
+		t.Fatalf("tampered content: err = %v, want %v", err, ErrDigestMismatch)
+	}
+
+	// a parsed signed data encodes back to the same bytes
+	again, err := sd.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(again) != string(der) {
+		t.Fatal("signed data does not round trip")
+	}
+
+	sd.Signers[0].Signature[0] ^= 0xff
+	if err := sd.Verify(content); err == nil {
+		t.Fatal("tampered signature verified")
+	}
+}
+
+func TestCounterSign(t *testing.T) {
+	key, cert := newCertificate(t, "alice")
+	counterKey, counterCert := newCertificate(t, "bob")
+	content := []byte("contract")
+
+	der, err := SignDetached(content, key, []*x509.Certificate{cert}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := sd.Signers[0].CounterSign(counterKey, counterCert, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sd.Signers[0].SetCounterSignature(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.Certificates = append(sd.Certificates, counterCert)
+
+	der, err = sd.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err = Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the countersignature leaves the signature over the content intact
+	if err := sd.Verify(content); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := sd.Signers[0].CounterSignature(sd.Certificates)
+	if err != nil || !ok {
+		t.Fatalf("CounterSignature() = %v, %v", ok, err)
+	}
+
+	if got.Certificate == nil || got.Certificate.Subject.CommonName != "bob" {
+		t.Fatal("countersigner certificate not resolved")
+	}
+
+	if err := sd.Signers[0].VerifyCounterSignature(got); err != nil {
+		t.Fatal(err)
+	}
+
+	// a countersignature only holds for the signature it was made over
+	other, err := SignDetached(content, key, []*x509.Certificate{cert}, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherSD, err := Parse(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := otherSD.Signers[0].VerifyCounterSignature(got); err != ErrDigestMismatch {
+		t.Fatalf("moved countersignature: err = %v, want %v", err, ErrDigestMismatch)
+	}
+
+	if _, ok, _ := otherSD.Signers[0].CounterSignature(otherSD.Certificates); ok {
+		t.Fatal("signer without countersignature returned one")
+	}
+}
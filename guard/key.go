@@ -1,6 +1,14 @@
 package guard
 
+import "time"
+
 type Key struct {
 	id       uint64
 	PlainKey []byte
 }
+
+// KeyInfo describes a stored key without its value.
+type KeyInfo struct {
+	ID        uint64
+	CreatedAt time.Time
+}
@@ -68,3 +68,46 @@ func (r *guardRepository) StoreKey(ctx context.Context, table string, key Key) (
 
 	return key, nil
 }
+
+// DeleteKey deletes a key from table in the key database
+func (r *guardRepository) DeleteKey(ctx context.Context, table string, id uint64) error {
+	stmt := fmt.Sprintf(`DELETE FROM %v WHERE id = $1`, table)
+
+	_, err := r.db.GetConn().Exec(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListKeys lists the ids and creation times of the keys in table
+func (r *guardRepository) ListKeys(ctx context.Context, table string) ([]KeyInfo, error) {
+	var keys []KeyInfo
+
+	stmt := fmt.Sprintf(`SELECT id, created_at FROM %v ORDER BY id`, table)
+
+	rows, err := r.db.GetConn().Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key KeyInfo
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,96 @@
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// maxResponseSize bounds the size of the timestamp responses read.
+const maxResponseSize = 1 << 20
+
+// Client requests timestamp tokens from a remote TSA
+// over the RFC 3161 HTTP protocol.
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewClient(url string) *Client {
+	return &Client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Timestamp requests a token over digest, a SHA-256 digest.
+func (c *Client) Timestamp(ctx context.Context, digest []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/timestamp-query")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp: authority responded %v", res.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp timeStampResp
+	_, err = asn1.Unmarshal(body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Status.Status != statusGranted && resp.Status.Status != statusGrantedWithMods {
+		return nil, ErrRejected
+	}
+
+	token := resp.TimeStampToken.FullBytes
+
+	t, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Nonce == nil || t.Nonce.Cmp(nonce) != 0 || !bytes.Equal(t.digest, digest) {
+		return nil, ErrNonceMismatch
+	}
+
+	return token, nil
+}
@@ -0,0 +1,173 @@
+package timestamp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encryption/guard/cms"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// maxRequestSize bounds the size of the timestamp requests served.
+const maxRequestSize = 64 << 10
+
+// CertificateIssuer certifies the key of a local TSA, the
+// returned chain starts with the TSA certificate.
+type CertificateIssuer interface {
+	IssueTimestampCertificate(ctx context.Context, publicKey *rsa.PublicKey) ([]*x509.Certificate, error)
+}
+
+// LocalAuthority is an in-process TSA for deployments without
+// access to a remote one. Its key lives in memory and is certified
+// again on each start, tokens stay verifiable through its issuer.
+type LocalAuthority struct {
+	key    *rsa.PrivateKey
+	chain  []*x509.Certificate
+	policy asn1.ObjectIdentifier
+	now    func() time.Time
+}
+
+func NewLocalAuthority(ctx context.Context, issuer CertificateIssuer, policy asn1.ObjectIdentifier) (*LocalAuthority, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := issuer.IssueTimestampCertificate(ctx, &key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalAuthority{
+		key:    key,
+		chain:  chain,
+		policy: policy,
+		now:    time.Now,
+	}, nil
+}
+
+// Timestamp returns a token over digest, a SHA-256 digest.
+func (la *LocalAuthority) Timestamp(ctx context.Context, digest []byte) ([]byte, error) {
+	return la.issue(digest, nil)
+}
+
+// issue signs a TSTInfo over digest echoing the nonce of the request.
+func (la *LocalAuthority) issue(digest []byte, nonce *big.Int) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, ErrMalformedRequest
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := asn1.Marshal(tstInfo{
+		Version: 1,
+		Policy:  la.policy,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		SerialNumber: serial,
+		GenTime:      la.now().UTC().Truncate(time.Second),
+		Accuracy:     accuracy{Seconds: 1},
+		Nonce:        nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	infoDigest := sha256.Sum256(info)
+
+	attrs, err := cms.SignedAttributes(OIDTSTInfo, infoDigest[:], la.chain[0], time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := cms.Sign(la.key, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := cms.SignedData{
+		ContentType:  OIDTSTInfo,
+		Content:      info,
+		Certificates: la.chain,
+		Signers: []cms.SignerInfo{{
+			Certificate:      la.chain[0],
+			SignedAttributes: attrs,
+			Signature:        signature,
+		}},
+	}
+
+	return sd.Marshal()
+}
+
+// Respond answers a DER timestamp request.
+func (la *LocalAuthority) Respond(request []byte) ([]byte, error) {
+	var req timeStampReq
+
+	rest, err := asn1.Unmarshal(request, &req)
+	if err != nil || len(rest) > 0 || req.Version != 1 {
+		return rejection()
+	}
+
+	if !req.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return rejection()
+	}
+
+	if req.ReqPolicy != nil && !req.ReqPolicy.Equal(la.policy) {
+		return rejection()
+	}
+
+	token, err := la.issue(req.MessageImprint.HashedMessage, req.Nonce)
+	if err == ErrMalformedRequest {
+		return rejection()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+func rejection() ([]byte, error) {
+	return asn1.Marshal(timeStampResp{
+		Status: pkiStatusInfo{Status: statusRejection},
+	})
+}
+
+// ServeHTTP serves the local TSA over the RFC 3161 HTTP protocol.
+func (la *LocalAuthority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := la.Respond(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/timestamp-reply")
+	w.WriteHeader(http.StatusOK)
+	w.Write(res)
+}
@@ -0,0 +1,328 @@
+// Package timestamp requests, issues and verifies RFC 3161 timestamp
+// tokens over SHA-256 digests, proving that data existed at a time
+// attested by a timestamp authority (TSA).
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"encryption/guard/cms"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	OIDTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+	// OIDAnyPolicy is the default policy of the local TSA.
+	OIDAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+var (
+	ErrNotTimestamp     = errors.New("timestamp: token does not hold a timestamp")
+	ErrImprintMismatch  = errors.New("timestamp: token was not issued for the data")
+	ErrUnsupportedAlgo  = errors.New("timestamp: unsupported message imprint algorithm")
+	ErrNotTimestamping  = errors.New("timestamp: token signer is not a timestamp authority")
+	ErrUntrustedTSA     = errors.New("timestamp: token signed by an untrusted timestamp authority")
+	ErrRejected         = errors.New("timestamp: request rejected by the timestamp authority")
+	ErrNonceMismatch    = errors.New("timestamp: response does not answer the request")
+	ErrMalformedRequest = errors.New("timestamp: malformed request")
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"optional,tag:0"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// Statuses of a timestamp response.
+const (
+	statusGranted         = 0
+	statusGrantedWithMods = 1
+	statusRejection       = 2
+)
+
+// Token is a parsed timestamp token whose CMS signature was checked.
+type Token struct {
+	GenTime      time.Time
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	Nonce        *big.Int
+
+	// Certificate is the one of the TSA that signed
+	// the token, Certificates the ones it embeds.
+	Certificate  *x509.Certificate
+	Certificates []*x509.Certificate
+
+	digest []byte
+}
+
+// ParseToken parses a DER timestamp token and checks its signature.
+func ParseToken(der []byte) (*Token, error) {
+	sd, err := cms.Parse(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sd.ContentType.Equal(OIDTSTInfo) || sd.Content == nil {
+		return nil, ErrNotTimestamp
+	}
+
+	err = sd.Verify(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var info tstInfo
+	_, err = asn1.Unmarshal(sd.Content, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, ErrUnsupportedAlgo
+	}
+
+	return &Token{
+		GenTime:      info.GenTime,
+		SerialNumber: info.SerialNumber,
+		Policy:       info.Policy,
+		Nonce:        info.Nonce,
+		Certificate:  sd.Signers[0].Certificate,
+		Certificates: sd.Certificates,
+		digest:       info.MessageImprint.HashedMessage,
+	}, nil
+}
+
+// Verify checks that the token was issued over data by
+// a TSA chaining up to roots, as it was at GenTime.
+func (t *Token) Verify(data []byte, roots *x509.CertPool) error {
+	digest := sha256.Sum256(data)
+	if !bytes.Equal(t.digest, digest[:]) {
+		return ErrImprintMismatch
+	}
+
+	return t.verifySigner(roots)
+}
+
+func (t *Token) verifySigner(roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range t.Certificates {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := t.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		var unknownAuthority x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthority) {
+			return ErrUntrustedTSA
+		}
+
+		var invalid x509.CertificateInvalidError
+		if errors.As(err, &invalid) && invalid.Reason == x509.IncompatibleUsage {
+			return ErrNotTimestamping
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// TSA issues timestamp tokens over SHA-256 digests.
+type TSA interface {
+	Timestamp(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// Authority timestamps data with a TSA and verifies the
+// tokens of the timestamp authorities it trusts.
+type Authority struct {
+	tsa   TSA
+	roots *x509.CertPool
+}
+
+func NewAuthority(tsa TSA, roots []*x509.Certificate) *Authority {
+	pool := x509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root)
+	}
+
+	return &Authority{
+		tsa:   tsa,
+		roots: pool,
+	}
+}
+
+// Timestamp returns a verified timestamp token over data.
+func (a *Authority) Timestamp(ctx context.Context, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+
+	token, err := a.tsa.Timestamp(ctx, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// a token that can not be verified later is useless
+	_, err = a.Verify(token, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Verify parses token and checks that a trusted TSA issued it over data.
+func (a *Authority) Verify(token []byte, data []byte) (*Token, error) {
+	t, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Verify(data, a.roots)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Config selects the TSA signatures are timestamped by.
+type Config struct {
+	// URL of a remote TSA, the local TSA is used when empty.
+	URL string
+
+	// Roots are the trusted roots of remote TSAs.
+	Roots []*x509.Certificate
+
+	// Policy is the policy of the tokens issued by the local TSA.
+	Policy asn1.ObjectIdentifier
+}
+
+// ConfigFromEnv returns the TSA set by TSA_URL, the roots of the PEM
+// file at TSA_ROOTS and the local TSA policy TSA_POLICY, a dotted OID.
+func ConfigFromEnv() Config {
+	config := Config{
+		URL:    os.Getenv("TSA_URL"),
+		Policy: OIDAnyPolicy,
+	}
+
+	if path := os.Getenv("TSA_ROOTS"); path != "" {
+		roots, err := readCertificates(path)
+		if err != nil {
+			fmt.Println("read TSA_ROOTS", err)
+		}
+		config.Roots = roots
+	}
+
+	if value := os.Getenv("TSA_POLICY"); value != "" {
+		policy, err := parseOID(value)
+		if err != nil {
+			fmt.Printf("invalid timestamp policy TSA_POLICY: %v\n", value)
+		} else {
+			config.Policy = policy
+		}
+	}
+
+	return config
+}
+
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+func parseOID(value string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+
+	for _, arc := range strings.Split(value, ".") {
+		n, err := strconv.Atoi(arc)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid object identifier")
+		}
+		oid = append(oid, n)
+	}
+
+	if len(oid) < 2 {
+		return nil, errors.New("invalid object identifier")
+	}
+
+	return oid, nil
+}
@@ -0,0 +1,131 @@
+package timestamp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testIssuer certifies TSA keys with a throwaway root.
+type testIssuer struct {
+	root     *x509.Certificate
+	rootKey  *rsa.PrivateKey
+	keyUsage []x509.ExtKeyUsage
+}
+
+func newTestIssuer(t *testing.T, keyUsage ...x509.ExtKeyUsage) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testIssuer{root: root, rootKey: key, keyUsage: keyUsage}
+}
+
+func (ti *testIssuer) IssueTimestampCertificate(ctx context.Context, publicKey *rsa.PublicKey) ([]*x509.Certificate, error) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  ti.keyUsage,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ti.root, publicKey, ti.rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*x509.Certificate{cert, ti.root}, nil
+}
+
+func TestLocalAuthority(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t, x509.ExtKeyUsageTimeStamping)
+
+	local, err := NewLocalAuthority(ctx, issuer, OIDAnyPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(local)
+	defer server.Close()
+
+	data := []byte("signature value")
+
+	for name, tsa := range map[string]TSA{"local": local, "client": NewClient(server.URL)} {
+		authority := NewAuthority(tsa, []*x509.Certificate{issuer.root})
+
+		token, err := authority.Timestamp(ctx, data)
+		if err != nil {
+			t.Fatalf("%v: Timestamp() error = %v", name, err)
+		}
+
+		res, err := authority.Verify(token, data)
+		if err != nil {
+			t.Fatalf("%v: Verify() error = %v", name, err)
+		}
+		if time.Since(res.GenTime) > time.Minute || !res.Policy.Equal(OIDAnyPolicy) {
+			t.Errorf("%v: unexpected token %+v", name, res)
+		}
+
+		_, err = authority.Verify(token, []byte("other data"))
+		if !errors.Is(err, ErrImprintMismatch) {
+			t.Errorf("%v: other data error = %v, want %v", name, err, ErrImprintMismatch)
+		}
+
+		other := NewAuthority(tsa, []*x509.Certificate{newTestIssuer(t).root})
+		_, err = other.Verify(token, data)
+		if !errors.Is(err, ErrUntrustedTSA) {
+			t.Errorf("%v: untrusted root error = %v, want %v", name, err, ErrUntrustedTSA)
+		}
+	}
+}
+
+func TestVerifyNotTimestamping(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t, x509.ExtKeyUsageEmailProtection)
+
+	local, err := NewLocalAuthority(ctx, issuer, OIDAnyPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewAuthority(local, []*x509.Certificate{issuer.root}).Timestamp(ctx, []byte("data"))
+	if !errors.Is(err, ErrNotTimestamping) {
+		t.Errorf("Timestamp() error = %v, want %v", err, ErrNotTimestamping)
+	}
+}
@@ -1,6 +1,24 @@
 package helper
 
+import (
+	"encoding/json"
+	"net/http"
+)
+
 type Response struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 }
+
+// WriteResponse writes response as a json body with the given status code.
+func WriteResponse(w http.ResponseWriter, status int, response Response) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
@@ -0,0 +1,44 @@
+package link
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DefaultExpiry is the lifetime of links created without expires_at.
+	DefaultExpiry = 7 * 24 * time.Hour
+
+	// MaxExpiry is the longest lifetime of a link.
+	MaxExpiry = 90 * 24 * time.Hour
+)
+
+// CreateLinkRequest creates a share link for the current
+// version of a file.
+type CreateLinkRequest struct {
+	UserID uint64
+	FileID uint64
+
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxDownloads int        `json:"max_downloads"`
+	Passphrase   string     `json:"passphrase"`
+}
+
+func (r *CreateLinkRequest) Validate(now time.Time) error {
+	if r.ExpiresAt == nil {
+		expiresAt := now.Add(DefaultExpiry)
+		r.ExpiresAt = &expiresAt
+	}
+
+	if !r.ExpiresAt.After(now) {
+		return errors.New("Request invalid. Expires_at must be in the future")
+	}
+	if r.ExpiresAt.Sub(now) > MaxExpiry {
+		return errors.New("Request invalid. Links can not last more than 90 days")
+	}
+	if r.MaxDownloads < 0 {
+		return errors.New("Request invalid. Max_downloads can not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package link
+
+import (
+	"context"
+	"encoding/json"
+	"encryption/file"
+	"encryption/helper"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PassphraseHeader carries the passphrase of a share link so
+// that it does not end up in URLs and access logs.
+const PassphraseHeader = "X-Share-Passphrase"
+
+type LinkService interface {
+	createLink(ctx context.Context, request CreateLinkRequest) (*Link, error)
+	listLinks(ctx context.Context, userID uint64, fileID uint64) ([]Link, error)
+	revokeLink(ctx context.Context, userID uint64, id uint64) error
+	downloadLink(ctx context.Context, token string, passphrase string) (*file.File, error)
+}
+
+type Handler struct {
+	linkService LinkService
+}
+
+func NewLinkHandler(
+	ls LinkService,
+) Handler {
+	return Handler{
+		linkService: ls,
+	}
+}
+
+// fileIDFromPath returns the id of /file/:id/links.
+func fileIDFromPath(path string) (uint64, error) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 {
+		return 0, errors.New("Request invalid. File id is required")
+	}
+
+	return strconv.ParseUint(segments[1], 10, 64)
+}
+
+func (h *Handler) CreateLink(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	fileID, err := fileIDFromPath(r.URL.Path)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	var request CreateLinkRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate(time.Now())
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userId
+	request.FileID = fileID
+
+	res, err := h.linkService.createLink(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+// ListLinks lists the links of a file on /file/:id/links,
+// or all the links of the user on /links.
+func (h *Handler) ListLinks(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	var fileID uint64
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		var err error
+		fileID, err = fileIDFromPath(r.URL.Path)
+		if err != nil {
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+			return
+		}
+	}
+
+	res, err := h.linkService.listLinks(r.Context(), userId, fileID)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) RevokeLink(w http.ResponseWriter, r *http.Request) {
+	userId := uint64(r.Context().Value("user_id").(float64))
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/links/"), 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = h.linkService.revokeLink(r.Context(), userId, id)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{Message: "Link revoked"})
+}
+
+// DownloadLink serves the file of a share link on /s/:token
+// without authentication.
+func (h *Handler) DownloadLink(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/s/")
+
+	res, err := h.linkService.downloadLink(r.Context(), token, r.Header.Get(PassphraseHeader))
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrLinkNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrPassphraseRequired), errors.Is(err, ErrWrongPassphrase):
+			status = http.StatusUnauthorized
+		case errors.Is(err, ErrLinkLocked):
+			status = http.StatusLocked
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v\"", res.Filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(res.Content)
+}
@@ -0,0 +1,112 @@
+package link
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const tokenSize = 32
+
+// maxDerivations is the number of keys derived at once, each
+// derivation takes 64 MiB of memory.
+const maxDerivations = 4
+
+// derivations holds a slot per running key derivation.
+var derivations = make(chan struct{}, maxDerivations)
+
+var errInvalidToken = errors.New("invalid share link token")
+
+// newToken generates a random link token.
+func newToken() (string, error) {
+	token := make([]byte, tokenSize)
+
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashToken returns the hash a link is looked up by. It is
+// domain separated from the key so it can not be used to
+// unwrap the file key.
+func hashToken(token string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != tokenSize {
+		return nil, errInvalidToken
+	}
+
+	hash := sha256.Sum256(append([]byte("share-link-id:"), raw...))
+	return hash[:], nil
+}
+
+// deriveKey derives the AES key wrapping the file key from
+// the token and the passphrase, empty when the link has none.
+// It waits for a derivation slot until ctx is done.
+func deriveKey(ctx context.Context, token string, passphrase string, salt []byte) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != tokenSize {
+		return nil, errInvalidToken
+	}
+
+	select {
+	case derivations <- struct{}{}:
+		defer func() { <-derivations }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	secret := append([]byte("share-link-key:"), raw...)
+	secret = append(secret, passphrase...)
+
+	return argon2.IDKey(secret, salt, 1, 64*1024, 4, 32), nil
+}
+
+// wrapKey encrypts the file key with AES-GCM whatever the guard
+// mode is, so that a wrong passphrase is detected when unwrapping.
+func wrapKey(key []byte, fileKey []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, fileKey, nil), nil
+}
+
+func unwrapKey(key []byte, wrappedKey []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrappedKey) < gcm.NonceSize() {
+		return nil, errors.New("invalid wrapped key")
+	}
+
+	nonce, data := wrappedKey[:gcm.NonceSize()], wrappedKey[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(c)
+}
@@ -0,0 +1,103 @@
+package link
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWrapKeyWithPassphrase(t *testing.T) {
+	token, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := []byte("0123456789abcdef")
+	fileKey := []byte("0123456789abcdef0123456789abcdef")
+
+	key, err := deriveKey(context.Background(), token, "secret", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrappedKey, err := wrapKey(key, fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err = deriveKey(context.Background(), token, "secret", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := unwrapKey(key, wrappedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res, fileKey) {
+		t.Fatalf("unwrapped key = %x, want %x", res, fileKey)
+	}
+
+	for _, passphrase := range []string{"", "wrong"} {
+		key, err := deriveKey(context.Background(), token, passphrase, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = unwrapKey(key, wrappedKey)
+		if err == nil {
+			t.Errorf("passphrase %q unwrapped the key", passphrase)
+		}
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	token, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hashToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := deriveKey(context.Background(), token, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(hash, key) {
+		t.Error("token hash is the wrapping key")
+	}
+
+	for _, token := range []string{"", "not a token", "c2hvcnQ"} {
+		_, err := hashToken(token)
+		if err != errInvalidToken {
+			t.Errorf("hashToken(%q) error = %v, want %v", token, err, errInvalidToken)
+		}
+	}
+}
+
+func TestLinkActive(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name string
+		link Link
+		want bool
+	}{
+		{"active", Link{ExpiresAt: now.Add(time.Hour)}, true},
+		{"expired", Link{ExpiresAt: now.Add(-time.Hour)}, false},
+		{"revoked", Link{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, false},
+		{"downloads left", Link{ExpiresAt: now.Add(time.Hour), MaxDownloads: 2, Downloads: 1}, true},
+		{"downloads used", Link{ExpiresAt: now.Add(time.Hour), MaxDownloads: 2, Downloads: 2}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.link.Active(now); got != tt.want {
+			t.Errorf("%v: Active() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
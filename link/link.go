@@ -0,0 +1,59 @@
+package link
+
+import "time"
+
+// maxFailedAttempts is the number of wrong passphrases
+// a link accepts before it is locked.
+const maxFailedAttempts = 5
+
+// Link is a share link giving anyone holding its token
+// access to one version of a file until it expires, runs
+// out of downloads or is revoked.
+type Link struct {
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"user_id"`
+	FileID uint64 `json:"file_id"`
+
+	// Version is the file version the link was created for,
+	// later versions are not shared by the link.
+	Version  int    `json:"version"`
+	Filename string `json:"filename"`
+
+	// Token is only known when the link is created,
+	// the server keeps its hash.
+	Token     string `json:"token,omitempty"`
+	TokenHash []byte `json:"-"`
+
+	// WrappedKey is the file key encrypted with the
+	// key derived from the token, salt and passphrase.
+	WrappedKey    []byte `json:"-"`
+	Salt          []byte `json:"-"`
+	HasPassphrase bool   `json:"has_passphrase"`
+
+	// MaxDownloads is the number of allowed
+	// downloads, 0 for unlimited downloads.
+	MaxDownloads int `json:"max_downloads"`
+	Downloads    int `json:"downloads"`
+
+	// FailedAttempts is the number of wrong passphrases
+	// tried, the link is locked once it reaches the maximum.
+	FailedAttempts int `json:"failed_attempts"`
+
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active reports whether the link can still be downloaded at now.
+func (l Link) Active(now time.Time) bool {
+	if l.RevokedAt != nil || !now.Before(l.ExpiresAt) {
+		return false
+	}
+
+	return l.MaxDownloads == 0 || l.Downloads < l.MaxDownloads
+}
+
+// Locked reports whether too many wrong passphrases were tried.
+func (l Link) Locked() bool {
+	return l.FailedAttempts >= maxFailedAttempts
+}
@@ -0,0 +1,229 @@
+package link
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DB interface {
+	GetConn() *pgxpool.Pool
+}
+
+type linkRepository struct {
+	db DB
+}
+
+func NewLinkRepository(db DB) *linkRepository {
+	return &linkRepository{
+		db: db,
+	}
+}
+
+func (lr *linkRepository) Create(ctx context.Context, link Link) (uint64, error) {
+	stmt := `
+	INSERT INTO
+		share_links (
+			user_id,
+			file_id,
+			version,
+			token_hash,
+			wrapped_key,
+			salt,
+			has_passphrase,
+			max_downloads,
+			expires_at
+		)
+	VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6,
+		$7,
+		$8,
+		$9
+	)
+	RETURNING id, created_at
+	`
+
+	err := lr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		link.UserID,
+		link.FileID,
+		link.Version,
+		link.TokenHash,
+		link.WrappedKey,
+		link.Salt,
+		link.HasPassphrase,
+		link.MaxDownloads,
+		link.ExpiresAt,
+	).Scan(&link.ID, &link.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	return link.ID, nil
+}
+
+const selectLink = `
+	SELECT
+			l.id,
+			l.user_id,
+			l.file_id,
+			l.version,
+			f.filename,
+			l.token_hash,
+			l.wrapped_key,
+			l.salt,
+			l.has_passphrase,
+			l.max_downloads,
+			l.downloads,
+			l.failed_attempts,
+			l.expires_at,
+			l.revoked_at,
+			l.created_at
+	 FROM share_links l
+	 JOIN files f ON l.file_id = f.id
+`
+
+type row interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(r row) (Link, error) {
+	var link Link
+
+	err := r.Scan(
+		&link.ID,
+		&link.UserID,
+		&link.FileID,
+		&link.Version,
+		&link.Filename,
+		&link.TokenHash,
+		&link.WrappedKey,
+		&link.Salt,
+		&link.HasPassphrase,
+		&link.MaxDownloads,
+		&link.Downloads,
+		&link.FailedAttempts,
+		&link.ExpiresAt,
+		&link.RevokedAt,
+		&link.CreatedAt,
+	)
+
+	return link, err
+}
+
+func (lr *linkRepository) Get(ctx context.Context, id uint64) (Link, error) {
+	return scanLink(lr.db.GetConn().QueryRow(ctx, selectLink+` WHERE l.id = $1`, id))
+}
+
+// GetByTokenHash returns the link of a token. Links of
+// files in the trash are not found.
+func (lr *linkRepository) GetByTokenHash(ctx context.Context, tokenHash []byte) (Link, error) {
+	stmt := selectLink + ` WHERE l.token_hash = $1 AND f.deleted_at IS NULL`
+
+	return scanLink(lr.db.GetConn().QueryRow(ctx, stmt, tokenHash))
+}
+
+// List lists the links of a user, newest first. A fileID of
+// 0 lists the links of all the user's files.
+func (lr *linkRepository) List(ctx context.Context, userID uint64, fileID uint64) ([]Link, error) {
+	var links []Link
+
+	stmt := selectLink + `
+	 WHERE l.user_id = $1
+	 	AND ($2 = 0 OR l.file_id = $2)
+	 ORDER BY l.created_at DESC, l.id DESC
+	`
+
+	rows, err := lr.db.GetConn().Query(ctx, stmt, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// CountDownload counts a download of the link if it is still
+// active, and reports whether it was counted. The check and
+// the count are a single statement so concurrent downloads
+// can not exceed the maximum.
+func (lr *linkRepository) CountDownload(ctx context.Context, id uint64) (bool, error) {
+	stmt := `
+	UPDATE share_links
+	SET downloads = downloads + 1
+	WHERE id = $1
+		AND revoked_at IS NULL
+		AND expires_at > now()
+		AND (max_downloads = 0 OR downloads < max_downloads)
+	`
+
+	tag, err := lr.db.GetConn().Exec(ctx, stmt, id)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// AttemptPassphrase counts an attempt of a passphrase as failed until
+// it is cleared, and reports whether it was counted. Attempts are no
+// longer counted once max failed, concurrent attempts can not exceed
+// it.
+func (lr *linkRepository) AttemptPassphrase(ctx context.Context, id uint64, max int) (bool, error) {
+	stmt := `
+	UPDATE share_links
+	SET failed_attempts = failed_attempts + 1
+	WHERE id = $1 AND failed_attempts < $2
+	`
+
+	tag, err := lr.db.GetConn().Exec(ctx, stmt, id, max)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// ClearPassphraseAttempt uncounts an attempt of
+// the right passphrase.
+func (lr *linkRepository) ClearPassphraseAttempt(ctx context.Context, id uint64) error {
+	stmt := `
+	UPDATE share_links
+	SET failed_attempts = failed_attempts - 1
+	WHERE id = $1 AND failed_attempts > 0
+	`
+
+	_, err := lr.db.GetConn().Exec(ctx, stmt, id)
+
+	return err
+}
+
+func (lr *linkRepository) Revoke(ctx context.Context, id uint64) error {
+	stmt := `
+	UPDATE share_links
+	SET revoked_at = now()
+	WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	_, err := lr.db.GetConn().Exec(ctx, stmt, id)
+
+	return err
+}
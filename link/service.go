@@ -0,0 +1,303 @@
+package link
+
+import (
+	"context"
+	"crypto/rand"
+	"encryption/file"
+	"encryption/guard"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const fileTable = "keys"
+
+var (
+	ErrLinkNotFound       = errors.New("Share link not found or no longer available")
+	ErrPassphraseRequired = errors.New("Share link requires a passphrase")
+	ErrWrongPassphrase    = errors.New("Share link passphrase is wrong")
+	ErrLinkLocked         = errors.New("Share link is locked after too many wrong passphrases")
+)
+
+type LinkRepository interface {
+	Create(ctx context.Context, link Link) (uint64, error)
+	Get(ctx context.Context, id uint64) (Link, error)
+	GetByTokenHash(ctx context.Context, tokenHash []byte) (Link, error)
+	List(ctx context.Context, userID uint64, fileID uint64) ([]Link, error)
+	CountDownload(ctx context.Context, id uint64) (bool, error)
+	AttemptPassphrase(ctx context.Context, id uint64, max int) (bool, error)
+	ClearPassphraseAttempt(ctx context.Context, id uint64) error
+	Revoke(ctx context.Context, id uint64) error
+}
+
+type FileRepository interface {
+	Get(ctx context.Context, id uint64) (file.File, error)
+	GetVersion(ctx context.Context, fileID uint64, version int) (file.Version, error)
+}
+
+type Guard interface {
+	GetKey(ctx context.Context, table string, metadata []byte) (guard.Key, error)
+	Decrypt(key []byte, data []byte) ([]byte, error)
+}
+
+type FileSystem interface {
+	Read(filepath string) ([]byte, error)
+}
+
+type linkService struct {
+	linkRepository LinkRepository
+	fileRepository FileRepository
+	fileSystem     FileSystem
+	guard          Guard
+}
+
+func NewLinkService(
+	lr LinkRepository,
+	fr FileRepository,
+	fs FileSystem,
+	g Guard,
+) *linkService {
+	return &linkService{
+		linkRepository: lr,
+		fileRepository: fr,
+		fileSystem:     fs,
+		guard:          g,
+	}
+}
+
+// getOwnedFile returns a file owned by userID.
+func (ls *linkService) getOwnedFile(ctx context.Context, userID uint64, fileID uint64) (file.File, error) {
+	data, err := ls.fileRepository.Get(ctx, fileID)
+	if err != nil && err != pgx.ErrNoRows {
+		return file.File{}, err
+	}
+	if err == pgx.ErrNoRows {
+		return file.File{}, errors.New("Requested file not found")
+	}
+
+	if data.UserID != userID {
+		return file.File{}, errors.New("You do not have access to this resource data")
+	}
+
+	return data, nil
+}
+
+// getOwnedLink returns a link created by userID.
+func (ls *linkService) getOwnedLink(ctx context.Context, userID uint64, id uint64) (Link, error) {
+	link, err := ls.linkRepository.Get(ctx, id)
+	if err != nil && err != pgx.ErrNoRows {
+		return Link{}, err
+	}
+	if err == pgx.ErrNoRows {
+		return Link{}, errors.New("Requested link not found")
+	}
+
+	if link.UserID != userID {
+		return Link{}, errors.New("You do not have access to this resource data")
+	}
+
+	return link, nil
+}
+
+// createLink creates a link to the current version of a file. The
+// returned link holds the token, which is not stored by the server.
+func (ls *linkService) createLink(ctx context.Context, request CreateLinkRequest) (*Link, error) {
+	data, err := ls.getOwnedFile(ctx, request.UserID, request.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	// quarantined and infected files are not shared
+	if data.ScanStatus == file.ScanQuarantined || data.ScanStatus == file.ScanInfected {
+		return nil, file.ErrQuarantined
+	}
+
+	fileKey, err := ls.guard.GetKey(ctx, fileTable, data.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenHash, err := hashToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(ctx, token, request.Passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := wrapKey(key, fileKey.PlainKey)
+	if err != nil {
+		return nil, err
+	}
+
+	link := Link{
+		UserID:        data.UserID,
+		FileID:        data.ID,
+		Version:       data.Version,
+		Filename:      data.Filename,
+		TokenHash:     tokenHash,
+		WrappedKey:    wrappedKey,
+		Salt:          salt,
+		HasPassphrase: request.Passphrase != "",
+		MaxDownloads:  request.MaxDownloads,
+		ExpiresAt:     *request.ExpiresAt,
+	}
+
+	link.ID, err = ls.linkRepository.Create(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	link.Token = token
+	link.CreatedAt = time.Now()
+
+	return &link, nil
+}
+
+// listLinks lists the links of a user, or of one of the
+// user's files when fileID is not 0.
+func (ls *linkService) listLinks(ctx context.Context, userID uint64, fileID uint64) ([]Link, error) {
+	if fileID != 0 {
+		_, err := ls.getOwnedFile(ctx, userID, fileID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	links, err := ls.linkRepository.List(ctx, userID, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if links == nil {
+		links = []Link{}
+	}
+
+	return links, nil
+}
+
+func (ls *linkService) revokeLink(ctx context.Context, userID uint64, id uint64) error {
+	_, err := ls.getOwnedLink(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return ls.linkRepository.Revoke(ctx, id)
+}
+
+// downloadLink returns the file version shared by a link. The file
+// key can only be unwrapped with the token and passphrase, a download
+// is counted once they are checked. Passphrases are counted as failed
+// before they are checked, the link is locked once too many failed.
+func (ls *linkService) downloadLink(ctx context.Context, token string, passphrase string) (*file.File, error) {
+	tokenHash, err := hashToken(token)
+	if err != nil {
+		return nil, ErrLinkNotFound
+	}
+
+	link, err := ls.linkRepository.GetByTokenHash(ctx, tokenHash)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows || !link.Active(time.Now()) {
+		return nil, ErrLinkNotFound
+	}
+
+	if link.HasPassphrase && passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	if link.HasPassphrase {
+		if link.Locked() {
+			return nil, ErrLinkLocked
+		}
+
+		counted, err := ls.linkRepository.AttemptPassphrase(ctx, link.ID, maxFailedAttempts)
+		if err != nil {
+			return nil, err
+		}
+		if !counted {
+			return nil, ErrLinkLocked
+		}
+	}
+
+	key, err := deriveKey(ctx, token, passphrase, link.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey, err := unwrapKey(key, link.WrappedKey)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	if link.HasPassphrase {
+		err = ls.linkRepository.ClearPassphraseAttempt(ctx, link.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ls.fileRepository.Get(ctx, link.FileID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, ErrLinkNotFound
+	}
+
+	if data.ScanStatus == file.ScanQuarantined || data.ScanStatus == file.ScanInfected {
+		return nil, file.ErrQuarantined
+	}
+
+	filepath, damaged := data.Filepath, data.Damaged
+	if link.Version != data.Version {
+		v, err := ls.fileRepository.GetVersion(ctx, data.ID, link.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		filepath, damaged = v.Filepath, v.Damaged
+	}
+
+	if damaged {
+		return nil, file.ErrDamaged
+	}
+
+	counted, err := ls.linkRepository.CountDownload(ctx, link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		return nil, ErrLinkNotFound
+	}
+
+	fileContent, err := ls.fileSystem.Read(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ls.guard.Decrypt(fileKey, fileContent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file.File{
+		Filename: link.Filename,
+		Content:  res,
+	}, nil
+}
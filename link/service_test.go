@@ -0,0 +1,76 @@
+package link
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeLinks holds a single link of a link repository.
+type fakeLinks struct {
+	LinkRepository
+	link Link
+}
+
+func (f *fakeLinks) GetByTokenHash(ctx context.Context, tokenHash []byte) (Link, error) {
+	return f.link, nil
+}
+
+func (f *fakeLinks) AttemptPassphrase(ctx context.Context, id uint64, max int) (bool, error) {
+	if f.link.FailedAttempts >= max {
+		return false, nil
+	}
+	f.link.FailedAttempts++
+	return true, nil
+}
+
+func (f *fakeLinks) ClearPassphraseAttempt(ctx context.Context, id uint64) error {
+	f.link.FailedAttempts--
+	return nil
+}
+
+func TestDownloadLinkLockout(t *testing.T) {
+	ctx := context.Background()
+
+	token, err := newToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	salt := []byte("0123456789abcdef")
+	key, err := deriveKey(ctx, token, "secret", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrappedKey, err := wrapKey(key, []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links := &fakeLinks{link: Link{
+		ID:            1,
+		WrappedKey:    wrappedKey,
+		Salt:          salt,
+		HasPassphrase: true,
+		ExpiresAt:     time.Now().Add(time.Hour),
+	}}
+	ls := &linkService{linkRepository: links}
+
+	for i := 0; i < maxFailedAttempts; i++ {
+		_, err = ls.downloadLink(ctx, token, "wrong")
+		if !errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("attempt %v: downloadLink() error = %v, want %v", i+1, err, ErrWrongPassphrase)
+		}
+	}
+
+	// the right passphrase is no longer tried
+	_, err = ls.downloadLink(ctx, token, "secret")
+	if !errors.Is(err, ErrLinkLocked) {
+		t.Errorf("downloadLink() after %v failures error = %v, want %v", maxFailedAttempts, err, ErrLinkLocked)
+	}
+	if links.link.FailedAttempts != maxFailedAttempts {
+		t.Errorf("failed attempts = %v, want %v", links.link.FailedAttempts, maxFailedAttempts)
+	}
+}
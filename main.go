@@ -1,21 +1,30 @@
 package main
 
 import (
+	"context"
+	"encryption/ca"
 	"encryption/cache"
 	"encryption/database"
 	"encryption/file"
+	"encryption/folder"
 	"encryption/guard"
+	"encryption/guard/timestamp"
+	"encryption/link"
 	"encryption/request"
+	"encryption/scanner"
+	"encryption/storage"
 	"encryption/user"
-	"encryption/user/decrypt"
 	filepermission "encryption/user/file_permission"
 	"encryption/user/permission"
 	"encryption/user/profile"
+	signingkey "encryption/user/signing_key"
+	"expvar"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -59,8 +68,10 @@ func main() {
 
 	userRepository := user.NewUserRepository(db)
 	fileRepository := file.NewFileRepository(db)
+	folderRepository := folder.NewFolderRepository(db)
 	permissionRepository := permission.NewPermissionRepository(db)
 	filePermissionRepository := filepermission.NewPermissionRepository(db)
+	signingKeyRepository := signingkey.NewSigningKeyRepository(db)
 	guardRepository := guard.NewGuardRepository(guardDB)
 
 	guardMode, _ := strconv.Atoi(os.Getenv("GUARD_MODE"))
@@ -70,28 +81,108 @@ func main() {
 		guardRepository,
 	)
 
-	userService := user.NewFileService(userRepository, *guard)
+	caService, err := ca.NewCAService(context.Background(), ca.NewCARepository(db), guard, ca.ConfigFromEnv())
+	if err != nil {
+		fmt.Println("certificate authority", err)
+		os.Exit(1)
+	}
+	caHandler := ca.NewCAHandler(caService)
+
+	userService := user.NewFileService(userRepository, signingKeyRepository, caService, *guard)
 	userHandler := user.NewUserHandler(userService)
 
-	fileSystem := file.NewFileSystem()
+	// register the keys of users created before the key registry
+	err = userService.RegisterSigningKeys(context.Background())
+	if err != nil {
+		fmt.Println("register signing keys", err)
+	}
 
-	decryptService := decrypt.NewDecryptService(
-		fileRepository,
-		fileSystem,
-		*redisClient,
-		guard,
-	)
+	// certify the keys of users created before the certificate authority
+	err = userService.IssueCertificates(context.Background())
+	if err != nil {
+		fmt.Println("issue certificates", err)
+	}
+
+	fileSystem := file.NewFileSystem()
 
-	permissionService := permission.NewPermissionService(decryptService, fileSystem, filePermissionRepository, permissionRepository, userRepository, fileRepository, *guard, userService)
+	permissionService := permission.NewPermissionService(fileSystem, filePermissionRepository, permissionRepository, userRepository, fileRepository, folderRepository, *guard, userService)
 	permissionHandler := permission.NewPermissionHandler(permissionService)
 
-	fileService := file.NewFileService(filePermissionRepository, permissionService, *redisClient, userService, fileSystem, fileRepository, *guard)
+	// replace the file copies of earlier grants with wrapped keys
+	// and catch up grants left behind by failed syncs
+	err = permissionService.SyncFilePermissions(context.Background(), 0)
+	if err != nil {
+		fmt.Println("sync file permissions", err)
+	}
+
+	contentValidator := file.NewContentValidator(file.SizeLimitsFromEnv())
+
+	var fileScanner file.Scanner
+	if clamdScanner := scanner.NewClamdScannerFromEnv(); clamdScanner != nil {
+		fileScanner = clamdScanner
+	}
+
+	// signatures are timestamped by the local TSA unless a remote one
+	// is set, the tokens of the local TSA stay trusted after switching
+	tsaConfig := timestamp.ConfigFromEnv()
+
+	var localTSA *timestamp.LocalAuthority
+	var tsa timestamp.TSA = timestamp.NewClient(tsaConfig.URL)
+	if tsaConfig.URL == "" {
+		localTSA, err = timestamp.NewLocalAuthority(context.Background(), caService, tsaConfig.Policy)
+		if err != nil {
+			fmt.Println("timestamp authority", err)
+			os.Exit(1)
+		}
+		tsa = localTSA
+	}
+	timestampAuthority := timestamp.NewAuthority(tsa, append(tsaConfig.Roots, caService.Root()))
+
+	fileService := file.NewFileService(filePermissionRepository, permissionService, *redisClient, userService, fileSystem, fileRepository, folderRepository, *guard, contentValidator, fileScanner, file.ScanPolicyFromEnv(), file.QuotaFromEnv(), caService, timestampAuthority)
 	fileHandler := file.NewFileHandler(fileService)
 
+	rescanInterval, err := time.ParseDuration(os.Getenv("SCAN_RETRY_INTERVAL"))
+	if err != nil {
+		rescanInterval = 10 * time.Minute
+	}
+	go fileService.RunQuarantineRescan(context.Background(), rescanInterval)
+
+	trashPurgeInterval, err := time.ParseDuration(os.Getenv("TRASH_PURGE_INTERVAL"))
+	if err != nil {
+		trashPurgeInterval = time.Hour
+	}
+	go fileService.RunTrashPurge(context.Background(), file.TrashRetentionFromEnv(), trashPurgeInterval)
+
+	collector := storage.NewCollector(storage.NewReferenceRepository(db), guard, "files", storage.GracePeriodFromEnv())
+
+	gcInterval, err := time.ParseDuration(os.Getenv("GC_INTERVAL"))
+	if err != nil {
+		gcInterval = 24 * time.Hour
+	}
+	go collector.Run(context.Background(), gcInterval)
+
+	scrubber := storage.NewScrubber(storage.NewReferenceRepository(db))
+	storageHandler := storage.NewStorageHandler(scrubber)
+
+	scrubInterval, err := time.ParseDuration(os.Getenv("SCRUB_INTERVAL"))
+	if err != nil {
+		scrubInterval = 24 * time.Hour
+	}
+	go scrubber.Run(context.Background(), scrubInterval)
+
+	folderService := folder.NewFolderService(folderRepository, userService)
+	folderHandler := folder.NewFolderHandler(folderService)
+
+	linkRepository := link.NewLinkRepository(db)
+	linkService := link.NewLinkService(linkRepository, fileRepository, fileSystem, guard)
+	linkHandler := link.NewLinkHandler(linkService)
+
 	profileService := profile.NewProfileService(*redisClient, userService, userRepository, permissionRepository, *guard)
 	profileHandler := profile.NewUserHandler(profileService)
 
-	mux := http.DefaultServeMux
+	// expvar registers /debug/vars on the default mux,
+	// the API has its own so that it is not public
+	mux := http.NewServeMux()
 
 	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -126,8 +217,20 @@ func main() {
 
 	profileRoutes := func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case "GET":
+			if r.URL.Path == "/profile/usage" {
+				fileHandler.GetUsage(w, r)
+			}
 		case "POST":
-			profileHandler.GetUserProfile(w, r)
+			if r.URL.Path == "/profile/signing-key/rotate" {
+				userHandler.RotateSigningKey(w, r)
+			} else if r.URL.Path == "/profile/signing-key/challenge" {
+				userHandler.SigningKeyChallenge(w, r)
+			} else if r.URL.Path == "/profile/signing-key" {
+				userHandler.RegisterSigningKey(w, r)
+			} else {
+				profileHandler.GetUserProfile(w, r)
+			}
 		case "OPTIONS":
 			w.Write([]byte("success"))
 		}
@@ -135,15 +238,55 @@ func main() {
 	mux.Handle("/profile/", request.AuthMiddleware(http.HandlerFunc(profileRoutes)))
 
 	subFileRoutes := func(w http.ResponseWriter, r *http.Request) {
+		// segments of /file/:id/:resource/...
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		resource := ""
+		if len(segments) > 2 {
+			resource = segments[2]
+		}
+
 		switch r.Method {
 		case "GET":
-			fileHandler.GetFile(w, r)
+			switch {
+			case resource == "thumbnail": // /file/:id/thumbnail
+				fileHandler.GetThumbnail(w, r)
+			case resource == "signature": // /file/:id/signature
+				fileHandler.GetSignature(w, r)
+			case resource == "versions" && len(segments) == 4: // /file/:id/versions/:version
+				fileHandler.GetVersion(w, r)
+			case resource == "versions": // /file/:id/versions
+				fileHandler.ListVersions(w, r)
+			case resource == "links": // /file/:id/links
+				linkHandler.ListLinks(w, r)
+			case resource == "cosign": // /file/:id/cosign
+				fileHandler.GetSigningRequest(w, r)
+			default:
+				fileHandler.GetFile(w, r)
+			}
 		case "POST":
-			urlFlag := strings.Split(r.URL.Path, "/")[2]
+			urlFlag := segments[1]
 			if urlFlag == "sign" { // /file/sign/:id
 				fileHandler.SignFile(w, r)
 			} else if urlFlag == "verify" { // /file/verify -> nerima dari upload
 				fileHandler.VerifyFile(w, r)
+			} else if resource == "sign" && len(segments) == 4 && segments[3] == "prepare" { // /file/:id/sign/prepare
+				fileHandler.PrepareSignature(w, r)
+			} else if resource == "sign" && len(segments) == 4 && segments[3] == "complete" { // /file/:id/sign/complete
+				fileHandler.CompleteSignature(w, r)
+			} else if resource == "signature" && len(segments) == 4 && segments[3] == "revoke" { // /file/:id/signature/revoke
+				fileHandler.RevokeSignature(w, r)
+			} else if resource == "versions" && len(segments) == 5 && segments[4] == "restore" { // /file/:id/versions/:version/restore
+				fileHandler.RestoreVersion(w, r)
+			} else if resource == "versions" { // /file/:id/versions
+				fileHandler.UploadVersion(w, r)
+			} else if resource == "move" { // /file/:id/move
+				fileHandler.MoveFile(w, r)
+			} else if resource == "links" { // /file/:id/links
+				linkHandler.CreateLink(w, r)
+			} else if resource == "cosign" && len(segments) == 4 { // /file/:id/cosign/:action
+				fileHandler.RespondSigningRequest(w, r)
+			} else if resource == "cosign" { // /file/:id/cosign
+				fileHandler.RequestSignatures(w, r)
 			}
 		case "DELETE":
 			fileHandler.DeleteFile(w, r)
@@ -167,6 +310,99 @@ func main() {
 
 	mux.Handle("/files/", request.AuthMiddleware(http.HandlerFunc(fileHandler.ListFiles)))
 
+	archiveRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			fileHandler.ArchiveFiles(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/archive", request.AuthMiddleware(http.HandlerFunc(archiveRoutes)))
+
+	trashRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fileHandler.ListTrash(w, r)
+		case "DELETE":
+			fileHandler.EmptyTrash(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/trash", request.AuthMiddleware(http.HandlerFunc(trashRoutes)))
+
+	subTrashRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			if strings.HasSuffix(r.URL.Path, "/restore") { // /trash/:id/restore
+				fileHandler.RestoreFile(w, r)
+			}
+		case "DELETE": // /trash/:id
+			fileHandler.PurgeFile(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/trash/", request.AuthMiddleware(http.HandlerFunc(subTrashRoutes)))
+
+	mux.Handle("/links", request.AuthMiddleware(http.HandlerFunc(linkHandler.ListLinks)))
+
+	subLinkRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "DELETE": // /links/:id
+			linkHandler.RevokeLink(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/links/", request.AuthMiddleware(http.HandlerFunc(subLinkRoutes)))
+
+	// share links are downloaded without an account
+	mux.HandleFunc("/s/", linkHandler.DownloadLink)
+
+	// the CA certificate and CRL are public for verifiers
+	mux.HandleFunc("/ca/certificate", caHandler.GetCertificate)
+	mux.HandleFunc("/ca/crl", caHandler.GetCRL)
+
+	if localTSA != nil {
+		mux.Handle("/tsa", localTSA)
+	}
+
+	folderRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			folderHandler.CreateFolder(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/folder", request.AuthMiddleware(http.HandlerFunc(folderRoutes)))
+
+	subFolderRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			if strings.HasSuffix(r.URL.Path, "/grant") { // /folder/:id/grant
+				permissionHandler.GrantFolderPermission(w, r)
+			}
+		case "PUT":
+			folderHandler.UpdateFolder(w, r)
+		case "DELETE":
+			folderHandler.DeleteFolder(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/folder/", request.AuthMiddleware(http.HandlerFunc(subFolderRoutes)))
+
+	mux.Handle("/folders/", request.AuthMiddleware(http.HandlerFunc(folderHandler.ListFolders)))
+
 	permissionRoutes := func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "POST":
@@ -187,9 +423,22 @@ func main() {
 
 	mux.Handle("/request/profile/list", request.AuthMiddleware(http.HandlerFunc(permissionHandler.GetProfileNotifications)))
 	mux.Handle("/request/file/list", request.AuthMiddleware(http.HandlerFunc(permissionHandler.GetFileNotifications)))
+	mux.Handle("/request/signing/list", request.AuthMiddleware(http.HandlerFunc(fileHandler.ListSigningRequests)))
 	mux.Handle("/request/", request.AuthMiddleware(http.HandlerFunc(permissionRoutes)))
 	mux.Handle("/request/file/", request.AuthMiddleware(http.HandlerFunc(filePermissionRoutes)))
 
+	folderPermissionRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			permissionHandler.RequestFolderPermission(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/request/folder/list", request.AuthMiddleware(http.HandlerFunc(permissionHandler.GetFolderNotifications)))
+	mux.Handle("/request/folder/", request.AuthMiddleware(http.HandlerFunc(folderPermissionRoutes)))
+
 	profilePermissionActionRoutes := func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "POST":
@@ -210,6 +459,42 @@ func main() {
 	mux.Handle("/request/action/profile/", request.AuthMiddleware(http.HandlerFunc(profilePermissionActionRoutes)))
 	mux.Handle("/request/action/file/", request.AuthMiddleware(http.HandlerFunc(filePermissionActionRoutes)))
 
+	folderPermissionActionRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			permissionHandler.RespondFolderPermissionRequest(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/request/action/folder/", request.AuthMiddleware(http.HandlerFunc(folderPermissionActionRoutes)))
+
+	scrubRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			storageHandler.GetScrubStatus(w, r)
+		case "POST":
+			storageHandler.RunScrub(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/admin/storage/scrub", request.AuthMiddleware(request.AdminMiddleware(http.HandlerFunc(scrubRoutes))))
+	mux.Handle("/admin/metrics", request.AuthMiddleware(request.AdminMiddleware(expvar.Handler())))
+
+	quotaRoutes := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT": // /admin/quotas/:user_id
+			fileHandler.SetQuota(w, r)
+		case "OPTIONS":
+			w.Write([]byte("success"))
+		}
+	}
+
+	mux.Handle("/admin/quotas/", request.AuthMiddleware(request.AdminMiddleware(http.HandlerFunc(quotaRoutes))))
+
 	var handler http.Handler = mux
 
 	handler = request.CORSMiddleware(handler)
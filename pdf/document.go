@@ -0,0 +1,517 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var errNoXref = errors.New("pdf: cross-reference table not found")
+
+// xrefEntry locates an object, either at an offset of the
+// document or at an index of a compressed object stream.
+type xrefEntry struct {
+	offset int
+	gen    int
+
+	compressed bool
+	stream     int
+	index      int
+
+	free bool
+}
+
+// document is a parsed PDF, objects are read on demand.
+type document struct {
+	data []byte
+	xref map[int]xrefEntry
+
+	// trailer and start offset of the last cross-reference section.
+	trailer   *Dict
+	startxref int
+
+	// xrefStream is true when the last section is a cross-reference stream.
+	xrefStream bool
+}
+
+// parse reads the cross-reference sections of data.
+func parse(data []byte) (*document, error) {
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	if idx < 0 {
+		return nil, errNoXref
+	}
+
+	p := &parser{data: data, pos: idx + len("startxref")}
+	startxref, err := strconv.Atoi(p.keyword())
+	if err != nil || startxref < 0 || startxref >= len(data) {
+		return nil, errNoXref
+	}
+
+	d := &document{
+		data:      data,
+		xref:      map[int]xrefEntry{},
+		startxref: startxref,
+	}
+
+	d.trailer, d.xrefStream, err = d.readXref(startxref, map[int]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// readXref reads the section at offset and the previous ones, entries
+// of newer sections take precedence over the older ones.
+func (d *document) readXref(offset int, visited map[int]bool) (*Dict, bool, error) {
+	if visited[offset] || offset < 0 || offset >= len(d.data) {
+		return nil, false, errNoXref
+	}
+	visited[offset] = true
+
+	p := &parser{data: d.data, pos: offset}
+	p.skip()
+
+	var trailer *Dict
+	var isStream bool
+	var err error
+
+	if p.hasPrefix("xref") {
+		p.pos += len("xref")
+		trailer, err = d.readXrefTable(p)
+	} else {
+		isStream = true
+		trailer, err = d.readXrefStream(p)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// hybrid files hold the compressed objects in a stream
+	if stm, ok := intValue(trailer.Get("XRefStm")); ok && !isStream {
+		_, _, err = d.readXref(stm, visited)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if prev, ok := intValue(trailer.Get("Prev")); ok {
+		_, _, err = d.readXref(prev, visited)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return trailer, isStream, nil
+}
+
+func (d *document) setEntry(num int, entry xrefEntry) {
+	if _, ok := d.xref[num]; !ok {
+		d.xref[num] = entry
+	}
+}
+
+func (d *document) readXrefTable(p *parser) (*Dict, error) {
+	for {
+		p.skip()
+		if p.hasPrefix("trailer") {
+			p.pos += len("trailer")
+			break
+		}
+
+		start, err := strconv.Atoi(p.keyword())
+		if err != nil {
+			return nil, errNoXref
+		}
+
+		count, err := strconv.Atoi(p.keyword())
+		if err != nil {
+			return nil, errNoXref
+		}
+
+		for i := 0; i < count; i++ {
+			offset, err := strconv.Atoi(p.keyword())
+			if err != nil {
+				return nil, errNoXref
+			}
+
+			gen, err := strconv.Atoi(p.keyword())
+			if err != nil {
+				return nil, errNoXref
+			}
+
+			d.setEntry(start+i, xrefEntry{offset: offset, gen: gen, free: p.keyword() == "f"})
+		}
+	}
+
+	obj, err := p.object()
+	if err != nil {
+		return nil, err
+	}
+
+	trailer, ok := obj.(*Dict)
+	if !ok {
+		return nil, errNoXref
+	}
+
+	return trailer, nil
+}
+
+func (d *document) readXrefStream(p *parser) (*Dict, error) {
+	_, obj, err := p.indirect()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok := obj.(*Stream)
+	if !ok || stream.Dict.Get("Type") != Name("XRef") {
+		return nil, errNoXref
+	}
+
+	data, err := decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	widths, ok := stream.Dict.Get("W").(Array)
+	if !ok || len(widths) != 3 {
+		return nil, errNoXref
+	}
+
+	w := make([]int, 3)
+	for i := range widths {
+		w[i], ok = intValue(widths[i])
+		if !ok || w[i] < 0 || w[i] > 8 {
+			return nil, errNoXref
+		}
+	}
+
+	size, _ := intValue(stream.Dict.Get("Size"))
+	index := Array{Raw("0"), Raw(strconv.Itoa(size))}
+	if v, ok := stream.Dict.Get("Index").(Array); ok {
+		index = v
+	}
+
+	entrySize := w[0] + w[1] + w[2]
+	pos := 0
+
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := intValue(index[i])
+		count, ok2 := intValue(index[i+1])
+		if !ok1 || !ok2 {
+			return nil, errNoXref
+		}
+
+		for j := 0; j < count; j++ {
+			if pos+entrySize > len(data) {
+				return nil, errNoXref
+			}
+
+			entry := data[pos : pos+entrySize]
+			pos += entrySize
+
+			kind := 1
+			if w[0] > 0 {
+				kind = field(entry[:w[0]])
+			}
+			f2 := field(entry[w[0] : w[0]+w[1]])
+			f3 := field(entry[w[0]+w[1]:])
+
+			switch kind {
+			case 0:
+				d.setEntry(start+j, xrefEntry{free: true})
+			case 1:
+				d.setEntry(start+j, xrefEntry{offset: f2, gen: f3})
+			case 2:
+				d.setEntry(start+j, xrefEntry{compressed: true, stream: f2, index: f3})
+			}
+		}
+	}
+
+	return stream.Dict, nil
+}
+
+// field decodes a big endian cross-reference stream field.
+func field(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	return n
+}
+
+// object reads the indirect object num, nil when it does not exist.
+func (d *document) object(num int) (Object, error) {
+	entry, ok := d.xref[num]
+	if !ok || entry.free {
+		return nil, nil
+	}
+
+	if entry.compressed {
+		return d.compressedObject(entry.stream, entry.index)
+	}
+
+	p := &parser{data: d.data, pos: entry.offset, doc: d}
+
+	ref, obj, err := p.indirect()
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.Num != num {
+		return nil, fmt.Errorf("pdf: object %d not found at offset %d", num, entry.offset)
+	}
+
+	return obj, nil
+}
+
+// compressedObject reads the object at index of the object stream num.
+func (d *document) compressedObject(num int, index int) (Object, error) {
+	obj, err := d.object(num)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok := obj.(*Stream)
+	if !ok {
+		return nil, fmt.Errorf("pdf: object stream %d not found", num)
+	}
+
+	data, err := decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	n, ok1 := intValue(stream.Dict.Get("N"))
+	first, ok2 := intValue(stream.Dict.Get("First"))
+	if !ok1 || !ok2 || index >= n {
+		return nil, errMalformed
+	}
+
+	// the header holds pairs of object number and offset
+	p := &parser{data: data}
+	offset := 0
+	for i := 0; i <= index; i++ {
+		p.keyword()
+		offset, err = strconv.Atoi(p.keyword())
+		if err != nil {
+			return nil, errMalformed
+		}
+	}
+
+	p = &parser{data: data, pos: first + offset}
+	if p.pos > len(data) {
+		return nil, errMalformed
+	}
+
+	return p.object()
+}
+
+// resolve returns the object obj refers to.
+func (d *document) resolve(obj Object) (Object, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(Ref)
+		if !ok {
+			return obj, nil
+		}
+
+		var err error
+		obj, err = d.object(ref.Num)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errMalformed
+}
+
+func (d *document) resolveDict(obj Object) (*Dict, error) {
+	obj, err := d.resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := obj.(type) {
+	case *Dict:
+		return v, nil
+	case *Stream:
+		return v.Dict, nil
+	}
+
+	return nil, errMalformed
+}
+
+// catalog returns the document catalog.
+func (d *document) catalog() (Ref, *Dict, error) {
+	ref, ok := d.trailer.Get("Root").(Ref)
+	if !ok {
+		return Ref{}, nil, errors.New("pdf: document catalog not found")
+	}
+
+	catalog, err := d.resolveDict(ref)
+	if err != nil {
+		return Ref{}, nil, err
+	}
+
+	return ref, catalog, nil
+}
+
+// firstPage returns the first page of the page tree.
+func (d *document) firstPage(catalog *Dict) (Ref, *Dict, error) {
+	ref, ok := catalog.Get("Pages").(Ref)
+
+	for depth := 0; ok && depth < 64; depth++ {
+		node, err := d.resolveDict(ref)
+		if err != nil {
+			return Ref{}, nil, err
+		}
+
+		if node.Get("Type") == Name("Page") {
+			return ref, node, nil
+		}
+
+		kids, err := d.resolve(node.Get("Kids"))
+		if err != nil {
+			return Ref{}, nil, err
+		}
+
+		array, isArray := kids.(Array)
+		if !isArray || len(array) == 0 {
+			break
+		}
+
+		ref, ok = array[0].(Ref)
+	}
+
+	return Ref{}, nil, errors.New("pdf: document has no page")
+}
+
+// decodeStream returns the decoded data of a FlateDecode or unfiltered stream.
+func decodeStream(stream *Stream) ([]byte, error) {
+	filter := stream.Dict.Get("Filter")
+	params, _ := stream.Dict.Get("DecodeParms").(*Dict)
+
+	if array, ok := filter.(Array); ok && len(array) <= 1 {
+		filter = nil
+		if len(array) == 1 {
+			filter = array[0]
+		}
+	}
+	if array, ok := stream.Dict.Get("DecodeParms").(Array); ok && len(array) == 1 {
+		params, _ = array[0].(*Dict)
+	}
+
+	switch filter {
+	case nil:
+		return stream.Data, nil
+	case Name("FlateDecode"):
+	default:
+		return nil, fmt.Errorf("pdf: unsupported stream filter %v", filter)
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(stream.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if params == nil {
+		return data, nil
+	}
+
+	predictor, _ := intValue(params.Get("Predictor"))
+	if predictor < 10 {
+		return data, nil
+	}
+
+	columns, ok := intValue(params.Get("Columns"))
+	if !ok {
+		columns = 1
+	}
+
+	colors, ok := intValue(params.Get("Colors"))
+	if !ok {
+		colors = 1
+	}
+
+	bits, ok := intValue(params.Get("BitsPerComponent"))
+	if !ok {
+		bits = 8
+	}
+
+	return unpredictPNG(data, (colors*bits*columns+7)/8, (colors*bits+7)/8)
+}
+
+// unpredictPNG reverts the PNG predictors applied to each row of data.
+func unpredictPNG(data []byte, rowSize int, bpp int) ([]byte, error) {
+	if rowSize <= 0 {
+		return nil, errMalformed
+	}
+
+	res := make([]byte, 0, len(data))
+	prev := make([]byte, rowSize)
+
+	for len(data) > 0 {
+		if len(data) < rowSize+1 {
+			return nil, errMalformed
+		}
+
+		kind, row := data[0], append([]byte{}, data[1:rowSize+1]...)
+		data = data[rowSize+1:]
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, errMalformed
+			}
+		}
+
+		res = append(res, row...)
+		prev = row
+	}
+
+	return res, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
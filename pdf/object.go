@@ -0,0 +1,371 @@
+// Package pdf reads the object structure of PDF documents and signs
+// them with an incremental update holding a signature dictionary.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	errUnexpectedEOF = errors.New("pdf: unexpected end of document")
+	errMalformed     = errors.New("pdf: malformed document")
+)
+
+// Object is a PDF object: nil (null), Name, Raw, Ref, Array, *Dict or *Stream.
+type Object interface{}
+
+// Name is a name object without its leading slash, as written.
+type Name string
+
+// Raw is a number, string, boolean or null token as written.
+type Raw string
+
+// Ref is a reference to an indirect object.
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Array is an array object.
+type Array []Object
+
+// Dict is a dictionary object keeping the order of its keys.
+type Dict struct {
+	keys   []Name
+	values map[Name]Object
+}
+
+// Stream is a stream object with its encoded data.
+type Stream struct {
+	Dict *Dict
+	Data []byte
+}
+
+func newDict() *Dict {
+	return &Dict{values: map[Name]Object{}}
+}
+
+// Get returns the value of key, nil when missing.
+func (d *Dict) Get(key Name) Object {
+	return d.values[key]
+}
+
+// Set sets the value of key, appending new keys.
+func (d *Dict) Set(key Name, value Object) {
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+// intValue returns the value of an integer token.
+func intValue(obj Object) (int, bool) {
+	raw, ok := obj.(Raw)
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
+
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func isInteger(token string) bool {
+	if token == "" {
+		return false
+	}
+
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parser reads objects from data, resolving stream
+// lengths through doc when it is set.
+type parser struct {
+	data []byte
+	pos  int
+	doc  *document
+}
+
+// skip skips white space and comments.
+func (p *parser) skip() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+
+		switch {
+		case isWhite(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keyword reads a token of regular characters.
+func (p *parser) keyword() string {
+	p.skip()
+
+	start := p.pos
+	for p.pos < len(p.data) && !isWhite(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+
+	return string(p.data[start:p.pos])
+}
+
+func (p *parser) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte(prefix))
+}
+
+// object reads the next direct object.
+func (p *parser) object() (Object, error) {
+	p.skip()
+	if p.pos >= len(p.data) {
+		return nil, errUnexpectedEOF
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '/':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.data) && !isWhite(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+			p.pos++
+		}
+		return Name(p.data[start:p.pos]), nil
+
+	case p.hasPrefix("<<"):
+		p.pos += 2
+		dict := newDict()
+
+		for {
+			p.skip()
+			if p.hasPrefix(">>") {
+				p.pos += 2
+				return dict, nil
+			}
+
+			key, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+
+			name, ok := key.(Name)
+			if !ok {
+				return nil, fmt.Errorf("pdf: dictionary key is not a name at offset %d", p.pos)
+			}
+
+			value, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+
+			dict.Set(name, value)
+		}
+
+	case c == '<':
+		end := bytes.IndexByte(p.data[p.pos:], '>')
+		if end < 0 {
+			return nil, errUnexpectedEOF
+		}
+
+		start := p.pos
+		p.pos += end + 1
+		return Raw(p.data[start:p.pos]), nil
+
+	case c == '(':
+		start := p.pos
+		depth := 0
+
+		for p.pos < len(p.data) {
+			switch p.data[p.pos] {
+			case '\\':
+				p.pos++
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			p.pos++
+
+			if depth == 0 {
+				return Raw(p.data[start:p.pos]), nil
+			}
+		}
+		return nil, errUnexpectedEOF
+
+	case c == '[':
+		p.pos++
+		array := Array{}
+
+		for {
+			p.skip()
+			if p.hasPrefix("]") {
+				p.pos++
+				return array, nil
+			}
+
+			obj, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, obj)
+		}
+
+	default:
+		token := p.keyword()
+		if token == "" {
+			return nil, fmt.Errorf("pdf: unexpected %q at offset %d", c, p.pos)
+		}
+
+		if isInteger(token) {
+			// an integer can be the object number of a reference
+			save := p.pos
+
+			gen := p.keyword()
+			if isInteger(gen) && p.keyword() == "R" {
+				num, _ := strconv.Atoi(token)
+				g, _ := strconv.Atoi(gen)
+				return Ref{Num: num, Gen: g}, nil
+			}
+
+			p.pos = save
+		}
+
+		if token == "null" {
+			return nil, nil
+		}
+
+		return Raw(token), nil
+	}
+}
+
+// indirect reads an indirect object definition.
+func (p *parser) indirect() (Ref, Object, error) {
+	num, err := strconv.Atoi(p.keyword())
+	if err != nil {
+		return Ref{}, nil, errMalformed
+	}
+
+	gen, err := strconv.Atoi(p.keyword())
+	if err != nil {
+		return Ref{}, nil, errMalformed
+	}
+
+	if p.keyword() != "obj" {
+		return Ref{}, nil, errMalformed
+	}
+
+	obj, err := p.object()
+	if err != nil {
+		return Ref{}, nil, err
+	}
+
+	dict, ok := obj.(*Dict)
+	if !ok {
+		return Ref{Num: num, Gen: gen}, obj, nil
+	}
+
+	save := p.pos
+	if p.keyword() != "stream" {
+		p.pos = save
+		return Ref{Num: num, Gen: gen}, obj, nil
+	}
+
+	// the stream data starts after an end of line
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+	} else if p.hasPrefix("\n") || p.hasPrefix("\r") {
+		p.pos++
+	}
+
+	data, err := p.streamData(dict)
+	if err != nil {
+		return Ref{}, nil, err
+	}
+
+	return Ref{Num: num, Gen: gen}, &Stream{Dict: dict, Data: data}, nil
+}
+
+// streamData reads the data of a stream starting at the current
+// offset, searching for its end when its length is wrong.
+func (p *parser) streamData(dict *Dict) ([]byte, error) {
+	length, ok := intValue(dict.Get("Length"))
+	if ref, isRef := dict.Get("Length").(Ref); isRef && p.doc != nil {
+		obj, err := p.doc.object(ref.Num)
+		if err == nil {
+			length, ok = intValue(obj)
+		}
+	}
+
+	if ok && length >= 0 && p.pos+length <= len(p.data) {
+		end := &parser{data: p.data, pos: p.pos + length}
+		if end.keyword() == "endstream" {
+			data := p.data[p.pos : p.pos+length]
+			p.pos = end.pos
+			return data, nil
+		}
+	}
+
+	end := bytes.Index(p.data[p.pos:], []byte("endstream"))
+	if end < 0 {
+		return nil, errUnexpectedEOF
+	}
+
+	data := bytes.TrimRight(p.data[p.pos:p.pos+end], "\r\n")
+	p.pos += end + len("endstream")
+	return data, nil
+}
+
+// writeObject writes the PDF syntax of obj to buf.
+func writeObject(buf *bytes.Buffer, obj Object) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case Name:
+		buf.WriteString("/" + string(v))
+	case Raw:
+		buf.WriteString(string(v))
+	case Ref:
+		fmt.Fprintf(buf, "%d %d R", v.Num, v.Gen)
+	case Array:
+		buf.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteString(" ")
+			}
+			writeObject(buf, item)
+		}
+		buf.WriteString("]")
+	case *Dict:
+		buf.WriteString("<<")
+		for _, key := range v.keys {
+			buf.WriteString(" /" + string(key) + " ")
+			writeObject(buf, v.values[key])
+		}
+		buf.WriteString(" >>")
+	}
+}
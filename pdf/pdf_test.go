@@ -0,0 +1,206 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/asn1"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// classicPDF returns a document with a cross-reference table.
+func classicPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := []int{}
+	for i, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	startxref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, startxref)
+
+	return buf.Bytes()
+}
+
+// streamPDF returns a document with a predicted cross-reference
+// stream and its page tree in a compressed object stream.
+func streamPDF() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+
+	catalog := buf.Len()
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	pages := "<< /Type /Pages /Kids [3 0 R] /Count 1 >> "
+	page := "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>"
+	header := fmt.Sprintf("2 0 3 %d ", len(pages))
+	compressed := deflate([]byte(header + pages + page))
+
+	objStm := buf.Len()
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Type /ObjStm /N 2 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", len(header), len(compressed))
+	buf.Write(compressed)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	startxref := buf.Len()
+	rows := [][]byte{
+		{0, 0, 0, 0},
+		{1, byte(catalog >> 8), byte(catalog), 0},
+		{2, 0, 4, 0},
+		{2, 0, 4, 1},
+		{1, byte(objStm >> 8), byte(objStm), 0},
+		{1, byte(startxref >> 8), byte(startxref), 0},
+	}
+
+	// PNG up predictor
+	var predicted []byte
+	prev := make([]byte, 4)
+	for _, row := range rows {
+		predicted = append(predicted, 2)
+		for i := range row {
+			predicted = append(predicted, row[i]-prev[i])
+		}
+		prev = row
+	}
+	compressed = deflate(predicted)
+
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /XRef /Size 6 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", len(compressed))
+	buf.Write(compressed)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", startxref)
+
+	return buf.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func sign(t *testing.T, data []byte, info SignatureInfo, signature []byte) []byte {
+	prepared, err := Prepare(data, info, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := prepared.Embed(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigs := Signatures(signed)
+	if len(sigs) == 0 || !bytes.Equal(prepared.SignedContent(), sigs[len(sigs)-1].SignedContent(signed)) {
+		t.Fatal("signed content differs from the prepared one")
+	}
+
+	return signed
+}
+
+func TestPrepare(t *testing.T) {
+	signTime := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	first, _ := asn1.Marshal([]byte("first signature"))
+	second, _ := asn1.Marshal([]byte("second signature"))
+
+	for name, data := range map[string][]byte{"xref table": classicPDF(), "xref stream": streamPDF()} {
+		t.Run(name, func(t *testing.T) {
+			signed := sign(t, data, SignatureInfo{Name: "alice", Reason: "Approved (final)", Time: signTime}, first)
+
+			if !bytes.HasPrefix(signed, data) {
+				t.Fatal("the update rewrote the original document")
+			}
+
+			sigs := Signatures(signed)
+			if len(sigs) != 1 {
+				t.Fatalf("got %d signatures, want 1", len(sigs))
+			}
+
+			sig := sigs[0]
+			if !bytes.Equal(sig.Contents, first) || !sig.CoversDocument(signed) {
+				t.Fatal("signature contents or byte range mismatch")
+			}
+
+			if sig.Name != "alice" || sig.Reason != "Approved (final)" || !sig.Time.Equal(signTime) || sig.SubFilter != SubFilterCAdES {
+				t.Fatalf("unexpected signature dictionary %+v", sig)
+			}
+
+			// the update is readable and references the field
+			d, err := parse(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, catalog, err := d.catalog()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			acroForm, err := d.resolveDict(catalog.Get("AcroForm"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fields, _ := acroForm.Get("Fields").(Array); len(fields) != 1 {
+				t.Fatalf("got %d fields, want 1", len(fields))
+			}
+
+			// a second signature covers the first one
+			signed = sign(t, signed, SignatureInfo{Name: "bob", Time: signTime}, second)
+
+			sigs = Signatures(signed)
+			if len(sigs) != 2 {
+				t.Fatalf("got %d signatures, want 2", len(sigs))
+			}
+
+			if sigs[0].CoversDocument(signed) || !sigs[1].CoversDocument(signed) || sigs[1].Name != "bob" {
+				t.Fatal("signatures not ordered by revision")
+			}
+
+			d, err = parse(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, page, err := d.firstPage(catalog)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			annots, _ := page.Get("Annots").(Array)
+			if len(annots) != 2 {
+				t.Fatalf("got %d annotations, want 2", len(annots))
+			}
+
+			field, err := d.resolveDict(annots[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if text(field.Get("T")) != "Signature2" {
+				t.Fatalf("field name = %q, want Signature2", text(field.Get("T")))
+			}
+		})
+	}
+}
+
+func TestTextString(t *testing.T) {
+	for _, s := range []string{"alice", `back\slash (x)`, "Zoë Ørsted"} {
+		if got := text(textString(s)); got != s {
+			t.Fatalf("text(textString(%q)) = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubFilter of PAdES signatures, a CAdES detached
+// signature of the signed byte ranges.
+const SubFilterCAdES Name = "ETSI.CAdES.detached"
+
+// byteRangeWidth is the room reserved for the byte range values.
+const byteRangeWidth = 48
+
+var (
+	ErrEncrypted         = errors.New("pdf: encrypted documents can not be signed")
+	ErrSignatureTooLarge = errors.New("pdf: signature does not fit the reserved space")
+)
+
+// SignatureInfo describes a signature in its signature dictionary.
+type SignatureInfo struct {
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	Time        time.Time
+}
+
+// Prepared is a document updated with an empty signature.
+type Prepared struct {
+	document  []byte
+	byteRange [4]int
+}
+
+// update is an object written by an incremental update.
+type update struct {
+	ref    Ref
+	offset int
+}
+
+// Prepare appends an incremental update to data holding an invisible
+// signature field on the first page and its signature dictionary,
+// with room for a signature of size bytes.
+func Prepare(data []byte, info SignatureInfo, size int) (*Prepared, error) {
+	d, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.trailer.Get("Encrypt") != nil {
+		return nil, ErrEncrypted
+	}
+
+	rootRef, catalog, err := d.catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	pageRef, page, err := d.firstPage(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	next, ok := intValue(d.trailer.Get("Size"))
+	if !ok {
+		return nil, errMalformed
+	}
+
+	sigRef := Ref{Num: next}
+	fieldRef := Ref{Num: next + 1}
+	next += 2
+
+	// add the field to the interactive form of the document
+	var acroForm *Dict
+	acroFormRef, isRef := catalog.Get("AcroForm").(Ref)
+	if catalog.Get("AcroForm") == nil {
+		acroForm = newDict()
+	} else {
+		acroForm, err = d.resolveDict(catalog.Get("AcroForm"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fields, err := d.resolve(acroForm.Get("Fields"))
+	if err != nil {
+		return nil, err
+	}
+	fieldArray, _ := fields.(Array)
+
+	fieldName := d.fieldName(fieldArray)
+
+	acroForm.Set("Fields", append(append(Array{}, fieldArray...), fieldRef))
+	acroForm.Set("SigFlags", Raw("3"))
+
+	annots, err := d.resolve(page.Get("Annots"))
+	if err != nil {
+		return nil, err
+	}
+	annotArray, _ := annots.(Array)
+	page.Set("Annots", append(append(Array{}, annotArray...), fieldRef))
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)+2*size+4096))
+	buf.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+
+	var updates []update
+
+	// signature dictionary, the contents are written in place once
+	// the byte range is known
+	updates = append(updates, update{ref: sigRef, offset: buf.Len()})
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /%s /ByteRange [", sigRef.Num, SubFilterCAdES)
+	byteRangeOffset := buf.Len()
+	buf.WriteString(strings.Repeat(" ", byteRangeWidth) + "] /Contents ")
+	contentsStart := buf.Len()
+	buf.WriteString("<" + strings.Repeat("0", 2*size) + ">")
+	contentsEnd := buf.Len()
+
+	buf.WriteString(" /M ")
+	writeObject(buf, dateString(info.Time))
+
+	for _, entry := range []struct {
+		key   string
+		value string
+	}{
+		{"Name", info.Name},
+		{"Reason", info.Reason},
+		{"Location", info.Location},
+		{"ContactInfo", info.ContactInfo},
+	} {
+		if entry.value != "" {
+			buf.WriteString(" /" + entry.key + " ")
+			writeObject(buf, textString(entry.value))
+		}
+	}
+	buf.WriteString(" >>\nendobj\n")
+
+	// invisible widget annotation merged with its field
+	field := newDict()
+	field.Set("Type", Name("Annot"))
+	field.Set("Subtype", Name("Widget"))
+	field.Set("FT", Name("Sig"))
+	field.Set("T", textString(fieldName))
+	field.Set("V", sigRef)
+	field.Set("F", Raw("132"))
+	field.Set("Rect", Array{Raw("0"), Raw("0"), Raw("0"), Raw("0")})
+	field.Set("P", pageRef)
+
+	updates = append(updates, writeIndirect(buf, fieldRef, field))
+	updates = append(updates, writeIndirect(buf, pageRef, page))
+
+	if isRef {
+		updates = append(updates, writeIndirect(buf, acroFormRef, acroForm))
+	} else {
+		catalog.Set("AcroForm", acroForm)
+		updates = append(updates, writeIndirect(buf, rootRef, catalog))
+	}
+
+	err = d.writeXref(buf, updates, next)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Prepared{
+		document:  buf.Bytes(),
+		byteRange: [4]int{0, contentsStart, contentsEnd, buf.Len() - contentsEnd},
+	}
+
+	byteRange := fmt.Sprintf("%d %d %d %d", res.byteRange[0], res.byteRange[1], res.byteRange[2], res.byteRange[3])
+	if len(byteRange) > byteRangeWidth {
+		return nil, errors.New("pdf: document too large")
+	}
+	copy(res.document[byteRangeOffset:], byteRange)
+
+	return res, nil
+}
+
+// fieldName returns the first signature field name not used by fields.
+func (d *document) fieldName(fields Array) string {
+	used := map[string]bool{}
+	for _, ref := range fields {
+		field, err := d.resolveDict(ref)
+		if err != nil {
+			continue
+		}
+		used[text(field.Get("T"))] = true
+	}
+
+	for i := len(fields) + 1; ; i++ {
+		name := "Signature" + strconv.Itoa(i)
+		if !used[name] {
+			return name
+		}
+	}
+}
+
+func writeIndirect(buf *bytes.Buffer, ref Ref, obj Object) update {
+	res := update{ref: ref, offset: buf.Len()}
+
+	fmt.Fprintf(buf, "%d %d obj\n", ref.Num, ref.Gen)
+	writeObject(buf, obj)
+	buf.WriteString("\nendobj\n")
+
+	return res
+}
+
+// writeXref writes the cross-reference section of updates and the
+// trailer, as a stream when the document uses cross-reference streams.
+func (d *document) writeXref(buf *bytes.Buffer, updates []update, size int) error {
+	trailer := newDict()
+	for _, key := range []Name{"Root", "Info", "ID"} {
+		if value := d.trailer.Get(key); value != nil {
+			trailer.Set(key, value)
+		}
+	}
+	trailer.Set("Prev", Raw(strconv.Itoa(d.startxref)))
+
+	if !d.xrefStream {
+		sort.Slice(updates, func(i, j int) bool { return updates[i].ref.Num < updates[j].ref.Num })
+
+		startxref := buf.Len()
+		buf.WriteString("xref\n")
+		for _, section := range subsections(updates) {
+			fmt.Fprintf(buf, "%d %d\n", section[0].ref.Num, len(section))
+			for _, u := range section {
+				fmt.Fprintf(buf, "%010d %05d n\r\n", u.offset, u.ref.Gen)
+			}
+		}
+
+		trailer.Set("Size", Raw(strconv.Itoa(size)))
+		buf.WriteString("trailer\n")
+		writeObject(buf, trailer)
+		fmt.Fprintf(buf, "\nstartxref\n%d\n%%%%EOF\n", startxref)
+
+		return nil
+	}
+
+	// the stream holds its own entry
+	xrefRef := Ref{Num: size}
+	startxref := buf.Len()
+	updates = append(updates, update{ref: xrefRef, offset: startxref})
+	sort.Slice(updates, func(i, j int) bool { return updates[i].ref.Num < updates[j].ref.Num })
+
+	offsetWidth := 4
+	if startxref > 1<<32-1 {
+		offsetWidth = 8
+	}
+
+	var entries bytes.Buffer
+	index := Array{}
+	for _, section := range subsections(updates) {
+		index = append(index, Raw(strconv.Itoa(section[0].ref.Num)), Raw(strconv.Itoa(len(section))))
+
+		for _, u := range section {
+			offset := make([]byte, 8)
+			binary.BigEndian.PutUint64(offset, uint64(u.offset))
+
+			entries.WriteByte(1)
+			entries.Write(offset[8-offsetWidth:])
+			entries.Write([]byte{byte(u.ref.Gen >> 8), byte(u.ref.Gen)})
+		}
+	}
+
+	trailer.Set("Type", Name("XRef"))
+	trailer.Set("Size", Raw(strconv.Itoa(size+1)))
+	trailer.Set("Index", index)
+	trailer.Set("W", Array{Raw("1"), Raw(strconv.Itoa(offsetWidth)), Raw("2")})
+	trailer.Set("Length", Raw(strconv.Itoa(entries.Len())))
+
+	fmt.Fprintf(buf, "%d 0 obj\n", xrefRef.Num)
+	writeObject(buf, trailer)
+	buf.WriteString("\nstream\n")
+	buf.Write(entries.Bytes())
+	fmt.Fprintf(buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", startxref)
+
+	return nil
+}
+
+// subsections groups sorted updates of consecutive object numbers.
+func subsections(updates []update) [][]update {
+	var res [][]update
+
+	for i, u := range updates {
+		if i > 0 && u.ref.Num == updates[i-1].ref.Num+1 {
+			res[len(res)-1] = append(res[len(res)-1], u)
+			continue
+		}
+		res = append(res, []update{u})
+	}
+
+	return res
+}
+
+// SignedContent returns the bytes covered by the signature.
+func (p *Prepared) SignedContent() []byte {
+	return signedContent(p.document, p.byteRange)
+}
+
+// Embed writes the DER encoded signature in the reserved space
+// and returns the signed document.
+func (p *Prepared) Embed(signature []byte) ([]byte, error) {
+	encoded := strings.ToUpper(hex.EncodeToString(signature))
+	if len(encoded) > p.byteRange[2]-p.byteRange[1]-2 {
+		return nil, ErrSignatureTooLarge
+	}
+
+	res := append([]byte{}, p.document...)
+	copy(res[p.byteRange[1]+1:], encoded)
+
+	return res, nil
+}
+
+func signedContent(data []byte, byteRange [4]int) []byte {
+	res := make([]byte, 0, byteRange[1]+byteRange[3])
+	res = append(res, data[byteRange[0]:byteRange[0]+byteRange[1]]...)
+	res = append(res, data[byteRange[2]:byteRange[2]+byteRange[3]]...)
+
+	return res
+}
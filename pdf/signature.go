@@ -0,0 +1,147 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+// Signature is a signature found in a document.
+type Signature struct {
+	// ByteRange holds the offset and length of the two
+	// parts of the document covered by the signature.
+	ByteRange [4]int
+
+	// Contents is the DER encoded signature without its padding.
+	Contents  []byte
+	SubFilter Name
+
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	Time        time.Time
+}
+
+// SignedContent returns the bytes of data covered by the signature.
+func (s Signature) SignedContent(data []byte) []byte {
+	return signedContent(data, s.ByteRange)
+}
+
+// CoversDocument reports whether the signature covers data up to its
+// end, false when data was updated after it was signed.
+func (s Signature) CoversDocument(data []byte) bool {
+	return s.ByteRange[2]+s.ByteRange[3] == len(data)
+}
+
+// Signatures returns the signatures of data ordered by the end
+// of their byte range, the last one signed the latest revision.
+func Signatures(data []byte) []Signature {
+	var res []Signature
+	seen := map[[4]int]bool{}
+
+	for offset := 0; ; {
+		idx := bytes.Index(data[offset:], []byte("/ByteRange"))
+		if idx < 0 {
+			break
+		}
+		idx += offset
+		offset = idx + len("/ByteRange")
+
+		sig, ok := parseSignature(data, idx)
+		if !ok || seen[sig.ByteRange] {
+			continue
+		}
+		seen[sig.ByteRange] = true
+
+		res = append(res, sig)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ByteRange[2]+res[i].ByteRange[3] < res[j].ByteRange[2]+res[j].ByteRange[3]
+	})
+
+	return res
+}
+
+// parseSignature reads the signature dictionary holding the byte
+// range at offset. The gap between the two ranges must be exactly
+// the hex string of the signature.
+func parseSignature(data []byte, offset int) (Signature, bool) {
+	p := &parser{data: data, pos: offset + len("/ByteRange")}
+
+	obj, err := p.object()
+	if err != nil {
+		return Signature{}, false
+	}
+
+	array, ok := obj.(Array)
+	if !ok || len(array) != 4 {
+		return Signature{}, false
+	}
+
+	var sig Signature
+	for i := range array {
+		sig.ByteRange[i], ok = intValue(array[i])
+		if !ok || sig.ByteRange[i] < 0 {
+			return Signature{}, false
+		}
+	}
+
+	br := sig.ByteRange
+	if br[0] != 0 || br[1] < 1 || br[2] <= br[1]+1 || br[2]+br[3] > len(data) {
+		return Signature{}, false
+	}
+
+	// the byte range itself must be signed
+	if offset >= br[1] && offset < br[2] {
+		return Signature{}, false
+	}
+
+	gap := data[br[1]:br[2]]
+	if gap[0] != '<' || gap[len(gap)-1] != '>' {
+		return Signature{}, false
+	}
+
+	contents, err := hex.DecodeString(string(gap[1 : len(gap)-1]))
+	if err != nil {
+		return Signature{}, false
+	}
+
+	// trim the zero padding after the DER value
+	var value asn1.RawValue
+	_, err = asn1.Unmarshal(contents, &value)
+	if err != nil {
+		return Signature{}, false
+	}
+	sig.Contents = value.FullBytes
+
+	// the entries of the dictionary are optional, the object
+	// holding it is searched backwards from the byte range
+	start := bytes.LastIndex(data[:offset], []byte("obj"))
+	if start < 0 {
+		return sig, true
+	}
+
+	p = &parser{data: data, pos: start + len("obj")}
+	obj, err = p.object()
+	if err != nil {
+		return sig, true
+	}
+
+	dict, ok := obj.(*Dict)
+	if !ok {
+		return sig, true
+	}
+
+	sig.SubFilter, _ = dict.Get("SubFilter").(Name)
+	sig.Name = text(dict.Get("Name"))
+	sig.Reason = text(dict.Get("Reason"))
+	sig.Location = text(dict.Get("Location"))
+	sig.ContactInfo = text(dict.Get("ContactInfo"))
+	sig.Time = parseDate(text(dict.Get("M")))
+
+	return sig, true
+}
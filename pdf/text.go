@@ -0,0 +1,171 @@
+package pdf
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// textString encodes s as a literal string when it is printable
+// ASCII, as a UTF-16 hex string otherwise.
+func textString(s string) Raw {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+		return Raw("(" + r.Replace(s) + ")")
+	}
+
+	encoded := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		encoded = append(encoded, byte(u>>8), byte(u))
+	}
+
+	return Raw("<" + strings.ToUpper(hex.EncodeToString(encoded)) + ">")
+}
+
+// text decodes a literal or hex string object, empty when obj is
+// not a string.
+func text(obj Object) string {
+	raw, ok := obj.(Raw)
+	if !ok || len(raw) < 2 {
+		return ""
+	}
+
+	var b []byte
+
+	switch {
+	case raw[0] == '(' && raw[len(raw)-1] == ')':
+		b = unescape(string(raw[1 : len(raw)-1]))
+	case raw[0] == '<' && raw[len(raw)-1] == '>':
+		digits := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(" \t\r\n\f", r) {
+				return -1
+			}
+			return r
+		}, string(raw[1:len(raw)-1]))
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+
+		var err error
+		b, err = hex.DecodeString(digits)
+		if err != nil {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		units := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(units))
+	}
+
+	// PDFDocEncoding matches Latin-1 for printable characters
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// unescape decodes the escape sequences of a literal string.
+func unescape(s string) []byte {
+	var res []byte
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			res = append(res, c)
+			continue
+		}
+
+		i++
+		switch c = s[i]; c {
+		case 'n':
+			res = append(res, '\n')
+		case 'r':
+			res = append(res, '\r')
+		case 't':
+			res = append(res, '\t')
+		case 'b':
+			res = append(res, '\b')
+		case 'f':
+			res = append(res, '\f')
+		case '\r':
+			// line continuation
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if c < '0' || c > '7' {
+				res = append(res, c)
+				continue
+			}
+
+			// up to three octal digits
+			n := 0
+			for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+				n = n*8 + int(s[i]-'0')
+				i++
+			}
+			i--
+			res = append(res, byte(n))
+		}
+	}
+
+	return res
+}
+
+// dateString encodes t as a PDF date.
+func dateString(t time.Time) Raw {
+	return Raw(t.UTC().Format("(D:20060102150405") + "+00'00')")
+}
+
+// parseDate decodes a PDF date, the zero time when it is invalid.
+func parseDate(s string) time.Time {
+	s = strings.TrimPrefix(s, "D:")
+
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 {
+		return time.Time{}
+	}
+
+	// missing fields default to the start of the period
+	value := s[:digits] + "0101000000"[digits-4:]
+	offset := strings.ReplaceAll(s[digits:], "'", "")
+
+	layout := "20060102150405"
+	switch {
+	case offset == "" || strings.HasPrefix(offset, "Z"):
+		offset = ""
+	case len(offset) == 5:
+		layout += "-0700"
+	case len(offset) == 3:
+		layout += "-07"
+	default:
+		return time.Time{}
+	}
+
+	t, err := time.Parse(layout, value+offset)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encryption/helper"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 )
 
@@ -11,7 +13,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Share-Passphrase")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, HEAD, PATCH, OPTIONS, GET, PUT, DELETE")
 
 		if r.Method == "OPTIONS" {
@@ -56,3 +58,25 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// AdminMiddleware allows the users whose id is listed in the comma
+// separated ADMIN_USER_IDS. It is chained after AuthMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(float64)
+		if !ok {
+			http.Error(w, "Token is required", http.StatusBadRequest)
+			return
+		}
+
+		for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+			adminID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 64)
+			if err == nil && adminID == uint64(userID) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
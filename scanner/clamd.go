@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	// chunkSize is the size of the chunks streamed
+	// to clamd, lower than its default StreamMaxLength.
+	chunkSize = 64 << 10
+)
+
+var (
+	ErrUnavailable = errors.New("scanner is unavailable")
+	ErrScanFailed  = errors.New("scan failed")
+)
+
+// Result is the verdict of a scan.
+type Result struct {
+	Infected bool `json:"infected"`
+
+	// Signature is the name of the detected
+	// malware when Infected is true.
+	Signature string `json:"signature,omitempty"`
+}
+
+// ClamdScanner scans contents by streaming them to a clamd
+// compatible daemon with the INSTREAM command.
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner connecting to address on
+// network, which is either "tcp" or "unix".
+func NewClamdScanner(network string, address string, timeout time.Duration) *ClamdScanner {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &ClamdScanner{
+		network: network,
+		address: address,
+		timeout: timeout,
+	}
+}
+
+// NewClamdScannerFromEnv creates a scanner from the CLAMD_NETWORK,
+// CLAMD_ADDRESS and CLAMD_TIMEOUT environment variables. It returns
+// nil when CLAMD_ADDRESS is not set.
+func NewClamdScannerFromEnv() *ClamdScanner {
+	address := os.Getenv("CLAMD_ADDRESS")
+	if address == "" {
+		return nil
+	}
+
+	network := os.Getenv("CLAMD_NETWORK")
+	if network == "" {
+		network = "tcp"
+	}
+
+	timeout, err := time.ParseDuration(os.Getenv("CLAMD_TIMEOUT"))
+	if err != nil {
+		timeout = defaultTimeout
+	}
+
+	return NewClamdScanner(network, address, timeout)
+}
+
+// Scan streams the content of r to clamd and returns its verdict.
+// Connection errors are wrapped in ErrUnavailable and error replies
+// from the daemon in ErrScanFailed.
+func (c *ClamdScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	// each chunk is prefixed by its length as an unsigned
+	// 32-bit big endian integer, a zero length ends the stream
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+
+			_, err = conn.Write(buf[:4+n])
+			if err != nil {
+				// clamd closes the connection when the
+				// stream exceeds its size limit
+				reply, replyErr := readReply(conn)
+				if replyErr == nil {
+					return Result{}, fmt.Errorf("%w: %v", ErrScanFailed, reply)
+				}
+				return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, readErr
+		}
+	}
+
+	_, err = conn.Write([]byte{0, 0, 0, 0})
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	return parseReply(reply)
+}
+
+// readReply reads a null terminated reply.
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseReply parses replies such as "stream: OK" and
+// "stream: Win.Test.EICAR_HDB-1 FOUND".
+func parseReply(reply string) (Result, error) {
+	_, verdict, found := strings.Cut(reply, ": ")
+	if !found {
+		return Result{}, fmt.Errorf("%w: %v", ErrScanFailed, reply)
+	}
+
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{
+			Infected:  true,
+			Signature: strings.TrimSuffix(verdict, " FOUND"),
+		}, nil
+	}
+
+	return Result{}, fmt.Errorf("%w: %v", ErrScanFailed, verdict)
+}
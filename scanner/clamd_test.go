@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd is a stand-in clamd daemon answering INSTREAM commands,
+// flagging streams containing the EICAR test string.
+func fakeClamd(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				command, err := reader.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+
+				var stream bytes.Buffer
+				for {
+					var size uint32
+					err := binary.Read(reader, binary.BigEndian, &size)
+					if err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					io.CopyN(&stream, reader, int64(size))
+				}
+
+				if strings.Contains(stream.String(), eicar) {
+					conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestClamdScannerScan(t *testing.T) {
+	scanner := NewClamdScanner("tcp", fakeClamd(t), time.Second)
+
+	res, err := scanner.Scan(context.Background(), strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Infected {
+		t.Error("clean content reported as infected")
+	}
+
+	// spread the test string over two chunks
+	content := strings.Repeat("a", chunkSize-10) + eicar
+	res, err = scanner.Scan(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Infected || res.Signature != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("Scan() = %+v, want infected with Win.Test.EICAR_HDB-1", res)
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	scanner := NewClamdScanner("tcp", address, time.Second)
+
+	_, err = scanner.Scan(context.Background(), strings.NewReader("hello world"))
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Scan() error = %v, want %v", err, ErrUnavailable)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	_, err := parseReply("INSTREAM size limit exceeded. ERROR")
+	if !errors.Is(err, ErrScanFailed) {
+		t.Errorf("parseReply() error = %v, want %v", err, ErrScanFailed)
+	}
+}
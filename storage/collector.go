@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"context"
+	"encryption/guard"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultGracePeriod is the minimum age of an orphan before it is
+// deleted, leaving time to uploads in progress to reference their
+// blob and key.
+const DefaultGracePeriod = 24 * time.Hour
+
+// keyTables are the guard key tables checked for orphans.
+var keyTables = []string{"keys", "permission_keys", "user_keys"}
+
+// GracePeriodFromEnv returns the GC_GRACE_PERIOD duration,
+// defaulting to DefaultGracePeriod.
+func GracePeriodFromEnv() time.Duration {
+	gracePeriod, err := time.ParseDuration(os.Getenv("GC_GRACE_PERIOD"))
+	if err != nil || gracePeriod < 0 {
+		return DefaultGracePeriod
+	}
+
+	return gracePeriod
+}
+
+// BlobReference is a blob path referenced by a database row.
+type BlobReference struct {
+	Path string `json:"path"`
+
+	// Source is the referencing row as "table:id".
+	Source string `json:"source"`
+}
+
+// KeyReference is a key metadata referenced by a database row.
+type KeyReference struct {
+	Table    string `json:"table"`
+	Metadata []byte `json:"-"`
+	Source   string `json:"source"`
+}
+
+// Blob is a file of the storage directory.
+type Blob struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	// Expired is true when the blob is older than the
+	// grace period and can be deleted.
+	Expired bool `json:"expired"`
+}
+
+// Key is a stored key of a guard key table.
+type Key struct {
+	Table     string    `json:"table"`
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Expired   bool      `json:"expired"`
+}
+
+// DanglingReference is a reference to a
+// blob or a key that does not exist.
+type DanglingReference struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// Report is the result of a reconciliation.
+type Report struct {
+	// Orphans are stored blobs and keys that are not
+	// referenced by any row of the main database.
+	OrphanBlobs []Blob `json:"orphan_blobs"`
+	OrphanKeys  []Key  `json:"orphan_keys"`
+
+	// Dangling references are rows referencing missing blobs or
+	// keys. They are only reported since the rows hold user data.
+	DanglingReferences []DanglingReference `json:"dangling_references"`
+
+	DeletedBlobs int `json:"deleted_blobs"`
+	DeletedKeys  int `json:"deleted_keys"`
+}
+
+type ReferenceRepository interface {
+	ListBlobReferences(ctx context.Context) ([]BlobReference, error)
+	ListKeyReferences(ctx context.Context) ([]KeyReference, error)
+}
+
+type Guard interface {
+	KeyID(metadata []byte) (uint64, error)
+	ListKeys(ctx context.Context, table string) ([]guard.KeyInfo, error)
+	DeleteKeyID(ctx context.Context, table string, id uint64) error
+}
+
+// Collector cross-references the storage directory and the key
+// tables with the main database to find and delete orphans.
+type Collector struct {
+	referenceRepository ReferenceRepository
+	guard               Guard
+	root                string
+	gracePeriod         time.Duration
+}
+
+// NewCollector creates a collector of the blobs under root, the
+// directory the blob paths of the database are relative to.
+func NewCollector(
+	rr ReferenceRepository,
+	g Guard,
+	root string,
+	gracePeriod time.Duration,
+) *Collector {
+	return &Collector{
+		referenceRepository: rr,
+		guard:               g,
+		root:                root,
+		gracePeriod:         gracePeriod,
+	}
+}
+
+// Scan reports the orphans and dangling references without
+// deleting anything.
+func (c *Collector) Scan(ctx context.Context) (*Report, error) {
+	report := Report{
+		OrphanBlobs:        []Blob{},
+		OrphanKeys:         []Key{},
+		DanglingReferences: []DanglingReference{},
+	}
+
+	// keys are listed before the references so that keys stored
+	// by an upload completing during the scan are not orphans
+	storedKeys := make(map[string][]guard.KeyInfo)
+	for _, table := range keyTables {
+		keys, err := c.guard.ListKeys(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		storedKeys[table] = keys
+	}
+
+	blobs, err := c.listBlobs()
+	if err != nil {
+		return nil, err
+	}
+
+	blobReferences, err := c.referenceRepository.ListBlobReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyReferences, err := c.referenceRepository.ListKeyReferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(-c.gracePeriod)
+
+	// blobs
+	referencedBlobs := make(map[string]bool)
+	for _, reference := range blobReferences {
+		referencedBlobs[reference.Path] = true
+
+		if _, ok := blobs[reference.Path]; !ok {
+			report.DanglingReferences = append(report.DanglingReferences, DanglingReference{
+				Source: reference.Source,
+				Target: reference.Path,
+				Reason: "blob does not exist",
+			})
+		}
+	}
+
+	for path, blob := range blobs {
+		if referencedBlobs[path] {
+			continue
+		}
+
+		blob.Expired = blob.ModTime.Before(deadline)
+		report.OrphanBlobs = append(report.OrphanBlobs, blob)
+	}
+
+	// keys, mapped to the source of their reference
+	referencedKeys := make(map[string]map[uint64]string)
+	for _, table := range keyTables {
+		referencedKeys[table] = make(map[uint64]string)
+	}
+
+	for _, reference := range keyReferences {
+		id, err := c.guard.KeyID(reference.Metadata)
+		if err != nil {
+			report.DanglingReferences = append(report.DanglingReferences, DanglingReference{
+				Source: reference.Source,
+				Target: reference.Table,
+				Reason: "invalid key metadata",
+			})
+			continue
+		}
+
+		referencedKeys[reference.Table][id] = reference.Source
+	}
+
+	for _, table := range keyTables {
+		var lastID uint64
+		stored := make(map[uint64]bool)
+
+		for _, key := range storedKeys[table] {
+			stored[key.ID] = true
+			lastID = max(lastID, key.ID)
+
+			if _, ok := referencedKeys[table][key.ID]; ok {
+				continue
+			}
+
+			report.OrphanKeys = append(report.OrphanKeys, Key{
+				Table:     table,
+				ID:        key.ID,
+				CreatedAt: key.CreatedAt,
+				Expired:   key.CreatedAt.Before(deadline),
+			})
+		}
+
+		for id, source := range referencedKeys[table] {
+			// keys stored after the listing are not dangling
+			if stored[id] || id > lastID {
+				continue
+			}
+
+			report.DanglingReferences = append(report.DanglingReferences, DanglingReference{
+				Source: source,
+				Target: fmt.Sprintf("%v:%v", table, id),
+				Reason: "key does not exist",
+			})
+		}
+	}
+
+	sort.Slice(report.OrphanBlobs, func(i, j int) bool {
+		return report.OrphanBlobs[i].Path < report.OrphanBlobs[j].Path
+	})
+	sort.Slice(report.DanglingReferences, func(i, j int) bool {
+		return report.DanglingReferences[i].Source < report.DanglingReferences[j].Source
+	})
+
+	return &report, nil
+}
+
+// Collect scans for orphans and deletes the ones
+// older than the grace period.
+func (c *Collector) Collect(ctx context.Context) (*Report, error) {
+	report, err := c.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, blob := range report.OrphanBlobs {
+		if !blob.Expired {
+			continue
+		}
+
+		err = os.Remove(filepath.FromSlash(blob.Path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, err
+		}
+		report.DeletedBlobs++
+	}
+
+	for _, key := range report.OrphanKeys {
+		if !key.Expired {
+			continue
+		}
+
+		err = c.guard.DeleteKeyID(ctx, key.Table, key.ID)
+		if err != nil {
+			return report, err
+		}
+		report.DeletedKeys++
+	}
+
+	return report, nil
+}
+
+// Run calls Collect every interval until ctx is done.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Collect(ctx)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			fmt.Printf(
+				"storage gc: %v orphan blobs, %v orphan keys, %v dangling references, deleted %v blobs and %v keys\n",
+				len(report.OrphanBlobs),
+				len(report.OrphanKeys),
+				len(report.DanglingReferences),
+				report.DeletedBlobs,
+				report.DeletedKeys,
+			)
+		}
+	}
+}
+
+// listBlobs lists the regular files under the root directory
+// by their slash separated path, as stored in the database.
+func (c *Collector) listBlobs() (map[string]Blob, error) {
+	blobs := make(map[string]Blob)
+
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		path = filepath.ToSlash(path)
+		blobs[path] = Blob{
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return blobs, nil
+}
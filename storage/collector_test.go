@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encryption/guard"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeReferences struct {
+	blobs []BlobReference
+	keys  []KeyReference
+}
+
+func (f *fakeReferences) ListBlobReferences(ctx context.Context) ([]BlobReference, error) {
+	return f.blobs, nil
+}
+
+func (f *fakeReferences) ListKeyReferences(ctx context.Context) ([]KeyReference, error) {
+	return f.keys, nil
+}
+
+// fakeGuard uses the key id in big endian as metadata.
+type fakeGuard struct {
+	keys    map[string][]guard.KeyInfo
+	deleted []uint64
+}
+
+func (f *fakeGuard) KeyID(metadata []byte) (uint64, error) {
+	if len(metadata) != 8 {
+		return 0, errors.New("invalid key metadata")
+	}
+	return binary.BigEndian.Uint64(metadata), nil
+}
+
+func (f *fakeGuard) ListKeys(ctx context.Context, table string) ([]guard.KeyInfo, error) {
+	return f.keys[table], nil
+}
+
+func (f *fakeGuard) DeleteKeyID(ctx context.Context, table string, id uint64) error {
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func metadata(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+func writeBlob(t *testing.T, path string, modTime time.Time) {
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte("blob"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorCollect(t *testing.T) {
+	root := filepath.ToSlash(t.TempDir())
+	old := time.Now().Add(-48 * time.Hour)
+
+	writeBlob(t, root+"/referenced", old)
+	writeBlob(t, root+"/orphan", old)
+	writeBlob(t, root+"/uploading", time.Now())
+	writeBlob(t, root+"/1_2/user.json", old)
+
+	references := &fakeReferences{
+		blobs: []BlobReference{
+			{Path: root + "/referenced", Source: "files:1"},
+			{Path: root + "/1_2/user.json", Source: "permissions:1"},
+			{Path: root + "/missing", Source: "files:2"},
+		},
+		keys: []KeyReference{
+			{Table: "keys", Metadata: metadata(1), Source: "files:1"},
+			{Table: "keys", Metadata: metadata(2), Source: "files:2"},
+			{Table: "keys", Metadata: metadata(9), Source: "files:3"},
+		},
+	}
+	g := &fakeGuard{
+		keys: map[string][]guard.KeyInfo{
+			"keys": {
+				{ID: 1, CreatedAt: old},
+				{ID: 3, CreatedAt: old},
+				{ID: 4, CreatedAt: time.Now()},
+			},
+		},
+	}
+
+	report, err := NewCollector(references, g, root, 24*time.Hour).Collect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.OrphanBlobs) != 2 || report.DeletedBlobs != 1 {
+		t.Errorf("orphan blobs = %+v, deleted %v, want 2 orphans and 1 deleted", report.OrphanBlobs, report.DeletedBlobs)
+	}
+	if _, err := os.Stat(root + "/orphan"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expired orphan blob was not deleted")
+	}
+	if _, err := os.Stat(root + "/uploading"); err != nil {
+		t.Error("orphan blob in grace period was deleted")
+	}
+
+	if len(report.OrphanKeys) != 2 || len(g.deleted) != 1 || g.deleted[0] != 3 {
+		t.Errorf("orphan keys = %+v, deleted %v, want 2 orphans and key 3 deleted", report.OrphanKeys, g.deleted)
+	}
+
+	// missing blob and key 2, key 9 is newer than the listed keys
+	if len(report.DanglingReferences) != 2 {
+		t.Errorf("dangling references = %+v, want 2", report.DanglingReferences)
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"encryption/helper"
+	"errors"
+	"net/http"
+)
+
+type Handler struct {
+	scrubber *Scrubber
+}
+
+func NewStorageHandler(s *Scrubber) Handler {
+	return Handler{
+		scrubber: s,
+	}
+}
+
+// ScrubStatus is the response of the scrub status endpoint.
+type ScrubStatus struct {
+	LastReport *ScrubReport `json:"last_report"`
+	Damaged    []StoredBlob `json:"damaged"`
+}
+
+// GetScrubStatus returns the last scrub report and
+// the blobs currently marked as damaged.
+func (h *Handler) GetScrubStatus(w http.ResponseWriter, r *http.Request) {
+	damaged, err := h.scrubber.ListDamaged(r.Context())
+	if err != nil {
+		helper.WriteResponse(w, http.StatusInternalServerError, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data: ScrubStatus{
+			LastReport: h.scrubber.LastReport(),
+			Damaged:    damaged,
+		},
+	})
+}
+
+// RunScrub runs a scrub and returns its report.
+func (h *Handler) RunScrub(w http.ResponseWriter, r *http.Request) {
+	report, err := h.scrubber.Scrub(r.Context())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrScrubRunning) {
+			status = http.StatusConflict
+		}
+
+		helper.WriteResponse(w, status, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    report,
+	})
+}
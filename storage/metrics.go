@@ -0,0 +1,14 @@
+package storage
+
+import "expvar"
+
+// Scrubber metrics, published to admins on /admin/metrics.
+var (
+	scrubRuns         = expvar.NewInt("storage_scrub_runs")
+	scrubBlobsChecked = expvar.NewInt("storage_scrub_blobs_checked")
+	scrubMismatches   = expvar.NewInt("storage_scrub_checksum_mismatches")
+	scrubMissing      = expvar.NewInt("storage_scrub_blobs_missing")
+	scrubDamagedBlobs = expvar.NewInt("storage_scrub_damaged_blobs")
+	scrubLastRun      = expvar.NewString("storage_scrub_last_run")
+	scrubErrors       = expvar.NewInt("storage_scrub_errors")
+)
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DB interface {
+	GetConn() *pgxpool.Pool
+}
+
+type referenceRepository struct {
+	db DB
+}
+
+func NewReferenceRepository(db DB) *referenceRepository {
+	return &referenceRepository{
+		db: db,
+	}
+}
+
+// ListBlobReferences lists the blob paths referenced by the main
+// database. Profile copies are referenced by their permission.
+func (rr *referenceRepository) ListBlobReferences(ctx context.Context) ([]BlobReference, error) {
+	var references []BlobReference
+
+	stmt := `
+		SELECT filepath, 'files:' || id FROM files
+		UNION ALL
+		SELECT thumbnail_path, 'files:' || id FROM files
+			WHERE thumbnail_path IS NOT NULL
+		UNION ALL
+		SELECT filepath, 'file_versions:' || id FROM file_versions
+		UNION ALL
+		SELECT thumbnail_path, 'file_versions:' || id FROM file_versions
+			WHERE thumbnail_path IS NOT NULL
+		UNION ALL
+		SELECT signature_path, 'file_versions:' || id FROM file_versions
+			WHERE signature_path IS NOT NULL
+		UNION ALL
+		SELECT filepath, 'file_permissions:' || id FROM file_permissions
+			WHERE filepath <> ''
+		UNION ALL
+		SELECT
+			'files/' || source_user_id || '_' || target_user_id || '/user.json',
+			'permissions:' || id
+		FROM permissions
+	`
+
+	rows, err := rr.db.GetConn().Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r BlobReference
+		err := rows.Scan(
+			&r.Path,
+			&r.Source,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		references = append(references, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return references, nil
+}
+
+// ListKeyReferences lists the key metadata referenced
+// by the main database along with their key table.
+func (rr *referenceRepository) ListKeyReferences(ctx context.Context) ([]KeyReference, error) {
+	var references []KeyReference
+
+	stmt := `
+		SELECT 'keys', key_reference, 'files:' || id FROM files
+		UNION ALL
+		SELECT 'keys', key_reference, 'file_versions:' || id FROM file_versions
+		UNION ALL
+		SELECT 'permission_keys', key_reference, 'permissions:' || id FROM permissions
+			WHERE key_reference IS NOT NULL
+		UNION ALL
+		SELECT 'user_keys', key_reference, 'users:' || id FROM users
+		UNION ALL
+		SELECT 'keys', key_reference, 'certificate_authority:' || id FROM certificate_authority
+	`
+
+	rows, err := rr.db.GetConn().Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r KeyReference
+		err := rows.Scan(
+			&r.Table,
+			&r.Metadata,
+			&r.Source,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		references = append(references, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return references, nil
+}
+
+// ListStoredBlobs lists the file version blobs and the
+// shared copies along with their checksum.
+func (rr *referenceRepository) ListStoredBlobs(ctx context.Context) ([]StoredBlob, error) {
+	return rr.listStoredBlobs(ctx, false)
+}
+
+// ListDamaged lists the blobs marked as damaged.
+func (rr *referenceRepository) ListDamaged(ctx context.Context) ([]StoredBlob, error) {
+	return rr.listStoredBlobs(ctx, true)
+}
+
+func (rr *referenceRepository) listStoredBlobs(ctx context.Context, damagedOnly bool) ([]StoredBlob, error) {
+	var blobs []StoredBlob
+
+	stmt := `
+		SELECT * FROM (
+			SELECT 'file_versions', id, file_id, filepath, checksum, damaged
+			FROM file_versions
+			UNION ALL
+			SELECT 'file_permissions', id, file_id, filepath, checksum, damaged
+			FROM file_permissions
+			WHERE filepath <> ''
+		) blobs
+		WHERE NOT $1 OR damaged
+		ORDER BY 1, 2
+	`
+
+	rows, err := rr.db.GetConn().Query(ctx, stmt, damagedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b StoredBlob
+		err := rows.Scan(
+			&b.Table,
+			&b.ID,
+			&b.FileID,
+			&b.Path,
+			&b.Checksum,
+			&b.Damaged,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		blobs = append(blobs, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blobs, nil
+}
+
+// SetChecksum stores the checksum of a blob. The checksum of a
+// version is also stored on its file when it is the current one.
+func (rr *referenceRepository) SetChecksum(ctx context.Context, blob StoredBlob, checksum []byte) error {
+	var stmt string
+
+	switch blob.Table {
+	case "file_versions":
+		stmt = `
+		WITH v AS (
+			UPDATE file_versions SET checksum = $2
+			WHERE id = $1
+			RETURNING file_id, version
+		)
+		UPDATE files f SET checksum = $2
+		FROM v
+		WHERE f.id = v.file_id AND f.version = v.version
+		`
+	case "file_permissions":
+		stmt = `UPDATE file_permissions SET checksum = $2 WHERE id = $1`
+	default:
+		return fmt.Errorf("unknown blob table %v", blob.Table)
+	}
+
+	_, err := rr.db.GetConn().Exec(ctx, stmt, blob.ID, checksum)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetDamaged sets the damaged flag of a blob. The flag of a
+// version is also set on its file when it is the current one.
+func (rr *referenceRepository) SetDamaged(ctx context.Context, blob StoredBlob, damaged bool) error {
+	var stmt string
+
+	switch blob.Table {
+	case "file_versions":
+		stmt = `
+		WITH v AS (
+			UPDATE file_versions SET damaged = $2
+			WHERE id = $1
+			RETURNING file_id, version
+		)
+		UPDATE files f SET damaged = $2
+		FROM v
+		WHERE f.id = v.file_id AND f.version = v.version
+		`
+	case "file_permissions":
+		stmt = `UPDATE file_permissions SET damaged = $2 WHERE id = $1`
+	default:
+		return fmt.Errorf("unknown blob table %v", blob.Table)
+	}
+
+	_, err := rr.db.GetConn().Exec(ctx, stmt, blob.ID, damaged)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var ErrScrubRunning = errors.New("scrub is already running")
+
+// StoredBlob is an encrypted blob referenced by a file
+// version or by a shared copy of a file.
+type StoredBlob struct {
+	// Table is either file_versions or file_permissions.
+	Table  string `json:"table"`
+	ID     uint64 `json:"id"`
+	FileID uint64 `json:"file_id"`
+	Path   string `json:"path"`
+
+	Checksum []byte `json:"-"`
+	Damaged  bool   `json:"damaged"`
+}
+
+// DamagedBlob is a blob found damaged by a scrub.
+type DamagedBlob struct {
+	StoredBlob
+	Reason string `json:"reason"`
+}
+
+// ScrubReport is the result of a scrub.
+type ScrubReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Checked    int       `json:"checked"`
+
+	// Backfilled is the number of blobs stored before checksums
+	// were introduced, their checksum is recorded by the scrub.
+	Backfilled int `json:"backfilled"`
+
+	// Repaired is the number of damaged blobs
+	// matching their checksum again.
+	Repaired int           `json:"repaired"`
+	Damaged  []DamagedBlob `json:"damaged"`
+}
+
+type ScrubRepository interface {
+	ListStoredBlobs(ctx context.Context) ([]StoredBlob, error)
+	ListDamaged(ctx context.Context) ([]StoredBlob, error)
+	SetChecksum(ctx context.Context, blob StoredBlob, checksum []byte) error
+	SetDamaged(ctx context.Context, blob StoredBlob, damaged bool) error
+}
+
+// Scrubber re-hashes the stored blobs and marks the ones
+// not matching their checksum as damaged.
+type Scrubber struct {
+	scrubRepository ScrubRepository
+
+	running sync.Mutex
+
+	mu         sync.Mutex
+	lastReport *ScrubReport
+}
+
+func NewScrubber(sr ScrubRepository) *Scrubber {
+	return &Scrubber{
+		scrubRepository: sr,
+	}
+}
+
+// Scrub checks every stored blob against its checksum.
+// ErrScrubRunning is returned when a scrub is in progress.
+func (s *Scrubber) Scrub(ctx context.Context) (*ScrubReport, error) {
+	if !s.running.TryLock() {
+		return nil, ErrScrubRunning
+	}
+	defer s.running.Unlock()
+
+	report, err := s.scrub(ctx)
+	if err != nil {
+		scrubErrors.Add(1)
+		return nil, err
+	}
+
+	scrubRuns.Add(1)
+	scrubLastRun.Set(report.FinishedAt.Format(time.RFC3339))
+
+	s.mu.Lock()
+	s.lastReport = report
+	s.mu.Unlock()
+
+	return report, nil
+}
+
+func (s *Scrubber) scrub(ctx context.Context) (*ScrubReport, error) {
+	report := ScrubReport{
+		StartedAt: time.Now(),
+		Damaged:   []DamagedBlob{},
+	}
+
+	blobs, err := s.scrubRepository.ListStoredBlobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	damaged := 0
+	for _, blob := range blobs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		checksum, err := hashFile(blob.Path)
+		report.Checked++
+		scrubBlobsChecked.Add(1)
+
+		reason := ""
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			reason = "blob does not exist"
+			scrubMissing.Add(1)
+		case err != nil:
+			return nil, err
+		case blob.Checksum == nil:
+			err = s.scrubRepository.SetChecksum(ctx, blob, checksum)
+			if err != nil {
+				return nil, err
+			}
+			report.Backfilled++
+		case !bytes.Equal(blob.Checksum, checksum):
+			reason = "checksum mismatch"
+			scrubMismatches.Add(1)
+		}
+
+		if reason != "" {
+			damaged++
+			report.Damaged = append(report.Damaged, DamagedBlob{
+				StoredBlob: blob,
+				Reason:     reason,
+			})
+		}
+
+		// update the flag when it changed
+		if blob.Damaged != (reason != "") {
+			err = s.scrubRepository.SetDamaged(ctx, blob, reason != "")
+			if err != nil {
+				return nil, err
+			}
+
+			if reason == "" {
+				report.Repaired++
+			}
+		}
+	}
+
+	scrubDamagedBlobs.Set(int64(damaged))
+	report.FinishedAt = time.Now()
+
+	return &report, nil
+}
+
+// LastReport returns the report of the last
+// completed scrub, nil if none completed yet.
+func (s *Scrubber) LastReport() *ScrubReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastReport
+}
+
+// ListDamaged lists the blobs currently marked as damaged.
+func (s *Scrubber) ListDamaged(ctx context.Context) ([]StoredBlob, error) {
+	blobs, err := s.scrubRepository.ListDamaged(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]StoredBlob{}, blobs...), nil
+}
+
+// Run calls Scrub every interval until ctx is done.
+func (s *Scrubber) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.Scrub(ctx)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			if len(report.Damaged) > 0 {
+				fmt.Printf("storage scrub: %v damaged blobs\n", len(report.Damaged))
+			}
+		}
+	}
+}
+
+// hashFile returns the sha-256 of a file.
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeScrubRepository struct {
+	blobs     []StoredBlob
+	checksums map[uint64][]byte
+	damaged   map[uint64]bool
+}
+
+func (f *fakeScrubRepository) ListStoredBlobs(ctx context.Context) ([]StoredBlob, error) {
+	return f.blobs, nil
+}
+
+func (f *fakeScrubRepository) ListDamaged(ctx context.Context) ([]StoredBlob, error) {
+	return nil, nil
+}
+
+func (f *fakeScrubRepository) SetChecksum(ctx context.Context, blob StoredBlob, checksum []byte) error {
+	f.checksums[blob.ID] = checksum
+	return nil
+}
+
+func (f *fakeScrubRepository) SetDamaged(ctx context.Context, blob StoredBlob, damaged bool) error {
+	f.damaged[blob.ID] = damaged
+	return nil
+}
+
+func TestScrubberScrub(t *testing.T) {
+	root := filepath.ToSlash(t.TempDir())
+	for _, name := range []string{"intact", "corrupted", "legacy", "repaired"} {
+		writeBlob(t, root+"/"+name, time.Now())
+	}
+
+	sum := sha256.Sum256([]byte("blob"))
+	checksum := sum[:]
+
+	repository := &fakeScrubRepository{
+		blobs: []StoredBlob{
+			{Table: "file_versions", ID: 1, Path: root + "/intact", Checksum: checksum},
+			{Table: "file_versions", ID: 2, Path: root + "/corrupted", Checksum: checksum},
+			{Table: "file_versions", ID: 3, Path: root + "/legacy"},
+			{Table: "file_permissions", ID: 4, Path: root + "/missing", Checksum: checksum},
+			{Table: "file_permissions", ID: 5, Path: root + "/repaired", Checksum: checksum, Damaged: true},
+		},
+		checksums: make(map[uint64][]byte),
+		damaged:   make(map[uint64]bool),
+	}
+
+	err := os.WriteFile(root+"/corrupted", []byte("blob!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewScrubber(repository).Scrub(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Checked != 5 || report.Backfilled != 1 || report.Repaired != 1 {
+		t.Errorf("report = %+v, want 5 checked, 1 backfilled and 1 repaired", report)
+	}
+	if len(report.Damaged) != 2 {
+		t.Errorf("damaged = %+v, want 2", report.Damaged)
+	}
+	if !repository.damaged[2] || !repository.damaged[4] || repository.damaged[5] {
+		t.Errorf("damaged flags = %v, want 2 and 4 damaged, 5 repaired", repository.damaged)
+	}
+	if _, ok := repository.checksums[3]; !ok {
+		t.Error("checksum of legacy blob was not backfilled")
+	}
+}
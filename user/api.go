@@ -1,6 +1,10 @@
 package user
 
-import "errors"
+import (
+	"encryption/ca"
+	"errors"
+	"time"
+)
 
 type RegisterRequest struct {
 	Username    string `json:"username" binding:"required"`
@@ -72,3 +76,78 @@ func (rr *UpdateProfileRequest) Validate() error {
 
 type UpdateProfileResponse struct {
 }
+
+type RotateSigningKeyRequest struct {
+	UserID uint64
+
+	// Reason is superseded, the default, or key_compromise when
+	// the private key was lost and its signatures can not be trusted.
+	Reason string `json:"reason"`
+}
+
+// Revocation reasons of a rotated signing key.
+const (
+	RotationSuperseded    string = "superseded"
+	RotationKeyCompromise string = "key_compromise"
+)
+
+// RevocationReason returns the CRL reason code of the request.
+func (rr *RotateSigningKeyRequest) RevocationReason() (int, error) {
+	switch rr.Reason {
+	case "", RotationSuperseded:
+		return ca.ReasonSuperseded, nil
+	case RotationKeyCompromise:
+		return ca.ReasonKeyCompromise, nil
+	}
+	return 0, errors.New("Request invalid. Reason must be superseded or key_compromise")
+}
+
+type RotateSigningKeyResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Certificate string `json:"certificate"`
+}
+
+type SigningKeyChallengeRequest struct {
+	UserID uint64
+}
+
+type SigningKeyChallengeResponse struct {
+	// Challenge is the nonce to sign, base64 encoded.
+	Challenge []byte    `json:"challenge"`
+	UserID    uint64    `json:"user_id"`
+	Username  string    `json:"username"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RegisterSigningKeyRequest struct {
+	UserID uint64
+
+	// PublicKey is the PEM encoded RSA public key of a private key
+	// the client keeps, PKCS#1 or SubjectPublicKeyInfo.
+	PublicKey string `json:"public_key"`
+
+	// Challenge is the challenge issued to the user, base64 encoded.
+	Challenge []byte `json:"challenge"`
+
+	// Signature is the RSASSA-PKCS1-v1_5 SHA-256 signature by the
+	// private key, base64 encoded, of the lines
+	//
+	//	user_id:<user id>
+	//	username:<username>
+	//	challenge:<base64 challenge>
+	//
+	// followed by PublicKey as sent.
+	Signature []byte `json:"signature"`
+}
+
+func (rr *RegisterSigningKeyRequest) Validate() error {
+	if rr.PublicKey == "" || len(rr.Challenge) == 0 || len(rr.Signature) == 0 {
+		return errors.New("Request invalid. Public key, challenge and signature are required")
+	}
+	return nil
+}
+
+type RegisterSigningKeyResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Certificate string `json:"certificate"`
+}
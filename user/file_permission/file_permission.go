@@ -36,4 +36,23 @@ type FilePermission struct {
 
 	FileID uint64 `json:"file_id"`
 	File   File   `json:"file"`
+
+	// WrappedKey is the file key encrypted with the
+	// permission key, nil for legacy rows holding an
+	// encrypted copy of the file at Filepath.
+	WrappedKey []byte `json:"-"`
+
+	// Version is the file version WrappedKey was wrapped for.
+	Version int `json:"version"`
+
+	// Synced is true when the grantee reads the
+	// current version of the file.
+	Synced bool `json:"synced"`
+
+	// Checksum is the sha-256 of the encrypted copy.
+	Checksum []byte `json:"-"`
+
+	// Damaged is true when the copy does not
+	// match its checksum anymore.
+	Damaged bool `json:"damaged"`
 }
@@ -133,6 +133,9 @@ func (fpr *filePermissionRepository) GetByUserFilePermission(
 				fp.id,
 				fp.filepath,
 				fp.permission_id,
+				fp.damaged,
+				fp.wrapped_key,
+				fp.version,
 				f.id,
 				f.user_id,
 				f.filename,
@@ -163,6 +166,9 @@ func (fpr *filePermissionRepository) GetByUserFilePermission(
 		&fp.ID,
 		&fp.Filepath,
 		&fp.PermissionID,
+		&fp.Damaged,
+		&fp.WrappedKey,
+		&fp.Version,
 		&fp.File.ID,
 		&fp.File.UserID,
 		&fp.File.Filename,
@@ -191,6 +197,9 @@ func (fpr *filePermissionRepository) ListByUserFilePermission(
 				fp.id,
 				fp.filepath,
 				fp.permission_id,
+				fp.damaged,
+				fp.version,
+				fp.wrapped_key IS NOT NULL AND fp.version = f.version,
 				f.id,
 				f.user_id,
 				f.filename,
@@ -219,6 +228,9 @@ func (fpr *filePermissionRepository) ListByUserFilePermission(
 			&fp.ID,
 			&fp.Filepath,
 			&fp.PermissionID,
+			&fp.Damaged,
+			&fp.Version,
+			&fp.Synced,
 			&fp.File.ID,
 			&fp.File.UserID,
 			&fp.File.Filename,
@@ -248,12 +260,18 @@ func (fpr *filePermissionRepository) CreateFilePermission(
 			file_permissions (
 				filepath,
 				permission_id,
-				file_id
+				file_id,
+				checksum,
+				wrapped_key,
+				version
 			)
 		VALUES (
 			$1,
 			$2,
-			$3
+			$3,
+			$4,
+			$5,
+			$6
 		)
 	`
 
@@ -263,6 +281,9 @@ func (fpr *filePermissionRepository) CreateFilePermission(
 		filePermission.Filepath,
 		filePermission.PermissionID,
 		filePermission.FileID,
+		filePermission.Checksum,
+		filePermission.WrappedKey,
+		filePermission.Version,
 	)
 	if err != nil {
 		return err
@@ -270,3 +291,139 @@ func (fpr *filePermissionRepository) CreateFilePermission(
 
 	return nil
 }
+
+// ListByFileID lists the permissions granted to a file.
+func (fpr *filePermissionRepository) ListByFileID(
+	ctx context.Context,
+	fileID uint64,
+) ([]FilePermission, error) {
+	var filePermissions []FilePermission
+
+	stmt := `
+		SELECT
+				id,
+				filepath,
+				permission_id,
+				file_id
+		 FROM
+		 	file_permissions
+		 WHERE file_id = $1
+		 `
+
+	rows, err := fpr.db.GetConn().Query(ctx, stmt, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fp FilePermission
+		err := rows.Scan(
+			&fp.ID,
+			&fp.Filepath,
+			&fp.PermissionID,
+			&fp.FileID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		filePermissions = append(filePermissions, fp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return filePermissions, nil
+}
+
+// ListOutdated lists the permissions of a file whose key is not
+// wrapped for the current version of the file, either because the
+// file changed since the grant or because they still hold an
+// encrypted copy of the file. A fileID of 0 lists them for all files.
+func (fpr *filePermissionRepository) ListOutdated(
+	ctx context.Context,
+	fileID uint64,
+) ([]FilePermission, error) {
+	var filePermissions []FilePermission
+
+	stmt := `
+		SELECT
+				fp.id,
+				fp.filepath,
+				fp.permission_id,
+				fp.file_id,
+				p.source_user_id,
+				p.target_user_id,
+				p.key,
+				p.key_reference
+		 FROM
+		 	file_permissions fp
+		 JOIN
+		 	files f ON fp.file_id = f.id
+		 LEFT JOIN
+			permissions p ON fp.permission_id = p.id
+		 WHERE (fp.wrapped_key IS NULL OR fp.version <> f.version)
+		 	AND ($1 = 0 OR fp.file_id = $1)
+		 ORDER BY fp.id
+		 `
+
+	rows, err := fpr.db.GetConn().Query(ctx, stmt, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fp FilePermission
+		err := rows.Scan(
+			&fp.ID,
+			&fp.Filepath,
+			&fp.PermissionID,
+			&fp.FileID,
+			&fp.Permission.SourceUserID,
+			&fp.Permission.TargetUserID,
+			&fp.Permission.Key,
+			&fp.Permission.KeyReference,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		fp.Permission.ID = fp.PermissionID
+		filePermissions = append(filePermissions, fp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return filePermissions, nil
+}
+
+// UpdateWrappedKey replaces the file key wrapped for the
+// permission and drops the reference to any legacy copy.
+func (fpr *filePermissionRepository) UpdateWrappedKey(
+	ctx context.Context,
+	filePermission FilePermission,
+) error {
+	stmt := `
+		UPDATE file_permissions
+		SET
+			wrapped_key = $2,
+			version = $3,
+			filepath = '',
+			checksum = NULL,
+			damaged = false
+		WHERE id = $1
+	`
+
+	_, err := fpr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		filePermission.ID,
+		filePermission.WrappedKey,
+		filePermission.Version,
+	)
+
+	return err
+}
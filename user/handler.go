@@ -12,6 +12,9 @@ type UserService interface {
 	login(ctx context.Context, request LoginRequest) (*LoginResponse, error)
 	getProfile(ctx context.Context, request GetProfileRequest) (*GetProfileResponse, error)
 	updateProfile(ctx context.Context, request UpdateProfileRequest) (*UpdateProfileResponse, error)
+	rotateSigningKey(ctx context.Context, request RotateSigningKeyRequest) (*RotateSigningKeyResponse, error)
+	signingKeyChallenge(ctx context.Context, request SigningKeyChallengeRequest) (*SigningKeyChallengeResponse, error)
+	registerClientKey(ctx context.Context, request RegisterSigningKeyRequest) (*RegisterSigningKeyResponse, error)
 }
 
 type Handler struct {
@@ -227,38 +230,12 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
 	if err = request.Validate(); err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
@@ -267,20 +244,7 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	_, err = h.userService.updateProfile(context.TODO(), request)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
-
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
@@ -290,24 +254,88 @@ func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 
 	jsonResponse, err := json.Marshal(response)
 	if err != nil {
-		response := helper.Response{
-			Message: err.Error(),
-			Data:    nil,
-		}
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
 
-		jsonResponse, err := json.Marshal(response)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(jsonResponse))
+}
+
+// RotateSigningKey replaces the signing key of the user. An empty
+// body rotates a superseded key.
+func (h *Handler) RotateSigningKey(w http.ResponseWriter, r *http.Request) {
+	var request RotateSigningKeyRequest
+
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 			return
 		}
+	}
 
-		w.Header().Set("content-type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write(jsonResponse)
+	request.UserID = uint64(r.Context().Value("user_id").(float64))
+
+	res, err := h.userService.rotateSigningKey(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
 		return
 	}
 
-	w.Header().Set("content-type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(jsonResponse))
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "Signing key rotated",
+		Data:    res,
+	})
+}
+
+// SigningKeyChallenge issues the challenge the client signs
+// to register a signing key it holds.
+func (h *Handler) SigningKeyChallenge(w http.ResponseWriter, r *http.Request) {
+	request := SigningKeyChallengeRequest{
+		UserID: uint64(r.Context().Value("user_id").(float64)),
+	}
+
+	res, err := h.userService.signingKeyChallenge(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "Signing key challenge issued",
+		Data:    res,
+	})
+}
+
+// RegisterSigningKey registers a public key the client holds the
+// private key of as the signing key of the user.
+func (h *Handler) RegisterSigningKey(w http.ResponseWriter, r *http.Request) {
+	var request RegisterSigningKeyRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = uint64(r.Context().Value("user_id").(float64))
+
+	res, err := h.userService.registerClientKey(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{
+		Message: "Signing key registered",
+		Data:    res,
+	})
 }
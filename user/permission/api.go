@@ -6,6 +6,15 @@ type RequestPermissionRequest struct {
 	UserID         uint64
 	TargetUsername string
 	FileID         uint64
+	FolderID       uint64
+}
+
+// GrantFolderPermissionRequest grants a folder of the
+// user to the target user without a prior request.
+type GrantFolderPermissionRequest struct {
+	UserID         uint64
+	FolderID       uint64
+	TargetUsername string `json:"username"`
 }
 
 type RequestPermissionResponse struct {
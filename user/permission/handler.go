@@ -43,6 +43,28 @@ type PermissionService interface {
 		context.Context,
 		RespondPermissionRequestRequest,
 	) (*RespondPermissionRequestResponse, error)
+
+	GetFolderNotifications(
+		ctx context.Context,
+		userID uint64,
+		status int,
+		direction int,
+	) ([]FolderNotification, error)
+
+	RequestFolderPermission(
+		context.Context,
+		RequestPermissionRequest,
+	) (*RequestPermissionResponse, error)
+
+	RespondFolderPermissionRequest(
+		context.Context,
+		RespondPermissionRequestRequest,
+	) (*RespondPermissionRequestResponse, error)
+
+	GrantFolderPermission(
+		context.Context,
+		GrantFolderPermissionRequest,
+	) (*RespondPermissionRequestResponse, error)
 }
 
 type Handler struct {
@@ -493,3 +515,115 @@ func (h *Handler) RespondFilePermissionRequest(w http.ResponseWriter, r *http.Re
 	w.WriteHeader(http.StatusCreated)
 	w.Write(jsonResponse)
 }
+
+func (h *Handler) GetFolderNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := uint64(r.Context().Value("user_id").(float64))
+
+	// converting and assinging default value if conversion errors
+	status, err := strconv.Atoi(r.URL.Query().Get("status"))
+	if err != nil {
+		status = 3
+	}
+
+	dir, err := strconv.Atoi(r.URL.Query().Get("dir"))
+	if err != nil {
+		dir = 1
+	}
+
+	res, err := h.permissionService.GetFolderNotifications(r.Context(), userID, status, dir)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusOK, helper.Response{
+		Message: "success",
+		Data:    res,
+	})
+}
+
+func (h *Handler) RequestFolderPermission(w http.ResponseWriter, r *http.Request) {
+	userID := uint64(r.Context().Value("user_id").(float64))
+
+	folderID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/request/folder/"), 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request := RequestPermissionRequest{
+		UserID:   userID,
+		FolderID: folderID,
+	}
+
+	_, err = h.permissionService.RequestFolderPermission(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{Message: "Request successfully sent"})
+}
+
+func (h *Handler) RespondFolderPermissionRequest(w http.ResponseWriter, r *http.Request) {
+	var request RespondPermissionRequestRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	err = request.Validate()
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	userID := uint64(r.Context().Value("user_id").(float64))
+	notificationID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/request/action/folder/"), 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = userID
+	request.NotificationID = notificationID
+
+	serviceResponse, err := h.permissionService.RespondFolderPermissionRequest(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{Message: serviceResponse.Message})
+}
+
+func (h *Handler) GrantFolderPermission(w http.ResponseWriter, r *http.Request) {
+	var request GrantFolderPermissionRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	// path is /folder/:id/grant
+	qFolderID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/folder/"), "/grant")
+	folderID, err := strconv.ParseUint(qFolderID, 10, 64)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	request.UserID = uint64(r.Context().Value("user_id").(float64))
+	request.FolderID = folderID
+
+	serviceResponse, err := h.permissionService.GrantFolderPermission(r.Context(), request)
+	if err != nil {
+		helper.WriteResponse(w, http.StatusBadRequest, helper.Response{Message: err.Error()})
+		return
+	}
+
+	helper.WriteResponse(w, http.StatusCreated, helper.Response{Message: serviceResponse.Message})
+}
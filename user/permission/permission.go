@@ -2,6 +2,7 @@ package permission
 
 import (
 	"encryption/file"
+	"encryption/folder"
 	"encryption/user"
 )
 
@@ -52,6 +53,32 @@ type FileNotification struct {
 	Status int `json:"status"`
 }
 
+type FolderNotification struct {
+	ID           uint64    `json:"id"`
+	SourceUserID uint64    `json:"source_user_id"`
+	SourceUser   user.User `json:"source_user"`
+	TargetUserID uint64    `json:"target_user_id"`
+	TargetUser   user.User `json:"target_user"`
+
+	FolderID uint64        `json:"folder_id"`
+	Folder   folder.Folder `json:"folder"`
+
+	// Status defines the status of the notification
+	// - 0 : Awaiting for response.
+	// - 1 : Request rejected.
+	// - 2 : Request accepted
+	Status int `json:"status"`
+}
+
+// FolderPermission grants the permission's source user every
+// file in a folder and its subfolders, including the files
+// added to them later.
+type FolderPermission struct {
+	ID           uint64 `json:"id"`
+	PermissionID uint64 `json:"permission_id"`
+	FolderID     uint64 `json:"folder_id"`
+}
+
 type RespondRequest struct {
 	Status int `json:"status"`
 }
@@ -493,3 +493,326 @@ func (pr *permissionRepository) CreatePermission(ctx context.Context, permission
 
 	return nil
 }
+
+func (pr *permissionRepository) GetFolderNotifications(
+	ctx context.Context,
+	userID uint64,
+	status int,
+	direction int,
+) ([]FolderNotification, error) {
+	var notifications []FolderNotification
+	var err error
+
+	stmt := `
+		SELECT
+				fn.id,
+				fn.source_user_id,
+				u1.username,
+				fn.target_user_id,
+				u2.username,
+				fn.status,
+				fn.folder_id,
+				f.name
+		 FROM
+		 	folder_notifications fn
+		 LEFT JOIN
+		 	users u1 ON fn.source_user_id = u1.id
+		 LEFT JOIN
+		 	users u2 ON fn.target_user_id = u2.id
+		 LEFT JOIN
+		 	folders f ON fn.folder_id = f.id
+		 WHERE 1=1
+		 AND
+		 `
+
+	ctr := 1
+	var args []any
+
+	if status != 3 {
+		stmt += fmt.Sprintf(" fn.status = $%v AND ", ctr)
+		args = append(args, status)
+		ctr++
+	}
+
+	if direction == 0 {
+		stmt += fmt.Sprintf(" fn.source_user_id = $%v", ctr)
+	} else {
+		stmt += fmt.Sprintf(" fn.target_user_id = $%v", ctr)
+	}
+
+	args = append(args, userID)
+
+	rows, err := pr.db.GetConn().Query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n FolderNotification
+		err := rows.Scan(
+			&n.ID,
+			&n.SourceUserID,
+			&n.SourceUser.Username,
+			&n.TargetUserID,
+			&n.TargetUser.Username,
+			&n.Status,
+			&n.FolderID,
+			&n.Folder.Name,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Folder.ID = n.FolderID
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (pr *permissionRepository) GetFolderNotificationById(ctx context.Context, notificationID uint64) (*FolderNotification, error) {
+	var notification FolderNotification
+
+	stmt := `
+		SELECT
+			id,
+			source_user_id,
+			target_user_id,
+			status,
+			folder_id
+		FROM folder_notifications
+		WHERE
+			id = $1
+	`
+
+	err := pr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		notificationID,
+	).Scan(
+		&notification.ID,
+		&notification.SourceUserID,
+		&notification.TargetUserID,
+		&notification.Status,
+		&notification.FolderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+func (pr *permissionRepository) GetFolderNotificationByUserIdAndFolderId(
+	ctx context.Context,
+	sourceUserID uint64,
+	targetUserID uint64,
+	folderID uint64,
+) (*FolderNotification, error) {
+	var notification FolderNotification
+
+	stmt := `
+		SELECT
+			id,
+			source_user_id,
+			target_user_id,
+			status,
+			folder_id
+		FROM folder_notifications
+		WHERE
+			source_user_id = $1 AND
+			target_user_id = $2 AND
+			folder_id = $3
+	`
+
+	err := pr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		sourceUserID,
+		targetUserID,
+		folderID,
+	).Scan(
+		&notification.ID,
+		&notification.SourceUserID,
+		&notification.TargetUserID,
+		&notification.Status,
+		&notification.FolderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification, nil
+}
+
+func (pr *permissionRepository) CreateFolderNotification(ctx context.Context, notification FolderNotification) error {
+	stmt := `
+		INSERT INTO
+			folder_notifications (
+				source_user_id,
+				target_user_id,
+				folder_id,
+				status
+			)
+		VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+	`
+
+	_, err := pr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		notification.SourceUserID,
+		notification.TargetUserID,
+		notification.FolderID,
+		notification.Status,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (pr *permissionRepository) UpdateFolderNotification(ctx context.Context, notification FolderNotification) error {
+	stmt := `
+		UPDATE
+			folder_notifications SET
+				status = $2
+		WHERE id = $1
+	`
+
+	_, err := pr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		notification.ID,
+		notification.Status,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (pr *permissionRepository) GetFolderPermission(
+	ctx context.Context,
+	permissionID uint64,
+	folderID uint64,
+) (*FolderPermission, error) {
+	var folderPermission FolderPermission
+
+	stmt := `
+		SELECT
+			id,
+			permission_id,
+			folder_id
+		FROM folder_permissions
+		WHERE
+			permission_id = $1 AND
+			folder_id = $2
+	`
+
+	err := pr.db.GetConn().QueryRow(
+		ctx,
+		stmt,
+		permissionID,
+		folderID,
+	).Scan(
+		&folderPermission.ID,
+		&folderPermission.PermissionID,
+		&folderPermission.FolderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folderPermission, nil
+}
+
+func (pr *permissionRepository) CreateFolderPermission(ctx context.Context, folderPermission FolderPermission) error {
+	stmt := `
+		INSERT INTO
+			folder_permissions (
+				permission_id,
+				folder_id
+			)
+		VALUES (
+			$1,
+			$2
+		)
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := pr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		folderPermission.PermissionID,
+		folderPermission.FolderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListFolderPermissionsByFile lists the permissions granted on the
+// folder of a file or on one of the folder's ancestors.
+func (pr *permissionRepository) ListFolderPermissionsByFile(ctx context.Context, fileID uint64) ([]Permission, error) {
+	var permissions []Permission
+
+	stmt := `
+		WITH RECURSIVE ancestors AS (
+			SELECT fd.id, fd.parent_id FROM folders fd
+			JOIN files f ON f.folder_id = fd.id
+			WHERE f.id = $1
+			UNION
+			SELECT fd.id, fd.parent_id FROM folders fd
+			JOIN ancestors a ON fd.id = a.parent_id
+		)
+		SELECT DISTINCT
+			p.id,
+			p.source_user_id,
+			p.target_user_id,
+			p.key,
+			p.key_reference
+		FROM folder_permissions fp
+		JOIN permissions p ON fp.permission_id = p.id
+		WHERE fp.folder_id IN (SELECT id FROM ancestors)
+	`
+
+	rows, err := pr.db.GetConn().Query(ctx, stmt, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Permission
+		err := rows.Scan(
+			&p.ID,
+			&p.SourceUserID,
+			&p.TargetUserID,
+			&p.Key,
+			&p.KeyReference,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
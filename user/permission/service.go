@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encryption/file"
+	"encryption/folder"
 	"encryption/guard"
 	"encryption/helper"
 	"encryption/user"
@@ -15,12 +16,12 @@ import (
 
 	"crypto/rsa"
 
-	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
 const userKeyTable = "user_keys"
 const permissionTable = "permission_keys"
+const fileTable = "keys"
 
 type Guard interface {
 	GetKey(ctx context.Context, table string, metadata []byte) (guard.Key, error)
@@ -55,6 +56,19 @@ type PermissionRepository interface {
 	GetFileNotificationByUserIdAndFileId(context.Context, uint64, uint64, int) (*FileNotification, error)
 	CreateFileNotification(context.Context, FileNotification) error
 	UpdateFileNotification(context.Context, FileNotification) error
+	GetFolderNotifications(
+		ctx context.Context,
+		userID uint64,
+		status int,
+		direction int,
+	) ([]FolderNotification, error)
+	GetFolderNotificationById(context.Context, uint64) (*FolderNotification, error)
+	GetFolderNotificationByUserIdAndFolderId(context.Context, uint64, uint64, uint64) (*FolderNotification, error)
+	CreateFolderNotification(context.Context, FolderNotification) error
+	UpdateFolderNotification(context.Context, FolderNotification) error
+	GetFolderPermission(ctx context.Context, permissionID uint64, folderID uint64) (*FolderPermission, error)
+	CreateFolderPermission(context.Context, FolderPermission) error
+	ListFolderPermissionsByFile(ctx context.Context, fileID uint64) ([]Permission, error)
 	GetPermissionByUserId(context.Context, uint64, uint64) (*Permission, error)
 	CreatePermission(context.Context, Permission) error
 }
@@ -86,10 +100,22 @@ type FilePermissionRepository interface {
 		targetUserID uint64,
 		fileID uint64,
 	) (filepermission.FilePermission, error)
+
+	ListOutdated(ctx context.Context, fileID uint64) ([]filepermission.FilePermission, error)
+
+	UpdateWrappedKey(
+		ctx context.Context,
+		filePermission filepermission.FilePermission,
+	) error
 }
 
 type FileRepository interface {
 	Get(context.Context, uint64) (file.File, error)
+	ListInFolder(ctx context.Context, folderID uint64) ([]file.File, error)
+}
+
+type FolderRepository interface {
+	Get(ctx context.Context, id uint64) (folder.Folder, error)
 }
 
 type UserService interface {
@@ -105,43 +131,35 @@ type FileSystem interface {
 	NewDir(path string) error
 }
 
-type DecryptService interface {
-	GetFile(
-		ctx context.Context,
-		userID uint64,
-		id uint64,
-	) (*file.File, error)
-}
-
 type permissionService struct {
-	decryptService           DecryptService
 	fileSystem               FileSystem
 	filePermissionRepository FilePermissionRepository
 	permissionRepository     PermissionRepository
 	userRepository           UserRepository
 	fileRepository           FileRepository
+	folderRepository         FolderRepository
 	guard                    guard.Guard
 	userService              UserService
 }
 
 func NewPermissionService(
-	ds DecryptService,
 	fs FileSystem,
 	fpr FilePermissionRepository,
 	pr PermissionRepository,
 	ur UserRepository,
 	fr FileRepository,
+	fdr FolderRepository,
 	g guard.Guard,
 	us UserService,
 ) *permissionService {
 	return &permissionService{
-		decryptService:           ds,
 		fileSystem:               fs,
 		filePermissionRepository: fpr,
 		permissionRepository:     pr,
 		userRepository:           ur,
 		userService:              us,
 		fileRepository:           fr,
+		folderRepository:         fdr,
 		guard:                    g,
 	}
 }
@@ -526,58 +544,320 @@ func (ps *permissionService) RespondFilePermissionRequest(
 		}, nil
 	}
 
+	err = ps.shareFile(ctx, permission, notification.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RespondPermissionRequestResponse{
+		Message: "Respond success. Notification is sent to requested user.",
+	}, nil
+}
+
+func (ps *permissionService) CreatePermission(
+	ctx context.Context,
+	sourceUserID uint64,
+	targetUserID uint64,
+	symmetricKey []byte,
+) error {
+	// create key
+	key, err := ps.guard.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	// store key to db
+	metadata, err := ps.guard.StoreKey(ctx, permissionTable, guard.Key{
+		PlainKey: key,
+	})
+	if err != nil {
+		return err
+	}
+
+	// encrypt symmetric key
+	encryptedKey, err := ps.guard.Encrypt(key, symmetricKey)
+	if err != nil {
+		return err
+	}
+
+	return ps.permissionRepository.CreatePermission(ctx, Permission{
+		SourceUserID: sourceUserID,
+		TargetUserID: targetUserID,
+		Key:          encryptedKey,
+		KeyReference: metadata,
+	})
+}
+
+// shareFile grants a file of the permission's target user to the
+// permission's source user by wrapping the file's key with the
+// permission's symmetric key.
+func (ps *permissionService) shareFile(
+	ctx context.Context,
+	permission *Permission,
+	fileID uint64,
+) error {
+	data, err := ps.fileRepository.Get(ctx, fileID)
+	if err != nil {
+		return err
+	}
+
+	if data.UserID != permission.TargetUserID {
+		return errors.New("You do not have access to this resource data")
+	}
+
+	// quarantined and infected files are not shared
+	if data.ScanStatus == file.ScanQuarantined || data.ScanStatus == file.ScanInfected {
+		return file.ErrQuarantined
+	}
+
+	wrappedKey, err := ps.wrapFileKey(ctx, permission, data)
+	if err != nil {
+		return err
+	}
+
+	// the grantee reads the owner's blob, no copy is stored
+	return ps.filePermissionRepository.CreateFilePermission(
+		ctx,
+		filepermission.FilePermission{
+			PermissionID: permission.ID,
+			FileID:       fileID,
+			WrappedKey:   wrappedKey,
+			Version:      data.Version,
+		},
+	)
+}
+
+// wrapFileKey encrypts the key of the file's current
+// version with the symmetric key of the permission.
+func (ps *permissionService) wrapFileKey(
+	ctx context.Context,
+	permission *Permission,
+	data file.File,
+) ([]byte, error) {
 	key, err := ps.guard.GetKey(ctx, permissionTable, permission.KeyReference)
 	if err != nil {
 		return nil, err
 	}
 
-	// decrypt file to res
 	symmetricKey, err := ps.guard.Decrypt(key.PlainKey, permission.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	// get original file
-	originalFile, err := ps.decryptService.GetFile(
+	fileKey, err := ps.guard.GetKey(ctx, fileTable, data.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	return ps.guard.Encrypt(symmetricKey, fileKey.PlainKey)
+}
+
+// SyncFilePermissions wraps the key of the current version of a file
+// for every grantee still reading an older version or a legacy copy.
+// A fileID of 0 syncs the permissions of all files. Legacy copies are
+// no longer referenced afterwards and are removed by the storage
+// collector.
+func (ps *permissionService) SyncFilePermissions(ctx context.Context, fileID uint64) error {
+	filePermissions, err := ps.filePermissionRepository.ListOutdated(ctx, fileID)
+	if err != nil {
+		return err
+	}
+
+	for _, fp := range filePermissions {
+		data, err := ps.fileRepository.Get(ctx, fp.FileID)
+		if err != nil {
+			fmt.Println("sync file permission", fp.ID, err)
+			continue
+		}
+
+		permission := Permission{
+			ID:           fp.Permission.ID,
+			SourceUserID: fp.Permission.SourceUserID,
+			TargetUserID: fp.Permission.TargetUserID,
+			Key:          fp.Permission.Key,
+			KeyReference: fp.Permission.KeyReference,
+		}
+
+		wrappedKey, err := ps.wrapFileKey(ctx, &permission, data)
+		if err != nil {
+			fmt.Println("sync file permission", fp.ID, err)
+			continue
+		}
+
+		fp.WrappedKey = wrappedKey
+		fp.Version = data.Version
+		err = ps.filePermissionRepository.UpdateWrappedKey(ctx, fp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasFilePermission reports whether the permission's
+// source user already has a permission to a file.
+func (ps *permissionService) hasFilePermission(
+	ctx context.Context,
+	permission *Permission,
+	fileID uint64,
+) (bool, error) {
+	filePermission, err := ps.filePermissionRepository.GetByUserFilePermission(
 		ctx,
-		targetUser.ID,
-		notification.FileID,
+		permission.SourceUserID,
+		permission.TargetUserID,
+		fileID,
 	)
-	if err != nil {
+	if err != nil && err != pgx.ErrNoRows {
+		return false, err
+	}
+
+	return filePermission.ID != 0, nil
+}
+
+func (ps *permissionService) GetFolderNotifications(
+	ctx context.Context,
+	userID uint64,
+	status int,
+	direction int,
+) ([]FolderNotification, error) {
+	return ps.permissionRepository.GetFolderNotifications(
+		ctx,
+		userID,
+		status,
+		direction,
+	)
+}
+
+func (ps *permissionService) RequestFolderPermission(
+	ctx context.Context,
+	request RequestPermissionRequest,
+) (*RequestPermissionResponse, error) {
+	folder, err := ps.folderRepository.Get(ctx, request.FolderID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, errors.New("Requested folder not exists")
+	}
+	if folder.UserID == request.UserID {
+		return nil, errors.New("Request permission failed. You can not request permission to your folder.")
+	}
+
+	permission, err := ps.permissionRepository.GetPermissionByUserId(ctx, request.UserID, folder.UserID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("Request permission failed. Please request permission to see profile data first.")
+	}
+
+	_, err = ps.permissionRepository.GetFolderPermission(ctx, permission.ID, folder.ID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		return nil, errors.New("You already have permission to this user's folder.")
+	}
+
+	notification, err := ps.permissionRepository.GetFolderNotificationByUserIdAndFolderId(ctx, request.UserID, folder.UserID, folder.ID)
+	if err != nil && err != pgx.ErrNoRows {
 		return nil, err
 	}
 
-	fmt.Println("cek 4")
-	// encrypt original file with symmetric key
-	encryptedFileContent, err := ps.guard.Encrypt(symmetricKey, originalFile.Content)
+	if notification != nil {
+		if notification.Status == 0 {
+			return nil, errors.New("Existing request is still in pending status. Please wait for approval.")
+		}
+
+		if notification.Status == 2 {
+			return nil, errors.New("You already have permission to related folder")
+		}
+
+		if notification.Status == 1 {
+			notification.Status = 0
+			err = ps.permissionRepository.UpdateFolderNotification(ctx, *notification)
+			if err != nil {
+				return nil, err
+			}
+			return &RequestPermissionResponse{}, nil
+		}
+	}
+
+	err = ps.permissionRepository.CreateFolderNotification(ctx, FolderNotification{
+		SourceUserID: request.UserID,
+		TargetUserID: folder.UserID,
+		FolderID:     folder.ID,
+		Status:       0,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("cek 5")
-	dirName := fmt.Sprintf("%v_%v", sourceUser.ID, targetUser.ID)
-	err = ps.fileSystem.NewDir("files/" + dirName)
-	if err != nil && errors.Is(err, os.ErrNotExist) {
+	return &RequestPermissionResponse{}, nil
+}
+
+func (ps *permissionService) RespondFolderPermissionRequest(
+	ctx context.Context,
+	request RespondPermissionRequestRequest,
+) (*RespondPermissionRequestResponse, error) {
+	notification, err := ps.permissionRepository.GetFolderNotificationById(ctx, request.NotificationID)
+	if err != nil {
 		return nil, err
 	}
 
-	newFileName := uuid.New().String()
+	if notification.TargetUserID != request.UserID {
+		return nil, errors.New("You do not have access to this resource data.")
+	}
+	if notification.Status == 1 {
+		return nil, errors.New("The request permission has already been rejected.")
+	}
+	if notification.Status == 2 {
+		return nil, errors.New("The request permission has already been accepted.")
+	}
+
+	permission, err := ps.permissionRepository.GetPermissionByUserId(ctx, notification.SourceUserID, notification.TargetUserID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if permission == nil {
+		return nil, fmt.Errorf("Permission is not granted. Please request permission to see profile data first.")
+	}
 
-	// save file to new directory
-	err = ps.fileSystem.Write("files/"+dirName+"/"+newFileName, encryptedFileContent)
+	// update notification status
+	notification.Status = int(request.PermissionStatus)
+	err = ps.permissionRepository.UpdateFolderNotification(ctx, *notification)
 	if err != nil {
 		return nil, err
 	}
 
-	// create file permission
-	err = ps.filePermissionRepository.CreateFilePermission(
-		ctx,
-		filepermission.FilePermission{
-			Filepath:     "files/" + dirName + "/" + newFileName,
-			PermissionID: permission.ID,
-			FileID:       notification.FileID,
-		},
-	)
+	// send rejection email message
+	if request.PermissionStatus == 1 {
+		sourceUser, err := ps.userRepository.GetById(ctx, notification.SourceUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		targetUser, err := ps.userRepository.GetById(ctx, notification.TargetUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = helper.SendMail(
+			sourceUser.Email,
+			"Permission Request Information",
+			fmt.Sprintf("Your permission request to see %s folder is rejected", targetUser.Username),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RespondPermissionRequestResponse{
+			Message: "Respond success. Notification is sent to requested user.",
+		}, nil
+	}
+
+	err = ps.shareFolder(ctx, permission, notification.FolderID)
 	if err != nil {
 		return nil, err
 	}
@@ -587,36 +867,113 @@ func (ps *permissionService) RespondFilePermissionRequest(
 	}, nil
 }
 
-func (ps *permissionService) CreatePermission(
+// GrantFolderPermission grants a folder of the user to a user
+// who was already granted a permission to the user's profile.
+func (ps *permissionService) GrantFolderPermission(
 	ctx context.Context,
-	sourceUserID uint64,
-	targetUserID uint64,
-	symmetricKey []byte,
+	request GrantFolderPermissionRequest,
+) (*RespondPermissionRequestResponse, error) {
+	folder, err := ps.folderRepository.Get(ctx, request.FolderID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, errors.New("Requested folder not exists")
+	}
+	if folder.UserID != request.UserID {
+		return nil, errors.New("You do not have access to this resource data.")
+	}
+
+	sourceUser, err := ps.userRepository.GetByUsername(ctx, request.TargetUsername)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errors.New("User with related username does not exist")
+		}
+		return nil, err
+	}
+
+	permission, err := ps.permissionRepository.GetPermissionByUserId(ctx, sourceUser.ID, request.UserID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if permission == nil {
+		return nil, fmt.Errorf("Permission is not granted. %s has to request permission to see your profile data first.", sourceUser.Username)
+	}
+
+	err = ps.shareFolder(ctx, permission, folder.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RespondPermissionRequestResponse{
+		Message: "Folder successfully shared.",
+	}, nil
+}
+
+// shareFolder creates a folder permission and shares
+// the files already in the folder and its subfolders.
+func (ps *permissionService) shareFolder(
+	ctx context.Context,
+	permission *Permission,
+	folderID uint64,
 ) error {
-	// create key
-	key, err := ps.guard.GenerateKey()
+	err := ps.permissionRepository.CreateFolderPermission(ctx, FolderPermission{
+		PermissionID: permission.ID,
+		FolderID:     folderID,
+	})
 	if err != nil {
 		return err
 	}
 
-	// store key to db
-	metadata, err := ps.guard.StoreKey(ctx, permissionTable, guard.Key{
-		PlainKey: key,
-	})
+	files, err := ps.fileRepository.ListInFolder(ctx, folderID)
 	if err != nil {
 		return err
 	}
 
-	// encrypt symmetric key
-	encryptedKey, err := ps.guard.Encrypt(key, symmetricKey)
+	for _, data := range files {
+		err = ps.shareFolderFile(ctx, permission, data.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ShareFolderFile shares a file to the users having a permission
+// on its folder. It is called when a file is added to a folder.
+func (ps *permissionService) ShareFolderFile(ctx context.Context, fileID uint64) error {
+	permissions, err := ps.permissionRepository.ListFolderPermissionsByFile(ctx, fileID)
 	if err != nil {
 		return err
 	}
 
-	return ps.permissionRepository.CreatePermission(ctx, Permission{
-		SourceUserID: sourceUserID,
-		TargetUserID: targetUserID,
-		Key:          encryptedKey,
-		KeyReference: metadata,
-	})
+	for _, permission := range permissions {
+		err = ps.shareFolderFile(ctx, &permission, fileID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shareFolderFile shares a file of a shared folder unless it is
+// already shared. Quarantined and infected files are skipped.
+func (ps *permissionService) shareFolderFile(
+	ctx context.Context,
+	permission *Permission,
+	fileID uint64,
+) error {
+	shared, err := ps.hasFilePermission(ctx, permission, fileID)
+	if err != nil || shared {
+		return err
+	}
+
+	err = ps.shareFile(ctx, permission, fileID)
+	if errors.Is(err, file.ErrQuarantined) {
+		return nil
+	}
+
+	return err
 }
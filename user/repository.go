@@ -153,7 +153,7 @@ func (fr *userRepository) GetByUsername(ctx context.Context, username string) (*
 	return &user, nil
 }
 
-func (fr *userRepository) Create(ctx context.Context, user User) error {
+func (fr *userRepository) Create(ctx context.Context, user User) (uint64, error) {
 	stmt := `
 	INSERT INTO
 		users (
@@ -174,8 +174,9 @@ func (fr *userRepository) Create(ctx context.Context, user User) error {
 	VALUES (
 		$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
 	)
+	RETURNING id
 	`
-	_, err := fr.db.GetConn().Exec(
+	err := fr.db.GetConn().QueryRow(
 		ctx,
 		stmt,
 		user.Username,
@@ -191,12 +192,35 @@ func (fr *userRepository) Create(ctx context.Context, user User) error {
 		user.PublicKey,
 		user.PrivateKey,
 		user.KeyReference,
-	)
+	).Scan(&user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+// Delete removes a user along with its signing keys and
+// certificates, it must not hold any other data yet.
+func (fr *userRepository) Delete(ctx context.Context, userID uint64) error {
+	tx, err := fr.db.GetConn().Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	for _, stmt := range []string{
+		`DELETE FROM user_certificates WHERE user_id = $1`,
+		`DELETE FROM signing_keys WHERE user_id = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	} {
+		_, err = tx.Exec(ctx, stmt, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (fr *userRepository) Update(ctx context.Context, user User) error {
@@ -235,3 +259,27 @@ func (fr *userRepository) Update(ctx context.Context, user User) error {
 
 	return nil
 }
+
+// UpdateRSA replaces the encrypted key pair of a user.
+func (fr *userRepository) UpdateRSA(ctx context.Context, user User) error {
+	stmt := `
+	UPDATE
+		users SET
+			public_key = $1,
+			private_key = $2
+	WHERE id = $3
+	`
+
+	_, err := fr.db.GetConn().Exec(
+		ctx,
+		stmt,
+		user.PublicKey,
+		user.PrivateKey,
+		user.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -5,13 +5,17 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
+	"encryption/ca"
 	"encryption/guard"
 	"encryption/helper"
+	signingkey "encryption/user/signing_key"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
@@ -19,6 +23,20 @@ import (
 
 const userKeyTable = "user_keys"
 
+// minClientKeyBits is the smallest client held signing key accepted.
+const minClientKeyBits = 2048
+
+// Lifetime of the challenge signed to register a client held key.
+const signingKeyChallengeTTL = 10 * time.Minute
+
+var (
+	ErrInvalidClientKey = errors.New("public key must be a PEM encoded RSA key of at least 2048 bits")
+	ErrKeyPossession    = errors.New("signature does not prove possession of the public key")
+	ErrNoChallenge      = errors.New("challenge not found, a new challenge must be requested")
+	ErrChallengeExpired = errors.New("challenge expired, a new challenge must be requested")
+	ErrRevokedClientKey = errors.New("public key was revoked and can not be registered again")
+)
+
 type Guard interface {
 	GetKey(table string, metadata []byte) (guard.Key, error)
 	StoreKey(table string, key guard.Key) ([]byte, error)
@@ -30,27 +48,52 @@ type Guard interface {
 type UserRepository interface {
 	GetById(context.Context, uint64) (*User, error)
 	GetByUsername(context.Context, string) (*User, error)
-	Create(context.Context, User) error
+	Create(context.Context, User) (uint64, error)
 	Update(context.Context, User) error
+	Delete(context.Context, uint64) error
 
 	GetUserWithRSA(
 		ctx context.Context,
 		userId uint64,
 	) (*User, error)
+	UpdateRSA(ctx context.Context, user User) error
+}
+
+type SigningKeyRepository interface {
+	Create(ctx context.Context, key signingkey.SigningKey) (uint64, error)
+	GetByFingerprint(ctx context.Context, userID uint64, fingerprint string) (signingkey.SigningKey, error)
+	GetCurrent(ctx context.Context, userID uint64) (signingkey.SigningKey, error)
+	ListUsersWithoutKey(ctx context.Context) ([]uint64, error)
+	CreateChallenge(ctx context.Context, challenge signingkey.Challenge) error
+	ConsumeChallenge(ctx context.Context, userID uint64, nonce []byte) (signingkey.Challenge, error)
+}
+
+type CertificateAuthority interface {
+	Issue(ctx context.Context, userID uint64, username string, email string, publicKey *rsa.PublicKey) (*x509.Certificate, error)
+	Chain(ctx context.Context, userID uint64, username string, email string, publicKey *rsa.PublicKey) ([]*x509.Certificate, error)
+	Revoke(ctx context.Context, userID uint64, fingerprint string, reason int) error
+	ListRevokedByFingerprint(ctx context.Context, fingerprint string) ([]ca.Certificate, error)
+	ListUsersWithoutCertificate(ctx context.Context) ([]uint64, error)
 }
 
 type userService struct {
-	userRepository UserRepository
-	guard          guard.Guard
+	userRepository       UserRepository
+	signingKeyRepository SigningKeyRepository
+	certificateAuthority CertificateAuthority
+	guard                guard.Guard
 }
 
 func NewFileService(
 	ur UserRepository,
+	skr SigningKeyRepository,
+	ca CertificateAuthority,
 	g guard.Guard,
 ) *userService {
 	return &userService{
-		userRepository: ur,
-		guard:          g,
+		userRepository:       ur,
+		signingKeyRepository: skr,
+		certificateAuthority: ca,
+		guard:                g,
 	}
 }
 
@@ -116,28 +159,11 @@ func (us *userService) register(
 	}
 
 	// generate RSA key
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, pubPEM, privPEM, err := generateRSAKey()
 	if err != nil {
 		return nil, err
 	}
 
-	publicKey := privateKey.Public()
-
-	// Encode private key to PKCS#1 ASN.1 PEM.
-	privPEM := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-		},
-	)
-	// Encode public key to PKCS#1 ASN.1 PEM.
-	pubPEM := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "RSA PUBLIC KEY",
-			Bytes: x509.MarshalPKCS1PublicKey(publicKey.(*rsa.PublicKey)),
-		},
-	)
-
 	// create key
 	key, err := us.guard.GenerateKey()
 	if err != nil {
@@ -175,14 +201,358 @@ func (us *userService) register(
 
 	user.KeyReference = metadata
 
-	err = us.userRepository.Create(ctx, user)
+	userID, err := us.userRepository.Create(ctx, user)
+	if err != nil {
+		us.guard.DeleteKey(ctx, userKeyTable, metadata)
+		return nil, err
+	}
+
+	err = us.registerSigningKey(ctx, userID, string(pubPEM))
+	if err == nil {
+		_, err = us.certificateAuthority.Issue(ctx, userID, request.Username, request.Email, &privateKey.PublicKey)
+	}
 	if err != nil {
+		us.deleteRegisteredUser(ctx, userID, metadata)
 		return nil, err
 	}
 
 	return &RegisterResponse{}, nil
 }
 
+// deleteRegisteredUser removes a user whose registration failed along
+// with its key, the username can then be registered again.
+func (us *userService) deleteRegisteredUser(ctx context.Context, userID uint64, keyReference []byte) {
+	err := us.userRepository.Delete(ctx, userID)
+	if err != nil {
+		fmt.Println("delete registered user", userID, err)
+		return
+	}
+
+	err = us.guard.DeleteKey(ctx, userKeyTable, keyReference)
+	if err != nil {
+		fmt.Println("delete registered user key", userID, err)
+	}
+}
+
+// generateRSAKey returns a signing key pair of a user
+// along with its PKCS#1 PEM encodings.
+func generateRSAKey() (*rsa.PrivateKey, []byte, []byte, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Encode private key to PKCS#1 ASN.1 PEM.
+	privPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		},
+	)
+	// Encode public key to PKCS#1 ASN.1 PEM.
+	pubPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "RSA PUBLIC KEY",
+			Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
+		},
+	)
+
+	return privateKey, pubPEM, privPEM, nil
+}
+
+// rotateSigningKey replaces the key pair of a user, revoking the
+// certificates of the previous key for the reason of the request
+// and certifying the new one.
+func (us *userService) rotateSigningKey(
+	ctx context.Context,
+	request RotateSigningKeyRequest,
+) (*RotateSigningKeyResponse, error) {
+	reason, err := request.RevocationReason()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := us.GetUserWithRSA(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousFingerprint, err := us.currentFingerprint(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// revoke first so a lost key stops being trusted
+	// even if the rotation fails
+	err = us.certificateAuthority.Revoke(ctx, user.ID, previousFingerprint, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, pubPEM, privPEM, err := generateRSAKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := us.guard.GetKey(ctx, userKeyTable, user.KeyReference)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := User{
+		ID:         user.ID,
+		PublicKey:  string(pubPEM),
+		PrivateKey: string(privPEM),
+	}
+
+	err = keys.EncryptUserData(&us.guard, key.PlainKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.userRepository.UpdateRSA(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.registerSigningKey(ctx, user.ID, string(pubPEM))
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := us.certificateAuthority.Issue(ctx, user.ID, user.Username, user.Email, &privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := signingkey.Fingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RotateSigningKeyResponse{
+		Fingerprint: fingerprint,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+	}, nil
+}
+
+// currentFingerprint returns the fingerprint of the key user signs
+// with, a client held key replaces the key pair of the user.
+func (us *userService) currentFingerprint(ctx context.Context, user *User) (string, error) {
+	current, err := us.GetCurrentSigningKey(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	if current != nil {
+		return current.Fingerprint, nil
+	}
+
+	publicKey, err := us.guard.ParsePublicKey(user.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return signingkey.Fingerprint(publicKey)
+}
+
+// signingKeyChallenge issues the nonce a user signs to register
+// a client held key, replacing the one issued before.
+func (us *userService) signingKeyChallenge(
+	ctx context.Context,
+	request SigningKeyChallengeRequest,
+) (*SigningKeyChallengeResponse, error) {
+	user, err := us.GetUserById(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 32)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := signingkey.Challenge{
+		UserID:    user.ID,
+		Nonce:     nonce,
+		ExpiresAt: time.Now().UTC().Truncate(time.Second).Add(signingKeyChallengeTTL),
+	}
+
+	err = us.signingKeyRepository.CreateChallenge(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKeyChallengeResponse{
+		Challenge: challenge.Nonce,
+		UserID:    user.ID,
+		Username:  user.Username,
+		ExpiresAt: challenge.ExpiresAt,
+	}, nil
+}
+
+// possessionMessage returns the message a client signs to prove it
+// holds the private key of publicKey, binding the key to the account
+// and to a challenge issued to it.
+func possessionMessage(user *User, challenge []byte, publicKey string) []byte {
+	return []byte(fmt.Sprintf(
+		"user_id:%d\nusername:%s\nchallenge:%s\n%s",
+		user.ID,
+		user.Username,
+		base64.StdEncoding.EncodeToString(challenge),
+		publicKey,
+	))
+}
+
+// registerClientKey registers a public key whose private key the
+// client keeps as the signing key of the user, superseding the
+// previous one. The server can then only sign for the user with
+// signatures its client makes.
+func (us *userService) registerClientKey(
+	ctx context.Context,
+	request RegisterSigningKeyRequest,
+) (*RegisterSigningKeyResponse, error) {
+	publicKey, err := parseClientKey(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := signingkey.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.checkClientKey(ctx, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := us.GetUserById(ctx, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = us.guard.VerifyRSA(publicKey, request.Signature, possessionMessage(user, request.Challenge, request.PublicKey))
+	if err != nil {
+		return nil, ErrKeyPossession
+	}
+
+	// the challenge answers a single registration
+	challenge, err := us.signingKeyRepository.ConsumeChallenge(ctx, user.ID, request.Challenge)
+	if err == pgx.ErrNoRows {
+		return nil, ErrNoChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrChallengeExpired
+	}
+
+	previousFingerprint, err := us.currentFingerprint(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if previousFingerprint != fingerprint {
+		err = us.certificateAuthority.Revoke(ctx, user.ID, previousFingerprint, ca.ReasonSuperseded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// stored as PKCS#1 like the keys generated for users
+	pubPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(publicKey),
+	})
+
+	_, err = us.signingKeyRepository.Create(ctx, signingkey.SigningKey{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		PublicKey:   string(pubPEM),
+		ClientHeld:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// registering the current key again keeps its certificate
+	var cert *x509.Certificate
+	if previousFingerprint == fingerprint {
+		chain, err := us.certificateAuthority.Chain(ctx, user.ID, user.Username, user.Email, publicKey)
+		if err != nil {
+			return nil, err
+		}
+		cert = chain[0]
+	} else {
+		cert, err = us.certificateAuthority.Issue(ctx, user.ID, user.Username, user.Email, publicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &RegisterSigningKeyResponse{
+		Fingerprint: fingerprint,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+	}, nil
+}
+
+// checkClientKey checks that the key with the fingerprint can be
+// registered. A key revoked once stays revoked, signatures made with
+// it would fail their revocation check.
+func (us *userService) checkClientKey(ctx context.Context, fingerprint string) error {
+	revoked, err := us.certificateAuthority.ListRevokedByFingerprint(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+
+	if len(revoked) > 0 {
+		return ErrRevokedClientKey
+	}
+
+	return nil
+}
+
+// parseClientKey parses a PEM encoded RSA public key,
+// PKCS#1 or SubjectPublicKeyInfo.
+func parseClientKey(key string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, ErrInvalidClientKey
+	}
+
+	var publicKey *rsa.PublicKey
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, ErrInvalidClientKey
+		}
+		publicKey = pub
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, ErrInvalidClientKey
+		}
+
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidClientKey
+		}
+		publicKey = rsaKey
+	default:
+		return nil, ErrInvalidClientKey
+	}
+
+	if publicKey.N.BitLen() < minClientKeyBits {
+		return nil, ErrInvalidClientKey
+	}
+
+	return publicKey, nil
+}
+
 func (us *userService) getProfile(
 	ctx context.Context,
 	request GetProfileRequest,
@@ -339,3 +709,119 @@ func (us *userService) GetUserById(
 
 	return user, nil
 }
+
+// registerSigningKey records publicKey as the current
+// signing key of the user.
+func (us *userService) registerSigningKey(ctx context.Context, userID uint64, publicKey string) error {
+	pub, err := us.guard.ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := signingkey.Fingerprint(pub)
+	if err != nil {
+		return err
+	}
+
+	_, err = us.signingKeyRepository.Create(ctx, signingkey.SigningKey{
+		UserID:      userID,
+		Fingerprint: fingerprint,
+		PublicKey:   publicKey,
+	})
+
+	return err
+}
+
+// RegisterSigningKeys registers the keys of the users created
+// before the signing key registry existed.
+func (us *userService) RegisterSigningKeys(ctx context.Context) error {
+	userIDs, err := us.signingKeyRepository.ListUsersWithoutKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		user, err := us.GetUserWithRSA(ctx, userID)
+		if err != nil {
+			fmt.Println("register signing key", userID, err)
+			continue
+		}
+
+		err = us.registerSigningKey(ctx, userID, user.PublicKey)
+		if err != nil {
+			fmt.Println("register signing key", userID, err)
+		}
+	}
+
+	return nil
+}
+
+// IssueCertificates certifies the current signing keys
+// of the users created before the certificate authority.
+func (us *userService) IssueCertificates(ctx context.Context) error {
+	userIDs, err := us.certificateAuthority.ListUsersWithoutCertificate(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		user, err := us.GetUserWithRSA(ctx, userID)
+		if err != nil {
+			fmt.Println("issue certificate", userID, err)
+			continue
+		}
+
+		publicKey, err := us.guard.ParsePublicKey(user.PublicKey)
+		if err != nil {
+			fmt.Println("issue certificate", userID, err)
+			continue
+		}
+
+		_, err = us.certificateAuthority.Chain(ctx, userID, user.Username, user.Email, publicKey)
+		if err != nil {
+			fmt.Println("issue certificate", userID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetSigningKey returns the registered key of username with the
+// fingerprint, or nil when the user or the key is unknown.
+func (us *userService) GetSigningKey(
+	ctx context.Context,
+	username string,
+	fingerprint string,
+) (*signingkey.SigningKey, error) {
+	user, err := us.userRepository.GetByUsername(ctx, username)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows || user == nil {
+		return nil, nil
+	}
+
+	key, err := us.signingKeyRepository.GetByFingerprint(ctx, user.ID, fingerprint)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return &key, nil
+}
+
+// GetCurrentSigningKey returns the key the user signs with,
+// or nil when the user has no registered key.
+func (us *userService) GetCurrentSigningKey(ctx context.Context, userID uint64) (*signingkey.SigningKey, error) {
+	key, err := us.signingKeyRepository.GetCurrent(ctx, userID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+
+	return &key, nil
+}
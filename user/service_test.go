@@ -0,0 +1,41 @@
+package user
+
+import (
+	"context"
+	"encryption/ca"
+	"testing"
+	"time"
+)
+
+// fakeAuthority only lists revoked certificates by fingerprint.
+type fakeAuthority struct {
+	CertificateAuthority
+	revoked map[string][]ca.Certificate
+}
+
+func (f *fakeAuthority) ListRevokedByFingerprint(ctx context.Context, fingerprint string) ([]ca.Certificate, error) {
+	return f.revoked[fingerprint], nil
+}
+
+func TestCheckClientKey(t *testing.T) {
+	revokedAt := time.Now()
+	us := &userService{certificateAuthority: &fakeAuthority{revoked: map[string][]ca.Certificate{
+		"compromised": {{Fingerprint: "compromised", RevokedAt: &revokedAt, RevocationReason: ca.ReasonKeyCompromise}},
+		"superseded":  {{Fingerprint: "superseded", RevokedAt: &revokedAt, RevocationReason: ca.ReasonSuperseded}},
+	}}}
+
+	tests := []struct {
+		fingerprint string
+		want        error
+	}{
+		{"fresh", nil},
+		{"compromised", ErrRevokedClientKey},
+		{"superseded", ErrRevokedClientKey},
+	}
+
+	for _, tt := range tests {
+		if err := us.checkClientKey(context.Background(), tt.fingerprint); err != tt.want {
+			t.Errorf("checkClientKey(%v) error = %v, want %v", tt.fingerprint, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package signingkey
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DB interface {
+	GetConn() *pgxpool.Pool
+}
+
+type signingKeyRepository struct {
+	db DB
+}
+
+func NewSigningKeyRepository(db DB) *signingKeyRepository {
+	return &signingKeyRepository{
+		db: db,
+	}
+}
+
+// Create registers key as the current key of its user
+// and retires the previous current key.
+func (skr *signingKeyRepository) Create(ctx context.Context, key SigningKey) (uint64, error) {
+	tx, err := skr.db.GetConn().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	stmt := `
+	UPDATE signing_keys
+	SET current = false, retired_at = now()
+	WHERE user_id = $1 AND current
+	`
+
+	_, err = tx.Exec(ctx, stmt, key.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `
+	INSERT INTO
+		signing_keys (
+			user_id,
+			fingerprint,
+			public_key,
+			client_held,
+			current
+		)
+	VALUES (
+		$1,
+		$2,
+		$3,
+		$4,
+		true
+	)
+	ON CONFLICT (user_id, fingerprint) DO UPDATE
+		SET current = true, client_held = $4, retired_at = NULL
+	RETURNING id
+	`
+
+	err = tx.QueryRow(
+		ctx,
+		stmt,
+		key.UserID,
+		key.Fingerprint,
+		key.PublicKey,
+		key.ClientHeld,
+	).Scan(&key.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return key.ID, tx.Commit(ctx)
+}
+
+const selectSigningKey = `
+	SELECT
+			id,
+			user_id,
+			fingerprint,
+			public_key,
+			current,
+			client_held,
+			created_at,
+			retired_at
+	 FROM signing_keys
+`
+
+// GetByFingerprint returns the key of a user
+// with the fingerprint, current or retired.
+func (skr *signingKeyRepository) GetByFingerprint(
+	ctx context.Context,
+	userID uint64,
+	fingerprint string,
+) (SigningKey, error) {
+	var key SigningKey
+
+	stmt := selectSigningKey + ` WHERE user_id = $1 AND fingerprint = $2`
+
+	err := skr.db.GetConn().QueryRow(ctx, stmt, userID, fingerprint).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Fingerprint,
+		&key.PublicKey,
+		&key.Current,
+		&key.ClientHeld,
+		&key.CreatedAt,
+		&key.RetiredAt,
+	)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return key, nil
+}
+
+// GetCurrent returns the key a user signs with.
+func (skr *signingKeyRepository) GetCurrent(ctx context.Context, userID uint64) (SigningKey, error) {
+	var key SigningKey
+
+	stmt := selectSigningKey + ` WHERE user_id = $1 AND current`
+
+	err := skr.db.GetConn().QueryRow(ctx, stmt, userID).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Fingerprint,
+		&key.PublicKey,
+		&key.Current,
+		&key.ClientHeld,
+		&key.CreatedAt,
+		&key.RetiredAt,
+	)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return key, nil
+}
+
+// ListByUser lists the keys of a user, newest first.
+func (skr *signingKeyRepository) ListByUser(ctx context.Context, userID uint64) ([]SigningKey, error) {
+	var keys []SigningKey
+
+	stmt := selectSigningKey + ` WHERE user_id = $1 ORDER BY created_at DESC, id DESC`
+
+	rows, err := skr.db.GetConn().Query(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key SigningKey
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Fingerprint,
+			&key.PublicKey,
+			&key.Current,
+			&key.ClientHeld,
+			&key.CreatedAt,
+			&key.RetiredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ListUsersWithoutKey lists the ids of the users registered
+// before the registry, who have no signing key yet.
+func (skr *signingKeyRepository) ListUsersWithoutKey(ctx context.Context) ([]uint64, error) {
+	var userIDs []uint64
+
+	stmt := `
+	SELECT u.id
+	 FROM users u
+	 WHERE NOT EXISTS (SELECT 1 FROM signing_keys k WHERE k.user_id = u.id)
+	 ORDER BY u.id
+	`
+
+	rows, err := skr.db.GetConn().Query(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uint64
+		err := rows.Scan(&userID)
+		if err != nil {
+			return nil, err
+		}
+
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
+
+// CreateChallenge stores challenge as the challenge
+// of its user, replacing the one issued before.
+func (skr *signingKeyRepository) CreateChallenge(ctx context.Context, challenge Challenge) error {
+	stmt := `
+	INSERT INTO
+		signing_key_challenges (
+			user_id,
+			nonce,
+			expires_at
+		)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE
+		SET nonce = $2, expires_at = $3
+	`
+
+	_, err := skr.db.GetConn().Exec(ctx, stmt, challenge.UserID, challenge.Nonce, challenge.ExpiresAt)
+	return err
+}
+
+// ConsumeChallenge removes the challenge of a user with the
+// nonce and returns it, pgx.ErrNoRows is returned when the user
+// has no such challenge. A challenge is consumed only once.
+func (skr *signingKeyRepository) ConsumeChallenge(ctx context.Context, userID uint64, nonce []byte) (Challenge, error) {
+	var challenge Challenge
+
+	stmt := `
+	DELETE FROM signing_key_challenges
+	 WHERE user_id = $1 AND nonce = $2
+	 RETURNING user_id, nonce, expires_at
+	`
+
+	err := skr.db.GetConn().QueryRow(ctx, stmt, userID, nonce).Scan(
+		&challenge.UserID,
+		&challenge.Nonce,
+		&challenge.ExpiresAt,
+	)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	return challenge, nil
+}
@@ -0,0 +1,48 @@
+package signingkey
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+)
+
+// SigningKey is a public key registered for a user to
+// verify the signatures made with its private key.
+type SigningKey struct {
+	ID          uint64 `json:"id"`
+	UserID      uint64 `json:"user_id"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+
+	// Current is true for the key the user signs with,
+	// retired keys only verify earlier signatures.
+	Current bool `json:"current"`
+
+	// ClientHeld is true for keys whose private key only the
+	// user holds, signatures are made by its client.
+	ClientHeld bool       `json:"client_held"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+}
+
+// Challenge is a nonce issued to a user, who signs it along with
+// its account and a client held public key to register the key.
+type Challenge struct {
+	UserID    uint64
+	Nonce     []byte
+	ExpiresAt time.Time
+}
+
+// Fingerprint returns the hex encoded sha-256 of the
+// DER encoded SubjectPublicKeyInfo of publicKey.
+func Fingerprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}